@@ -12,6 +12,9 @@ require (
 	github.com/labstack/echo/v4 v4.1.10
 	github.com/lib/pq v1.2.0
 	github.com/pkg/errors v0.8.1
+	go.etcd.io/bbolt v1.3.5
 	go.mongodb.org/mongo-driver v1.1.2
+	golang.org/x/net v0.0.0-20190603091049-60506f45cf65
+	golang.org/x/text v0.3.2
 	google.golang.org/grpc v1.23.1
 )
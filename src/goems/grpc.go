@@ -35,8 +35,8 @@ func (s *PApiServiceServer) Check(context.Context, *grpc.PApiAuth) (*grpc.PApiRe
 	}, nil
 }
 
-func (s *PApiServiceServer) Call(_ context.Context, gctx *grpc.PApiContext) (*grpc.PApiResult, error) {
-	ctx := itineris.NewApiContext().SetApiName(gctx.ApiName).SetGateway("GRPC")
+func (s *PApiServiceServer) Call(grpcCtx context.Context, gctx *grpc.PApiContext) (*grpc.PApiResult, error) {
+	ctx := itineris.NewApiContext().SetApiName(gctx.ApiName).SetGateway("GRPC").SetGoContext(grpcCtx)
 	auth := itineris.NewApiAuth(gctx.ApiAuth.AppId, gctx.ApiAuth.AccessToken)
 	params := parseParams(gctx.ApiParams)
 	if params == nil {
@@ -26,6 +26,7 @@ func registerHttpHandler(uri, httpMethod, apiName string) {
 func _parseRequest(apiName string, c echo.Context) (*itineris.ApiContext, *itineris.ApiAuth, *itineris.ApiParams) {
 	httpMethod := c.Request().Method
 	ctx := itineris.NewApiContext().SetApiName(apiName).SetGateway("HTTP").
+		SetGoContext(c.Request().Context()).
 		SetContextValue("method", httpMethod).
 		SetContextValue("remote_addr", c.RealIP()).
 		SetContextValue("remote_real_id", c.Request().RemoteAddr).
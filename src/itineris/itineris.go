@@ -10,6 +10,7 @@ Package itineris creates a framework that help building API server over HTTP and
 package itineris
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/btnguyen2k/consu/reddo"
 	"main/src/utils"
@@ -35,6 +36,7 @@ ApiContext encapsulates the context information of an API call.
 */
 type ApiContext struct {
 	contextData map[string]interface{}
+	goContext   context.Context
 }
 
 /*
@@ -48,6 +50,26 @@ func NewApiContext() *ApiContext {
 	return ctx
 }
 
+/*
+GetGoContext returns the Go context bound to the API call (e.g. the HTTP request's context), context.Background() if none was set.
+
+Handlers pass it down to storage layer so that request cancellation/timeouts reach the database.
+*/
+func (ctx *ApiContext) GetGoContext() context.Context {
+	if ctx.goContext == nil {
+		return context.Background()
+	}
+	return ctx.goContext
+}
+
+/*
+SetGoContext binds a Go context to the API call.
+*/
+func (ctx *ApiContext) SetGoContext(goContext context.Context) *ApiContext {
+	ctx.goContext = goContext
+	return ctx
+}
+
 /*
 GetId returns the unique id associated with this API context.
 */
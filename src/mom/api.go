@@ -3,12 +3,39 @@ package mom
 import (
 	"fmt"
 	"github.com/btnguyen2k/consu/reddo"
+	"github.com/pkg/errors"
 	"main/src/itineris"
 	"main/src/utils"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
+var regexpListSeparator = regexp.MustCompile(`[,;\s]+`)
+
+// parseListParam parses a list parameter, which is either an array or a string of items separated by comma (,),
+// semi-colon (;) or spaces. Empty items are ignored.
+func parseListParam(params *itineris.ApiParams, name string) []string {
+	var items []string
+	switch v := params.GetParam(name).(type) {
+	case []interface{}:
+		for _, e := range v {
+			item, _ := reddo.ToString(e)
+			items = append(items, item)
+		}
+	case string:
+		items = regexpListSeparator.Split(v, -1)
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
 func parseParam(params *itineris.ApiParams, name string, defaultResult *itineris.ApiResult) (string, *itineris.ApiResult) {
 	value := params.GetParamAsTypeUnsafe(name, reddo.TypeString)
 	if value == nil || strings.TrimSpace(value.(string)) == "" {
@@ -17,6 +44,47 @@ func parseParam(params *itineris.ApiParams, name string, defaultResult *itineris
 	return strings.TrimSpace(value.(string)), nil
 }
 
+// Control keys that APIs put along with namespaces in the same map, either in output (e.g. reverse lookups) or in input
+// (e.g. allocation). They are reserved as namespaces, see isReservedNamespace.
+const (
+	keyTarget  = "_target"
+	keyAliased = "_aliased"
+	keyNext    = "_next"
+	keyFrom    = "_from"
+	keyTtl     = "_ttl"
+)
+
+var controlKeys = map[string]bool{keyTarget: true, keyAliased: true, keyNext: true, keyFrom: true, keyTtl: true}
+
+// reservedNamespaceResult returns an itineris.StatusErrorClient result if the (normalized) namespace is reserved for
+// internal use, nil otherwise.
+func reservedNamespaceResult(ns string) *itineris.ApiResult {
+	if isReservedNamespace(ns) {
+		return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Namespace [%s] is reserved.", ns))
+	}
+	return nil
+}
+
+// resolveTargetParam resolves a target parameter to its canonical id (see resolveTarget). The returned result is
+// non-nil if the target could not be resolved.
+func resolveTargetParam(ctx *itineris.ApiContext, appId, target string) (string, bool, *itineris.ApiResult) {
+	canonical, aliased, err := resolveTarget(ctx.GetGoContext(), daoMappings, appId, target)
+	if err != nil {
+		return "", false, itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+	}
+	return canonical, aliased, nil
+}
+
+// withAliasInfo notes in the message of a successful result that target 'requested' has been resolved to its
+// canonical id.
+func withAliasInfo(result *itineris.ApiResult, requested, canonical string, aliased bool) *itineris.ApiResult {
+	if !aliased || result == nil || result.Status != itineris.StatusOk {
+		return result
+	}
+	// results can be shared instances (e.g. itineris.ResultOk), do not modify them
+	return result.Clone().SetMessage(fmt.Sprintf("Target [%s] is an alias of [%s].", requested, canonical))
+}
+
 /*
 apiGetMappingForObject handles API "getMappingForObject".
 
@@ -24,14 +92,16 @@ Input parameters:
 
 	- ns: (string) namespace
 	- from: (string) object
+	- at: (optional, string) point-in-time lookup: timestamp (RFC3339 or UNIX epoch in seconds/milliseconds) to look up the mapping at
 
 Output:
 
+	- itineris.StatusErrorClient: invalid input parameters.
 	- itineris.StatusErrorServer: error on server during API call.
-	- itineris.StatusNotFound: object is not mapping to any target in the namespace.
+	- itineris.StatusNotFound: object is not mapping (or was not mapping at the specified time) to any target in the namespace.
 	- itineris.StatusOk: successful, mapping data is returned in `data` field as a map.
 */
-func apiGetMappingForObject(_ *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+func apiGetMappingForObject(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
 	var ns, obj string
 	var result *itineris.ApiResult
 	if ns, result = parseParam(params, "ns", itineris.ResultNotFound); result != nil {
@@ -42,8 +112,28 @@ func apiGetMappingForObject(_ *itineris.ApiContext, auth *itineris.ApiAuth, para
 	}
 
 	appId := auth.GetAppId()
-	obj = normalizeMappingObject(ns, obj)
-	mapping, err := daoMappings.FindTargetForObject(appId, ns, obj)
+	ns = normalizeNamespace(ns)
+	if isReservedNamespace(ns) {
+		return itineris.ResultNotFound
+	}
+	reg, result := namespaceRegistryOf(ctx, appId)
+	if result != nil {
+		return result
+	}
+	if obj, result = reg.normalizeObject(ns, obj); result != nil {
+		return result
+	}
+	var mapping *BoMapping
+	var err error
+	if atParam, _ := parseParam(params, "at", nil); atParam != "" {
+		at, e := parseTimestamp(atParam)
+		if e != nil {
+			return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [at]: %s", e.Error()))
+		}
+		mapping, err = findTargetForObjectAt(ctx.GetGoContext(), daoMappings, appId, ns, obj, at)
+	} else {
+		mapping, err = daoMappings.FindTargetForObject(ctx.GetGoContext(), appId, ns, obj)
+	}
 	if err != nil {
 		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
 	}
@@ -61,20 +151,27 @@ Input parameters:
 	- ns: (string) namespace
 	- from: (string) object
 	- to: (string)target
+	- ttl: (optional, int) time-to-live of the mapping in seconds, 0 means the mapping never expires. If not specified,
+	  the namespace's default TTL (declared in the app's namespace registry, or config "mom.ttl.namespaces") is used.
+	- attrs: (optional, map) free-form metadata attributes attached to the mapping.
 
 Output:
 
-	- itineris.StatusErrorClient: missing or invalid input parameters.
+	- itineris.StatusErrorClient: missing or invalid input parameters, or the namespace/object is rejected by the app's
+	  namespace registry.
 	- itineris.StatusErrorServer: error on server during API call.
-	- itineris.StatusConflict: object has already mapped to another target in the namespace.
-	- itineris.StatusOk: successful, mapping data is returned in `data` field as a map.
+	- itineris.StatusConflict: object has already mapped to another target in the namespace (or the target already has
+	  another object in a unique namespace), the existing mapping is returned in `data` field as a map.
+	- itineris.StatusOk: successful (or object had already mapped to the target), mapping data is returned in `data` field as a map.
+
+Mapping is an atomic compare-and-set: when clients race to map the same object, only one target wins.
 
 ArbitraryTargetMode:
 
 	- false: target must exist in the namespace or API will fail with status itineris.StatusErrorClient.
 	- true: server will not check for target's existence.
 */
-func apiMapObjectToTarget(_ *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+func apiMapObjectToTarget(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
 	var ns, obj, target string
 	var result *itineris.ApiResult
 	if ns, result = parseParam(params, "ns", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [ns].")); result != nil {
@@ -86,38 +183,149 @@ func apiMapObjectToTarget(_ *itineris.ApiContext, auth *itineris.ApiAuth, params
 	if target, result = parseParam(params, "to", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [to].")); result != nil {
 		return result
 	}
+	ttl, result := parseTtlParam(params, "ttl")
+	if result != nil {
+		return result
+	}
+	attrs, result := parseAttrsParam(params, "attrs")
+	if result != nil {
+		return result
+	}
 
 	appId := auth.GetAppId()
 	ns = normalizeNamespace(ns)
-	obj = normalizeMappingObject(ns, obj)
-	target = normalizeMappingTarget(target)
-	mapping, err := daoMappings.FindTargetForObject(appId, ns, obj)
-	if err != nil {
-		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+	if result = reservedNamespaceResult(ns); result != nil {
+		return result
 	}
-	if mapping != nil {
-		// obj has already mapped to a target
-		if mapping.To != target {
-			return itineris.NewApiResult(itineris.StatusConflict).
-				SetMessage(fmt.Sprintf("[%s] has already mapped to another target in namespace [%s].", obj, ns))
-		}
-		return itineris.NewApiResult(itineris.StatusOk).SetData(mapping)
+	reg, result := namespaceRegistryOf(ctx, appId)
+	if result != nil {
+		return result
+	}
+	attrs = reg.withRawObject(ns, obj, attrs)
+	if obj, result = reg.normalizeObject(ns, obj); result != nil {
+		return result
+	}
+	if result = reg.checkMappingObject(ns, obj); result != nil {
+		return result
+	}
+	requestedTarget := normalizeMappingTarget(target)
+	target, aliased, result := resolveTargetParam(ctx, appId, requestedTarget)
+	if result != nil {
+		return result
 	}
-
 	if !arbitraryTargetMode {
-		reversedMappings, err := daoMappings.FindObjectsToTarget(appId, ns, target)
+		reversedMappings, err := daoMappings.FindObjectsToTarget(ctx.GetGoContext(), appId, ns, target)
 		if err != nil {
 			return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
 		}
 		if reversedMappings == nil || len(reversedMappings) == 0 {
+			// target does not exist, obj can not have mapped to it
+			mapping, err := daoMappings.FindTargetForObject(ctx.GetGoContext(), appId, ns, obj)
+			if err != nil {
+				return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+			}
+			if mapping != nil {
+				return mappingConflictResult(&MappingConflictError{Mapping: mapping})
+			}
 			return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Target [%s] not found and arbitraryTargetMode is diabled.", target))
 		}
 	}
 
-	mapping, err = daoMappings.Map(appId, ns, obj, target)
+	mapping, err := daoMappings.Map(ctx.GetGoContext(), appId, ns, obj, target, mappingExpiry(ns, reg.ttl(ns, ttl), time.Now()), attrs, reg.uniqueNamespaces())
 	if err != nil {
+		if _, ok := IsMappingConflict(err); ok {
+			return mappingConflictResult(err)
+		}
+		if conflict, ok := IsUniqueConflict(err); ok {
+			return uniqueConflictResult(conflict)
+		}
 		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
 	}
+	return withAliasInfo(itineris.NewApiResult(itineris.StatusOk).SetData(mapping), requestedTarget, target, aliased)
+}
+
+// mappingConflictResult builds the itineris.StatusConflict result for a MappingConflictError, the winning mapping
+// is returned in `data` field.
+func mappingConflictResult(err error) *itineris.ApiResult {
+	mapping, _ := IsMappingConflict(err)
+	return itineris.NewApiResult(itineris.StatusConflict).SetMessage(err.Error()).SetData(mapping)
+}
+
+// parseAttrsParam parses a metadata attributes parameter. It returns nil if the parameter is absent; the returned result
+// is non-nil if the parameter is invalid.
+//
+// Attribute names must be non-empty, must not contain '.' and must not start with '$'.
+func parseAttrsParam(params *itineris.ApiParams, name string) (map[string]interface{}, *itineris.ApiResult) {
+	value := params.GetParam(name)
+	if value == nil {
+		return nil, nil
+	}
+	attrs, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [%s]: must be a map.", name))
+	}
+	for k := range attrs {
+		if k == "" || strings.Contains(k, ".") || strings.HasPrefix(k, "$") {
+			return nil, itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [%s]: invalid attribute name [%s].", name, k))
+		}
+	}
+	return attrs, nil
+}
+
+/*
+apiPatchMappingAttrs handles API "patchMappingAttrs".
+
+Input parameters:
+
+	- ns: (string) namespace
+	- from: (string) object
+	- attrs: (map) attributes to patch: attributes with null value are removed, others are added/replaced
+
+Output:
+
+	- itineris.StatusErrorClient: missing or invalid input parameters.
+	- itineris.StatusErrorServer: error on server during API call.
+	- itineris.StatusNotFound: object is not mapping to any target in the namespace.
+	- itineris.StatusOk: successful, updated mapping data is returned in `data` field as a map.
+
+The mapping's target, time and expiry are not changed.
+*/
+func apiPatchMappingAttrs(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+	var ns, obj string
+	var result *itineris.ApiResult
+	if ns, result = parseParam(params, "ns", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [ns].")); result != nil {
+		return result
+	}
+	if obj, result = parseParam(params, "from", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [from].")); result != nil {
+		return result
+	}
+	attrs, result := parseAttrsParam(params, "attrs")
+	if result != nil {
+		return result
+	}
+	if attrs == nil {
+		return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [attrs].")
+	}
+
+	appId := auth.GetAppId()
+	ns = normalizeNamespace(ns)
+	if result = reservedNamespaceResult(ns); result != nil {
+		return result
+	}
+	reg, result := namespaceRegistryOf(ctx, appId)
+	if result != nil {
+		return result
+	}
+	if obj, result = reg.normalizeObject(ns, obj); result != nil {
+		return result
+	}
+	mapping, err := daoMappings.PatchAttrs(ctx.GetGoContext(), appId, ns, obj, attrs)
+	if err != nil {
+		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+	}
+	if mapping == nil {
+		return itineris.ResultNotFound
+	}
 	return itineris.NewApiResult(itineris.StatusOk).SetData(mapping)
 }
 
@@ -136,7 +344,7 @@ Output:
 	- itineris.StatusErrorServer: error on server during API call.
 	- itineris.StatusOk: successful.
 */
-func apiUnmapObjectToTarget(_ *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+func apiUnmapObjectToTarget(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
 	var ns, obj, target string
 	var result *itineris.ApiResult
 	if ns, result = parseParam(params, "ns", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [ns].")); result != nil {
@@ -151,13 +359,114 @@ func apiUnmapObjectToTarget(_ *itineris.ApiContext, auth *itineris.ApiAuth, para
 
 	appId := auth.GetAppId()
 	ns = normalizeNamespace(ns)
-	obj = normalizeMappingObject(ns, obj)
-	target = normalizeMappingTarget(target)
-	_, err := daoMappings.Unmap(appId, ns, obj, target)
+	if result = reservedNamespaceResult(ns); result != nil {
+		return result
+	}
+	reg, result := namespaceRegistryOf(ctx, appId)
+	if result != nil {
+		return result
+	}
+	if obj, result = reg.normalizeObject(ns, obj); result != nil {
+		return result
+	}
+	requestedTarget := normalizeMappingTarget(target)
+	target, aliased, result := resolveTargetParam(ctx, appId, requestedTarget)
+	if result != nil {
+		return result
+	}
+	_, err := daoMappings.Unmap(ctx.GetGoContext(), appId, ns, obj, target)
 	if err != nil {
 		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
 	}
-	return itineris.ResultOk
+	return withAliasInfo(itineris.ResultOk, requestedTarget, target, aliased)
+}
+
+/*
+apiRemapObjectToTarget handles API "remapObjectToTarget".
+
+Input parameters:
+
+	- ns: (string) namespace
+	- from: (string) object
+	- to: (string) the new target
+	- expected: (string, optional) if specified, object is remapped only if it currently maps to this target
+
+Output:
+
+	- itineris.StatusErrorClient: missing or invalid input parameters.
+	- itineris.StatusErrorServer: error on server during API call.
+	- itineris.StatusNotFound: object is not mapping to any target in the namespace.
+	- itineris.StatusConflict: object currently maps to a target other than 'expected', the existing mapping is returned in `data` field as a map.
+	- itineris.StatusOk: successful, new mapping data is returned in `data` field as a map.
+
+ArbitraryTargetMode:
+
+	- false: the new target must exist in the namespace or API will fail with status itineris.StatusErrorClient.
+	- true: server will not check for target's existence.
+*/
+func apiRemapObjectToTarget(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+	var ns, obj, target string
+	var result *itineris.ApiResult
+	if ns, result = parseParam(params, "ns", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [ns].")); result != nil {
+		return result
+	}
+	if obj, result = parseParam(params, "from", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [from].")); result != nil {
+		return result
+	}
+	if target, result = parseParam(params, "to", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [to].")); result != nil {
+		return result
+	}
+	expectedTarget, _ := parseParam(params, "expected", nil)
+
+	appId := auth.GetAppId()
+	ns = normalizeNamespace(ns)
+	if result = reservedNamespaceResult(ns); result != nil {
+		return result
+	}
+	reg, result := namespaceRegistryOf(ctx, appId)
+	if result != nil {
+		return result
+	}
+	if obj, result = reg.normalizeObject(ns, obj); result != nil {
+		return result
+	}
+	if result = reg.checkMappingObject(ns, obj); result != nil {
+		return result
+	}
+	requestedTarget := normalizeMappingTarget(target)
+	target, aliased, result := resolveTargetParam(ctx, appId, requestedTarget)
+	if result != nil {
+		return result
+	}
+	if !arbitraryTargetMode {
+		reversedMappings, err := daoMappings.FindObjectsToTarget(ctx.GetGoContext(), appId, ns, target)
+		if err != nil {
+			return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+		}
+		if reversedMappings == nil || len(reversedMappings) == 0 {
+			return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Target [%s] not found and arbitraryTargetMode is diabled.", target))
+		}
+	}
+	if expectedTarget != "" {
+		if expectedTarget, _, result = resolveTargetParam(ctx, appId, expectedTarget); result != nil {
+			return result
+		}
+	}
+
+	mapping, err := daoMappings.Remap(ctx.GetGoContext(), appId, ns, obj, target, expectedTarget, reg.uniqueNamespaces())
+	if err != nil {
+		if _, ok := IsMappingConflict(err); ok {
+			return mappingConflictResult(err)
+		}
+		if conflict, ok := IsUniqueConflict(err); ok {
+			return uniqueConflictResult(conflict)
+		}
+		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+	}
+	if mapping == nil {
+		return itineris.ResultNotFound
+	}
+	return withAliasInfo(itineris.NewApiResult(itineris.StatusOk).SetData(mapping), requestedTarget, target, aliased)
 }
 
 /*
@@ -165,35 +474,192 @@ apiGetReverseMappinngsForTarget handles API "getReverseMappinngsForTarget".
 
 Input parameters:
 
-	- ns: (string) list of namespace, separated by comma (,) or semi-colon (;)
+	- ns: (optional, string) list of namespace, separated by comma (,) or semi-colon (;). If not specified, mappings in
+	  all namespaces are looked up with a single query, and only namespaces having mappings are returned
 	- to: (string)target
+	- count: (optional, bool) if true, only the number of mappings found in each namespace is returned
+	- order: (optional, string) "asc" or "desc": sort mappings by time (default: mappings are sorted by object)
+	- limit: (optional, int) page size, requires exactly one namespace
+	- cursor: (optional, string) cursor of the page to fetch (see "_next" below), requires exactly one namespace
 
 Output:
 
 	- itineris.StatusErrorClient: missing or invalid input parameters.
 	- itineris.StatusErrorServer: error on server during API call.
 	- itineris.StatusOk: successful, reversed mappings are returned in `data` field as a map {namespace: [array of mappings found in the namespace]}
+	  (or {namespace: number of mappings} if 'count' is true).
+	  The map also contains key "_target" (the canonical target id) and key "_aliased" (true if 'to' is a retired target
+	  that has been merged into "_target"). If there may be more mappings than 'limit', key "_next" is the cursor of the
+	  next page.
 */
-func apiGetReverseMappinngsForTarget(_ *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+func apiGetReverseMappinngsForTarget(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
 	var nsList, target string
 	var result *itineris.ApiResult
-	if nsList, result = parseParam(params, "ns", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [ns].")); result != nil {
+	nsList, _ = parseParam(params, "ns", nil)
+	if target, result = parseParam(params, "to", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [to].")); result != nil {
 		return result
 	}
-	if target, result = parseParam(params, "to", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [to].")); result != nil {
+	countOnly, _ := reddo.ToBool(params.GetParam("count"))
+	page := PageRequest{}
+	if page.Limit, result = parseLimitParam(params, "limit"); result != nil {
 		return result
 	}
-	resultData := map[string][]*BoMapping{}
+	if cursor, _ := parseParam(params, "cursor", nil); cursor != "" {
+		var err error
+		if page.After, err = decodeCursor(cursor); err != nil {
+			return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Invalid parameter [cursor].")
+		}
+	}
+	order, _ := parseParam(params, "order", nil)
+	switch strings.ToLower(order) {
+	case "":
+	case "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Invalid parameter [order]: must be either \"asc\" or \"desc\".")
+	}
+	var namespaces []string
+	if strings.TrimSpace(nsList) != "" {
+		namespaces = regexpListSeparator.Split(nsList, -1)
+	}
+	if !countOnly && (page.Limit > 0 || page.After != nil) && len(namespaces) != 1 {
+		return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Parameters [limit] and [cursor] require exactly one namespace.")
+	}
+
 	appId := auth.GetAppId()
-	target = normalizeMappingTarget(target)
-	namespaces := regexp.MustCompile(`[,;\s]+`).Split(nsList, -1)
+	target, aliased, result := resolveTargetParam(ctx, appId, target)
+	if result != nil {
+		return result
+	}
+	resultData := map[string]interface{}{keyTarget: target, keyAliased: aliased}
+	if len(namespaces) == 0 {
+		mappings, err := daoMappings.FindAllObjectsToTarget(ctx.GetGoContext(), appId, target)
+		if err != nil {
+			return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+		}
+		for ns, nsMappings := range groupMappingsByNamespace(removeReservedMappings(mappings)) {
+			switch {
+			case countOnly:
+				resultData[ns] = len(nsMappings)
+			case order != "":
+				resultData[ns] = pageMappings(nsMappings, PageRequest{Desc: page.Desc})
+			default:
+				sort.Slice(nsMappings, func(i, j int) bool { return nsMappings[i].From < nsMappings[j].From })
+				resultData[ns] = nsMappings
+			}
+		}
+		return itineris.NewApiResult(itineris.StatusOk).SetData(resultData)
+	}
 	for _, ns := range namespaces {
 		ns = normalizeNamespace(ns)
-		mappings, err := daoMappings.FindObjectsToTarget(appId, ns, target)
+		if result = reservedNamespaceResult(ns); result != nil {
+			return result
+		}
+		var data interface{}
+		var err error
+		switch {
+		case countOnly:
+			data, err = daoMappings.CountObjectsToTarget(ctx.GetGoContext(), appId, ns, target)
+		case order != "" || page.Limit > 0 || page.After != nil:
+			var mappings []*BoMapping
+			fetchPage := page
+			if page.Limit > 0 {
+				// fetch one more mapping to know if there is a next page
+				fetchPage.Limit++
+			}
+			mappings, err = daoMappings.FindObjectsToTargetPage(ctx.GetGoContext(), appId, ns, target, fetchPage)
+			if page.Limit > 0 && len(mappings) > page.Limit {
+				mappings = mappings[:page.Limit]
+				resultData[keyNext] = encodeCursor(positionOf(mappings[page.Limit-1]))
+			}
+			data = mappings
+		default:
+			data, err = daoMappings.FindObjectsToTarget(ctx.GetGoContext(), appId, ns, target)
+		}
 		if err != nil {
 			return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
 		}
-		resultData[ns] = mappings
+		resultData[ns] = data
+	}
+	return itineris.NewApiResult(itineris.StatusOk).SetData(resultData)
+}
+
+/*
+apiTranslateObject handles API "translateObject".
+
+Input parameters:
+
+	- ns: (string) namespace of the object
+	- from: (string) object
+	- targetNs: (string) list of namespaces to translate the object to, separated by comma (,) or semi-colon (;)
+
+Output:
+
+	- itineris.StatusErrorClient: missing or invalid input parameters.
+	- itineris.StatusErrorServer: error on server during API call.
+	- itineris.StatusNotFound: object is not mapping to any target in the namespace.
+	- itineris.StatusOk: successful, objects of the same target are returned in `data` field as a map
+	  {namespace: [array of mappings found in the namespace]}, with one entry per target namespace. The map also contains
+	  key "_target" (the object's target) and key "_from" (the object's mapping).
+*/
+func apiTranslateObject(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+	var ns, obj, nsList string
+	var result *itineris.ApiResult
+	if ns, result = parseParam(params, "ns", itineris.ResultNotFound); result != nil {
+		return result
+	}
+	if obj, result = parseParam(params, "from", itineris.ResultNotFound); result != nil {
+		return result
+	}
+	if nsList, result = parseParam(params, "targetNs", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [targetNs].")); result != nil {
+		return result
+	}
+	ns = normalizeNamespace(ns)
+	if isReservedNamespace(ns) {
+		return itineris.ResultNotFound
+	}
+	targetNamespaces := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, targetNs := range regexpListSeparator.Split(nsList, -1) {
+		targetNs = normalizeNamespace(targetNs)
+		if targetNs == "" || seen[targetNs] {
+			continue
+		}
+		if result = reservedNamespaceResult(targetNs); result != nil {
+			return result
+		}
+		seen[targetNs] = true
+		targetNamespaces = append(targetNamespaces, targetNs)
+	}
+	if len(targetNamespaces) == 0 {
+		return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [targetNs].")
+	}
+
+	appId := auth.GetAppId()
+	reg, result := namespaceRegistryOf(ctx, appId)
+	if result != nil {
+		return result
+	}
+	if obj, result = reg.normalizeObject(ns, obj); result != nil {
+		return result
+	}
+	mapping, mappings, err := daoMappings.TranslateObject(ctx.GetGoContext(), appId, ns, obj, targetNamespaces)
+	if err != nil {
+		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+	}
+	if mapping == nil {
+		return itineris.ResultNotFound
+	}
+	resultData := map[string]interface{}{keyTarget: mapping.To, keyFrom: mapping}
+	groups := groupMappingsByNamespace(mappings)
+	for _, targetNs := range targetNamespaces {
+		nsMappings := groups[targetNs]
+		if nsMappings == nil {
+			nsMappings = make([]*BoMapping, 0)
+		}
+		sort.Slice(nsMappings, func(i, j int) bool { return nsMappings[i].From < nsMappings[j].From })
+		resultData[targetNs] = nsMappings
 	}
 	return itineris.NewApiResult(itineris.StatusOk).SetData(resultData)
 }
@@ -204,28 +670,238 @@ apiAllocateTargetAndMap handles API "allocateTargetAndMap"
 Input parameters:
 
 	- a map of {namespace: object}
+	- _ttl: (optional, int) time-to-live of the new mappings in seconds, 0 means the mappings never expire. If not
+	  specified, each namespace's default TTL (declared in the app's namespace registry, or config "mom.ttl.namespaces")
+	  is used.
 
 Output:
 
-	- itineris.StatusErrorClient: missing or invalid input parameters.
+	- itineris.StatusErrorClient: missing or invalid input parameters, or a namespace/object is rejected by the app's
+	  namespace registry.
 	- itineris.StatusErrorServer: error on server during API call.
+	- itineris.StatusConflict: the objects have already mapped to different targets, or the target already has another
+	  object in a unique namespace (`data` field is the existing mapping).
 	- itineris.StatusOk: successful, reversed mappings are returned in `data` field as a map {}
 */
-func apiAllocateTargetAndMap(_ *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+func apiAllocateTargetAndMap(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
 	appId := auth.GetAppId()
+	ttl, result := parseTtlParam(params, keyTtl)
+	if result != nil {
+		return result
+	}
+	reg, result := namespaceRegistryOf(ctx, appId)
+	if result != nil {
+		return result
+	}
 	mapNsObj := make(map[string]string)
+	expiries := make(map[string]time.Time)
+	now := time.Now()
 	for k, v := range params.GetAllParams() {
+		if k == keyTtl {
+			continue
+		}
 		ns := normalizeNamespace(k)
+		if result := reservedNamespaceResult(ns); result != nil {
+			return result
+		}
 		obj, _ := reddo.ToString(v)
-		mapNsObj[ns] = normalizeMappingObject(ns, obj)
+		if mapNsObj[ns], result = reg.normalizeObject(ns, obj); result != nil {
+			return result
+		}
+		if result := reg.checkMappingObject(ns, mapNsObj[ns]); result != nil {
+			return result
+		}
+		if expiry := mappingExpiry(ns, reg.ttl(ns, ttl), now); expiry != nil {
+			expiries[ns] = *expiry
+		}
 	}
 	target := normalizeMappingTarget(utils.UniqueIdSmall())
-	target, err := daoMappings.Allocate(appId, mapNsObj, target)
+	target, err := daoMappings.Allocate(ctx.GetGoContext(), appId, mapNsObj, target, expiries, reg.uniqueNamespaces())
 	if err != nil {
-		if target != "" {
+		if conflict, ok := IsUniqueConflict(err); ok {
+			return uniqueConflictResult(conflict)
+		}
+		if _, ok := errors.Cause(err).(*AllocateConflictError); ok {
 			return itineris.NewApiResult(itineris.StatusConflict).SetMessage(err.Error())
 		}
 		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
 	}
 	return itineris.NewApiResult(itineris.StatusOk).SetData(target)
 }
+
+/*
+apiMergeTargets handles API "mergeTargets"
+
+Input parameters:
+
+	- from: (string) the target to be merged (losing target)
+	- to: (string) the surviving target
+	- unique_ns: (optional, list of strings) namespaces in which a target can have at most one object
+
+Output:
+
+	- itineris.StatusErrorClient: missing or invalid input parameters.
+	- itineris.StatusErrorServer: error on server during API call.
+	- itineris.StatusNotFound: the losing target does not exist.
+	- itineris.StatusConflict: both targets have objects in a unique namespace, nothing is moved.
+	- itineris.StatusOk: successful, `data` field is a map {"target": surviving target, "moved": [array of moved mappings]}
+
+Both 'from' and 'to' are resolved to their canonical ids first. After merging, 'from' is recorded as an alias of 'to'.
+*/
+func apiMergeTargets(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+	var from, into string
+	var result *itineris.ApiResult
+	if from, result = parseParam(params, "from", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [from].")); result != nil {
+		return result
+	}
+	if into, result = parseParam(params, "to", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [to].")); result != nil {
+		return result
+	}
+	appId := auth.GetAppId()
+	if from, _, result = resolveTargetParam(ctx, appId, from); result != nil {
+		return result
+	}
+	if into, _, result = resolveTargetParam(ctx, appId, into); result != nil {
+		return result
+	}
+	if from == into {
+		return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Cannot merge a target into itself.")
+	}
+
+	reg, result := namespaceRegistryOf(ctx, appId)
+	if result != nil {
+		return result
+	}
+	uniqueNamespaces := append(parseListParam(params, "unique_ns"), reg.uniqueNamespaces()...)
+	moved, err := daoMappings.MergeTargets(ctx.GetGoContext(), appId, from, into, uniqueNamespaces)
+	if err != nil {
+		if _, ok := errors.Cause(err).(*MergeConflictError); ok {
+			return itineris.NewApiResult(itineris.StatusConflict).SetMessage(err.Error())
+		}
+		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+	}
+	if len(moved) == 0 {
+		return itineris.NewApiResult(itineris.StatusNotFound).SetMessage(fmt.Sprintf("Target [%s] not found.", from))
+	}
+	return itineris.NewApiResult(itineris.StatusOk).SetData(map[string]interface{}{"target": into, "moved": removeReservedMappings(moved)})
+}
+
+/*
+apiSplitTarget handles API "splitTarget"
+
+Input parameters:
+
+	- from: (string) the target to be split
+	- objects: (map of {namespace: object}) objects to be moved out of target 'from'
+	- to: (optional, string) the target to move objects to, a new target is allocated if not specified
+
+Output:
+
+	- itineris.StatusErrorClient: missing or invalid input parameters.
+	- itineris.StatusErrorServer: error on server during API call.
+	- itineris.StatusConflict: some of the objects do not map to target 'from', or target 'to' already has another object
+	  in a unique namespace (`data` field is the existing mapping), nothing is moved.
+	- itineris.StatusOk: successful, `data` field is a map {"target": the new target, "moved": [array of moved mappings]}
+*/
+func apiSplitTarget(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+	var from string
+	var result *itineris.ApiResult
+	if from, result = parseParam(params, "from", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [from].")); result != nil {
+		return result
+	}
+	objects, _ := params.GetParam("objects").(map[string]interface{})
+	if len(objects) == 0 {
+		return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [objects].")
+	}
+	appId := auth.GetAppId()
+	reg, result := namespaceRegistryOf(ctx, appId)
+	if result != nil {
+		return result
+	}
+	mapNsObj := make(map[string]string)
+	for k, v := range objects {
+		ns := normalizeNamespace(k)
+		if result = reservedNamespaceResult(ns); result != nil {
+			return result
+		}
+		obj, _ := reddo.ToString(v)
+		if mapNsObj[ns], result = reg.normalizeObject(ns, obj); result != nil {
+			return result
+		}
+		if result = reg.checkMappingObject(ns, mapNsObj[ns]); result != nil {
+			return result
+		}
+	}
+
+	requestedFrom := normalizeMappingTarget(from)
+	from, aliased, result := resolveTargetParam(ctx, appId, requestedFrom)
+	if result != nil {
+		return result
+	}
+	into, _ := parseParam(params, "to", nil)
+	if into == "" {
+		into = normalizeMappingTarget(utils.UniqueIdSmall())
+	} else if into, _, result = resolveTargetParam(ctx, appId, into); result != nil {
+		return result
+	}
+	if from == into {
+		return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Cannot split a target into itself.")
+	}
+
+	moved, err := daoMappings.SplitTarget(ctx.GetGoContext(), appId, from, mapNsObj, into, reg.uniqueNamespaces())
+	if err != nil {
+		if conflict, ok := IsUniqueConflict(err); ok {
+			return uniqueConflictResult(conflict)
+		}
+		if _, ok := errors.Cause(err).(*SplitConflictError); ok {
+			return itineris.NewApiResult(itineris.StatusConflict).SetMessage(err.Error())
+		}
+		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+	}
+	result = itineris.NewApiResult(itineris.StatusOk).SetData(map[string]interface{}{"target": into, "moved": moved})
+	return withAliasInfo(result, requestedFrom, from, aliased)
+}
+
+/*
+apiGetMappingHistory handles API "getMappingHistory"
+
+Input parameters:
+
+	- ns: (string) namespace
+	- from: (string) object
+
+Output:
+
+	- itineris.StatusErrorClient: the object is rejected by the namespace's normalizer.
+	- itineris.StatusErrorServer: error on server during API call.
+	- itineris.StatusNotFound: invalid namespace.
+	- itineris.StatusOk: successful, history entries (sorted by time, oldest first) are returned in `data` field as an array.
+*/
+func apiGetMappingHistory(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+	var ns, obj string
+	var result *itineris.ApiResult
+	if ns, result = parseParam(params, "ns", itineris.ResultNotFound); result != nil {
+		return result
+	}
+	if obj, result = parseParam(params, "from", itineris.ResultNotFound); result != nil {
+		return result
+	}
+
+	appId := auth.GetAppId()
+	ns = normalizeNamespace(ns)
+	if isReservedNamespace(ns) {
+		return itineris.ResultNotFound
+	}
+	reg, result := namespaceRegistryOf(ctx, appId)
+	if result != nil {
+		return result
+	}
+	if obj, result = reg.normalizeObject(ns, obj); result != nil {
+		return result
+	}
+	history, err := daoMappings.GetMappingHistory(ctx.GetGoContext(), appId, ns, obj)
+	if err != nil {
+		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+	}
+	return itineris.NewApiResult(itineris.StatusOk).SetData(history)
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/btnguyen2k/consu/reddo"
 	"main/src/itineris"
 	"main/src/utils"
+	"sort"
 	"strings"
 	"time"
 )
@@ -40,6 +41,8 @@ Input parameters:
 
 	- id: (optional, string) app's unique id. If not provided, a unique id will be generated.
 	- secret: (string) app's secret key, used for authentication.
+	- normalizers: (optional, map {namespace: [steps]}) normalizer pipelines of the app, overriding config "mom.normalizers".
+	- phone_region: (optional, string) default region (e.g. "VN") of namespaces declared with normalizer "e164".
 	- other arbitrary fields/values.
 
 Output:
@@ -51,7 +54,7 @@ Output:
 
 Authorization: only "system" app can call this API.
 */
-func apiCreateApp(_ *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+func apiCreateApp(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
 	if auth.GetAppId() != appSystem {
 		return itineris.ResultNoPermission
 	}
@@ -66,13 +69,19 @@ func apiCreateApp(_ *itineris.ApiContext, auth *itineris.ApiAuth, params *itiner
 	}
 	secret := strings.TrimSpace(_secret.(string))
 	id := strings.ToLower(strings.TrimSpace(_id.(string)))
+	if _, err := appPipelines(params.GetAllParams()); err != nil {
+		return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [normalizers]: %s", err.Error()))
+	}
+	if _, err := appPhoneRegion(params.GetAllParams()); err != nil {
+		return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [phone_region]: %s", err.Error()))
+	}
 
 	app, err := daoApp.Get(id)
 	if err != nil {
 		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
 	}
 
-	err = daoMappings.InitStorage(id)
+	err = daoMappings.InitStorage(ctx.GetGoContext(), id)
 	if err != nil {
 		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
 	}
@@ -138,17 +147,22 @@ Input parameters:
 
 	- id: (string) app's id.
 	- secret: (optional, string) new app's secret key.
+	- normalizers: (optional, map {namespace: [steps]}) normalizer pipelines of the app, overriding config "mom.normalizers".
+	- phone_region: (optional, string) default region (e.g. "VN") of namespaces declared with normalizer "e164".
+	- confirm_migration: (optional, bool) must be true to change normalization of namespaces with existing mappings.
 	- other arbitrary fields/values.
 
 Output:
 
+	- itineris.StatusErrorClient: invalid input parameters.
 	- itineris.StatusErrorServer: error on server during API call.
 	- itineris.StatusNotFound: app does not exist.
+	- itineris.StatusConflict: normalization of a namespace with existing mappings would change, and it is not confirmed.
 	- itineris.StatusOk: successful.
 
 Authorization: only "system" and owner app can call this API.
 */
-func apiUpdateApp(_ *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+func apiUpdateApp(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
 	id := params.GetParamAsTypeUnsafe("id", reddo.TypeString)
 	if id == nil {
 		return itineris.ResultNotFound
@@ -165,10 +179,26 @@ func apiUpdateApp(_ *itineris.ApiContext, auth *itineris.ApiAuth, params *itiner
 		return itineris.ResultNotFound
 	}
 	secret := params.GetParamAsTypeUnsafe("secret", reddo.TypeString)
+	confirmed, result := parseConfirmMigration(params)
+	if result != nil {
+		return result
+	}
 
 	appData := params.GetAllParams()
 	delete(appData, "secret")
 	delete(appData, "id")
+	delete(appData, paramConfirmMigration)
+	if _, err := appPipelines(appData); err != nil {
+		return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [normalizers]: %s", err.Error()))
+	}
+	if _, err := appPhoneRegion(appData); err != nil {
+		return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [phone_region]: %s", err.Error()))
+	}
+	updated := *app
+	updated.Config = appData
+	if result := checkNormalizationChange(ctx, app, &updated, confirmed); result != nil {
+		return result
+	}
 	if secret != nil && strings.TrimSpace(secret.(string)) != "" {
 		app.Secret = utils.Sha1SumStr(app.Id + "." + strings.TrimSpace(secret.(string)))
 	}
@@ -199,7 +229,7 @@ Output:
 
 Authorization: only "system" app can call this API.
 */
-func apiDeleteApp(_ *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+func apiDeleteApp(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
 	if auth.GetAppId() != appSystem {
 		return itineris.ResultNoPermission
 	}
@@ -222,9 +252,260 @@ func apiDeleteApp(_ *itineris.ApiContext, auth *itineris.ApiAuth, params *itiner
 	if !ok {
 		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(fmt.Sprintf("Cannot delete app [%s].", id))
 	}
-	err = daoMappings.DestroyStorage(app.Id)
+	err = daoMappings.DestroyStorage(ctx.GetGoContext(), app.Id)
 	if err != nil {
 		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
 	}
 	return itineris.ResultOk
 }
+
+// loadAppForUpdate loads the app specified by parameter 'id' for modification by the calling app: only "system" and
+// owner app are allowed. The returned result is non-nil if the app can not be loaded.
+func loadAppForUpdate(auth *itineris.ApiAuth, params *itineris.ApiParams) (*BoApp, *itineris.ApiResult) {
+	id := params.GetParamAsTypeUnsafe("id", reddo.TypeString)
+	if id == nil {
+		return nil, itineris.ResultNotFound
+	}
+	if auth.GetAppId() != appSystem && auth.GetAppId() != id.(string) {
+		return nil, itineris.ResultNoPermission
+	}
+	app, err := daoApp.Get(id.(string))
+	if err != nil {
+		return nil, itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+	}
+	if app == nil {
+		return nil, itineris.ResultNotFound
+	}
+	return app, nil
+}
+
+// saveNamespaceRegistry persists an app whose namespace registry has been modified.
+func saveNamespaceRegistry(app *BoApp) *itineris.ApiResult {
+	app.Time = time.Now()
+	ok, err := daoApp.Update(app)
+	if err != nil {
+		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+	}
+	if !ok {
+		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(fmt.Sprintf("Cannot update app [%s].", app.Id))
+	}
+	return itineris.NewApiResult(itineris.StatusOk).SetData(app.Namespaces)
+}
+
+// paramConfirmMigration is the parameter confirming that an app changes how objects of namespaces with existing mappings
+// are normalized, see checkNormalizationChange.
+const paramConfirmMigration = "confirm_migration"
+
+// parseConfirmMigration parses parameter "confirm_migration". The returned result is non-nil if the parameter is invalid.
+func parseConfirmMigration(params *itineris.ApiParams) (bool, *itineris.ApiResult) {
+	value := params.GetParam(paramConfirmMigration)
+	if value == nil {
+		return false, nil
+	}
+	confirmed, err := reddo.ToBool(value)
+	if err != nil {
+		return false, itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [%s]: must be a boolean.", paramConfirmMigration))
+	}
+	return confirmed, nil
+}
+
+// checkNormalizationChange checks if changing an app from 'before' to 'after' changes how objects of a namespace with
+// existing mappings are normalized: these mappings would no longer be found by lookups of (newly) normalized objects.
+// Such a change is rejected with itineris.StatusConflict unless it is 'confirmed' (see parseConfirmMigration), i.e. the
+// caller takes care of migrating existing objects. It returns nil if the change is allowed.
+func checkNormalizationChange(ctx *itineris.ApiContext, before, after *BoApp, confirmed bool) *itineris.ApiResult {
+	if confirmed {
+		return nil
+	}
+	namespaces := append(normalizedNamespaces(before), normalizedNamespaces(after)...)
+	sort.Strings(namespaces)
+	for i, ns := range namespaces {
+		if (i > 0 && ns == namespaces[i-1]) || isReservedNamespace(ns) {
+			continue
+		}
+		if normalizationOf(before, ns) == normalizationOf(after, ns) {
+			continue
+		}
+		hasObjects, err := daoMappings.HasObjects(ctx.GetGoContext(), before.Id, ns)
+		if err != nil {
+			return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+		}
+		if hasObjects {
+			return itineris.NewApiResult(itineris.StatusConflict).SetMessage(fmt.Sprintf("Namespace [%s] has existing mappings, changing its normalizer requires parameter [%s] to be true.", ns, paramConfirmMigration))
+		}
+	}
+	return nil
+}
+
+/*
+apiGetNamespaceRegistry handles API call "getNamespaceRegistry".
+
+Input parameters:
+
+	- id: (string) app's id.
+
+Output:
+
+	- itineris.StatusErrorServer: error on server during API call.
+	- itineris.StatusNotFound: app does not exist.
+	- itineris.StatusOk: successful, app's namespace registry is returned in `data` field as a map
+	  {"strict": bool, "namespaces": {namespace: policies}}.
+
+Authorization: only "system" and owner app can call this API.
+*/
+func apiGetNamespaceRegistry(_ *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+	app, result := loadAppForUpdate(auth, params)
+	if result != nil {
+		return result
+	}
+	registry := app.Namespaces
+	if registry == nil {
+		registry = &BoNamespaceRegistry{Namespaces: map[string]*BoNamespace{}}
+	}
+	return itineris.NewApiResult(itineris.StatusOk).SetData(registry)
+}
+
+/*
+apiSetNamespaceStrictMode handles API call "setNamespaceStrictMode".
+
+Input parameters:
+
+	- id: (string) app's id.
+	- strict: (bool) if true, APIs creating mappings reject namespaces that are not declared.
+
+Output:
+
+	- itineris.StatusErrorClient: missing or invalid input parameters.
+	- itineris.StatusErrorServer: error on server during API call.
+	- itineris.StatusNotFound: app does not exist.
+	- itineris.StatusOk: successful, app's namespace registry is returned in `data` field.
+
+Authorization: only "system" and owner app can call this API.
+*/
+func apiSetNamespaceStrictMode(_ *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+	value := params.GetParam("strict")
+	if value == nil {
+		return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [strict].")
+	}
+	strict, err := reddo.ToBool(value)
+	if err != nil {
+		return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Invalid parameter [strict]: must be a boolean.")
+	}
+	app, result := loadAppForUpdate(auth, params)
+	if result != nil {
+		return result
+	}
+	if app.Namespaces == nil {
+		app.Namespaces = &BoNamespaceRegistry{Namespaces: map[string]*BoNamespace{}}
+	}
+	app.Namespaces.Strict = strict
+	return saveNamespaceRegistry(app)
+}
+
+/*
+apiDeclareNamespace handles API call "declareNamespace".
+
+Input parameters:
+
+	- id: (string) app's id.
+	- ns: (string) the namespace to declare (or re-declare).
+	- normalizer: (optional, string) name of the normalizer applied to objects of the namespace.
+	- region: (optional, string) default region (e.g. "VN") of phone numbers, for normalizer "e164".
+	- keep_raw: (optional, bool) if true, objects are stored as received in attribute "raw" of new mappings.
+	- validation: (optional, string) regular expression that normalized objects must match.
+	- ttl: (optional, int) default time-to-live of new mappings in seconds, 0 means the mappings never expire.
+	- unique: (optional, bool) if true, a target can have at most one object in the namespace.
+	- confirm_migration: (optional, bool) must be true to change normalization of the namespace if it has existing
+	  mappings.
+
+Output:
+
+	- itineris.StatusErrorClient: missing or invalid input parameters.
+	- itineris.StatusErrorServer: error on server during API call.
+	- itineris.StatusNotFound: app does not exist.
+	- itineris.StatusConflict: normalization of the namespace would change while it has existing mappings, and it is not
+	  confirmed.
+	- itineris.StatusOk: successful, app's namespace registry is returned in `data` field.
+
+Authorization: only "system" and owner app can call this API.
+*/
+func apiDeclareNamespace(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+	ns, result := parseParam(params, "ns", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Required parameter [ns]."))
+	if result != nil {
+		return result
+	}
+	ns = normalizeNamespace(ns)
+	if result = reservedNamespaceResult(ns); result != nil {
+		return result
+	}
+	decl, result := parseNamespaceDeclaration(params)
+	if result != nil {
+		return result
+	}
+	confirmed, result := parseConfirmMigration(params)
+	if result != nil {
+		return result
+	}
+	app, result := loadAppForUpdate(auth, params)
+	if result != nil {
+		return result
+	}
+	if app.Namespaces == nil {
+		app.Namespaces = &BoNamespaceRegistry{}
+	}
+	if app.Namespaces.Namespaces == nil {
+		app.Namespaces.Namespaces = map[string]*BoNamespace{}
+	}
+	before := app.Clone()
+	app.Namespaces.Namespaces[ns] = decl
+	if result := checkNormalizationChange(ctx, before, app, confirmed); result != nil {
+		return result
+	}
+	return saveNamespaceRegistry(app)
+}
+
+/*
+apiUndeclareNamespace handles API call "undeclareNamespace".
+
+Input parameters:
+
+	- id: (string) app's id.
+	- ns: (string) the namespace to remove from the registry. Existing mappings in the namespace are kept.
+	- confirm_migration: (optional, bool) must be true to remove a declared normalizer if the namespace has existing
+	  mappings.
+
+Output:
+
+	- itineris.StatusErrorClient: invalid input parameters.
+	- itineris.StatusErrorServer: error on server during API call.
+	- itineris.StatusNotFound: app does not exist, or the namespace is not declared.
+	- itineris.StatusConflict: normalization of the namespace would change while it has existing mappings, and it is not
+	  confirmed.
+	- itineris.StatusOk: successful, app's namespace registry is returned in `data` field.
+
+Authorization: only "system" and owner app can call this API.
+*/
+func apiUndeclareNamespace(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+	ns, result := parseParam(params, "ns", itineris.ResultNotFound)
+	if result != nil {
+		return result
+	}
+	ns = normalizeNamespace(ns)
+	confirmed, result := parseConfirmMigration(params)
+	if result != nil {
+		return result
+	}
+	app, result := loadAppForUpdate(auth, params)
+	if result != nil {
+		return result
+	}
+	if app.Namespaces.get(ns) == nil {
+		return itineris.ResultNotFound
+	}
+	before := app.Clone()
+	delete(app.Namespaces.Namespaces, ns)
+	if result := checkNormalizationChange(ctx, before, app, confirmed); result != nil {
+		return result
+	}
+	return saveNamespaceRegistry(app)
+}
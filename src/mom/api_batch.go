@@ -0,0 +1,358 @@
+package mom
+
+import (
+	"context"
+	"fmt"
+	"main/src/itineris"
+	"strings"
+	"time"
+)
+
+/*
+Batch APIs: perform many lookups/operations in one call.
+
+@author Thanh Nguyen <btnguyen2k@gmail.com>
+@since 0.1.0
+*/
+
+var (
+	// maximum number of items accepted by a batch API call (config "mom.batch.max_items")
+	batchMaxItems = 1000
+)
+
+const (
+	// per-item statuses of batch operations
+	batchStatusOk       = "ok"
+	batchStatusConflict = "conflict"
+	batchStatusInvalid  = "invalid"
+)
+
+// batchItemResult is the result of an item of a batch operation.
+type batchItemResult struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// parseBatchItems parses the list of items of a batch API call. Each item must be a map; the returned result is non-nil
+// if the parameter is missing or invalid, or has more than batchMaxItems items.
+func parseBatchItems(params *itineris.ApiParams, name string) ([]map[string]interface{}, *itineris.ApiResult) {
+	list, ok := params.GetParam(name).([]interface{})
+	if !ok {
+		return nil, itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Required parameter [%s] as a list.", name))
+	}
+	if len(list) > batchMaxItems {
+		return nil, itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Too many items in parameter [%s]: maximum %d.", name, batchMaxItems))
+	}
+	items := make([]map[string]interface{}, len(list))
+	for i, v := range list {
+		if items[i], ok = v.(map[string]interface{}); !ok {
+			return nil, itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [%s]: item #%d is not a map.", name, i))
+		}
+	}
+	return items, nil
+}
+
+// batchItemString returns value of a string field of a batch item, trimmed.
+func batchItemString(item map[string]interface{}, field string) string {
+	v, _ := item[field].(string)
+	return strings.TrimSpace(v)
+}
+
+// findMappingsPerNamespace looks up objects ({namespace: [objects]}, normalized) with one DAO call per namespace, and
+// returns the found mappings as {namespace: {object: mapping}}.
+func findMappingsPerNamespace(ctx context.Context, appId string, objsPerNs map[string][]string) (map[string]map[string]*BoMapping, error) {
+	found := make(map[string]map[string]*BoMapping)
+	for ns, objs := range objsPerNs {
+		mappings, err := daoMappings.FindTargetsForObjects(ctx, appId, ns, objs)
+		if err != nil {
+			return nil, err
+		}
+		found[ns] = make(map[string]*BoMapping)
+		for _, mapping := range mappings {
+			found[ns][mapping.From] = mapping
+		}
+	}
+	return found, nil
+}
+
+// parseBatchMappings parses items of a batch map/unmap call into normalized mappings (according to the app's namespace
+// registry 'reg'), with target aliases resolved. Items that are invalid are marked in the returned results, and their
+// mappings are nil; 'parseExtra' (may be nil) parses additional fields of an item into its mapping.
+func parseBatchMappings(ctx *itineris.ApiContext, appId string, reg *BoNamespaceRegistry, items []map[string]interface{}, parseExtra func(item *itineris.ApiParams, bo *BoMapping) *itineris.ApiResult) ([]*BoMapping, []*batchItemResult, *itineris.ApiResult) {
+	mappings := make([]*BoMapping, len(items))
+	results := make([]*batchItemResult, len(items))
+	targets := make([]string, 0, len(items))
+	for i, item := range items {
+		ns, obj, target := batchItemString(item, "ns"), batchItemString(item, "from"), batchItemString(item, "to")
+		if ns == "" || obj == "" || target == "" {
+			results[i] = &batchItemResult{Status: batchStatusInvalid, Message: "Required fields [ns], [from] and [to]."}
+			continue
+		}
+		ns = normalizeNamespace(ns)
+		if result := reservedNamespaceResult(ns); result != nil {
+			results[i] = &batchItemResult{Status: batchStatusInvalid, Message: result.Message}
+			continue
+		}
+		from, result := reg.normalizeObject(ns, obj)
+		if result != nil {
+			results[i] = &batchItemResult{Status: batchStatusInvalid, Message: result.Message}
+			continue
+		}
+		bo := &BoMapping{Namespace: ns, From: from, To: normalizeMappingTarget(target)}
+		if parseExtra != nil {
+			params := itineris.NewApiParams()
+			for k, v := range item {
+				params.SetParam(k, v)
+			}
+			if result := parseExtra(params, bo); result != nil {
+				results[i] = &batchItemResult{Status: batchStatusInvalid, Message: result.Message}
+				continue
+			}
+		}
+		mappings[i] = bo
+		targets = append(targets, bo.To)
+	}
+	aliases, err := resolveTargets(ctx.GetGoContext(), daoMappings, appId, targets)
+	if err != nil {
+		return nil, nil, itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+	}
+	for i, bo := range mappings {
+		if bo == nil {
+			continue
+		}
+		if canonical, ok := aliases[bo.To]; ok {
+			results[i] = &batchItemResult{Status: batchStatusOk, Message: fmt.Sprintf("Target [%s] is an alias of [%s].", bo.To, canonical)}
+			bo.To = canonical
+		}
+	}
+	return mappings, results, nil
+}
+
+// nonNilMappings returns the non-nil mappings of a list, along with their indexes in the list.
+func nonNilMappings(mappings []*BoMapping) ([]*BoMapping, []int) {
+	result := make([]*BoMapping, 0, len(mappings))
+	indexes := make([]int, 0, len(mappings))
+	for i, bo := range mappings {
+		if bo != nil {
+			result = append(result, bo)
+			indexes = append(indexes, i)
+		}
+	}
+	return result, indexes
+}
+
+// okResult returns the result of a successful batch item, keeping the message set while parsing (if any).
+func okResult(parsed *batchItemResult, data interface{}) *batchItemResult {
+	result := &batchItemResult{Status: batchStatusOk, Data: data}
+	if parsed != nil {
+		result.Message = parsed.Message
+	}
+	return result
+}
+
+/*
+apiLookupMappings handles API "lookupMappings".
+
+Input parameters:
+
+	- items: (list of maps {"ns": namespace, "from": object}) objects to look up, at most batchMaxItems items
+
+Output:
+
+	- itineris.StatusErrorClient: missing or invalid input parameters.
+	- itineris.StatusErrorServer: error on server during API call.
+	- itineris.StatusOk: successful, `data` field is a list in the same order as 'items': mapping data of the item, or
+	  nil if the object is not mapping to any target in the namespace.
+
+Objects are grouped by namespace, and each namespace is looked up with a single DAO call.
+*/
+func apiLookupMappings(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+	items, result := parseBatchItems(params, "items")
+	if result != nil {
+		return result
+	}
+	reg, result := namespaceRegistryOf(ctx, auth.GetAppId())
+	if result != nil {
+		return result
+	}
+	namespaces := make([]string, len(items))
+	objects := make([]string, len(items))
+	objsPerNs := make(map[string][]string)
+	for i, item := range items {
+		ns, obj := batchItemString(item, "ns"), batchItemString(item, "from")
+		if ns == "" || obj == "" {
+			return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [items]: item #%d requires [ns] and [from].", i))
+		}
+		namespaces[i] = normalizeNamespace(ns)
+		if objects[i], result = reg.normalizeObject(namespaces[i], obj); result != nil {
+			return result
+		}
+		if !isReservedNamespace(namespaces[i]) {
+			objsPerNs[namespaces[i]] = append(objsPerNs[namespaces[i]], objects[i])
+		}
+	}
+
+	found, err := findMappingsPerNamespace(ctx.GetGoContext(), auth.GetAppId(), objsPerNs)
+	if err != nil {
+		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+	}
+	data := make([]*BoMapping, len(items))
+	for i := range items {
+		data[i] = found[namespaces[i]][objects[i]]
+	}
+	return itineris.NewApiResult(itineris.StatusOk).SetData(data)
+}
+
+/*
+apiMapObjectsToTargets handles API "mapObjectsToTargets", the batch version of API "mapObjectToTarget".
+
+Input parameters:
+
+	- items: (list of maps {"ns": namespace, "from": object, "to": target, "ttl": optional ttl, "attrs": optional attributes})
+	  mappings to create, at most batchMaxItems items. Fields have the same meaning as parameters of API "mapObjectToTarget".
+
+Output:
+
+	- itineris.StatusErrorClient: missing or invalid parameter 'items'.
+	- itineris.StatusErrorServer: error on server during API call.
+	- itineris.StatusOk: successful, `data` field is a list in the same order as 'items', each element is a map:
+	  {"status": "ok"|"conflict"|"invalid", "message": optional message, "data": the object's mapping}. On "conflict",
+	  the object has already mapped to another target and the existing mapping is returned.
+
+Items are mapped with bulk writes; each item is mapped atomically, but the batch as a whole is not.
+*/
+func apiMapObjectsToTargets(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+	items, result := parseBatchItems(params, "items")
+	if result != nil {
+		return result
+	}
+	appId := auth.GetAppId()
+	reg, result := namespaceRegistryOf(ctx, appId)
+	if result != nil {
+		return result
+	}
+	now := time.Now()
+	mappings, results, result := parseBatchMappings(ctx, appId, reg, items, func(item *itineris.ApiParams, bo *BoMapping) *itineris.ApiResult {
+		if result := reg.checkMappingObject(bo.Namespace, bo.From); result != nil {
+			return result
+		}
+		ttl, result := parseTtlParam(item, "ttl")
+		if result != nil {
+			return result
+		}
+		if bo.Attrs, result = parseAttrsParam(item, "attrs"); result != nil {
+			return result
+		}
+		bo.Attrs = reg.withRawObject(bo.Namespace, batchItemString(item.GetAllParams(), "from"), bo.Attrs)
+		bo.Expiry = mappingExpiry(bo.Namespace, reg.ttl(bo.Namespace, ttl), now)
+		return nil
+	})
+	if result != nil {
+		return result
+	}
+	if !arbitraryTargetMode {
+		// target must exist in the namespace
+		exists := make(map[string]bool)
+		for i, bo := range mappings {
+			if bo == nil {
+				continue
+			}
+			key := bo.Namespace + "\x00" + bo.To
+			if _, ok := exists[key]; !ok {
+				reversedMappings, err := daoMappings.FindObjectsToTarget(ctx.GetGoContext(), appId, bo.Namespace, bo.To)
+				if err != nil {
+					return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+				}
+				exists[key] = len(reversedMappings) > 0
+			}
+			if !exists[key] {
+				results[i] = &batchItemResult{Status: batchStatusInvalid, Message: fmt.Sprintf("Target [%s] not found and arbitraryTargetMode is diabled.", bo.To)}
+				mappings[i] = nil
+			}
+		}
+	}
+
+	toMap, indexes := nonNilMappings(mappings)
+	if len(toMap) > 0 {
+		// a target can have at most one object in unique namespaces, including among items of the batch
+		mapped, err := daoMappings.MapMany(ctx.GetGoContext(), appId, toMap, reg.uniqueNamespaces())
+		if err != nil {
+			return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+		}
+		for j, mapping := range mapped {
+			i := indexes[j]
+			if mapping.From != toMap[j].From {
+				results[i] = &batchItemResult{Status: batchStatusConflict, Message: uniqueConflictResult(mapping).Message, Data: mapping}
+			} else if mapping.To != toMap[j].To {
+				results[i] = &batchItemResult{Status: batchStatusConflict, Message: (&MappingConflictError{Mapping: mapping}).Error(), Data: mapping}
+			} else {
+				results[i] = okResult(results[i], mapping)
+			}
+		}
+	}
+	return itineris.NewApiResult(itineris.StatusOk).SetData(results)
+}
+
+/*
+apiUnmapObjectsToTargets handles API "unmapObjectsToTargets", the batch version of API "unmapObjectToTarget".
+
+Input parameters:
+
+	- items: (list of maps {"ns": namespace, "from": object, "to": target}) mappings to remove, at most batchMaxItems items
+
+Output:
+
+	- itineris.StatusErrorClient: missing or invalid parameter 'items'.
+	- itineris.StatusErrorServer: error on server during API call.
+	- itineris.StatusOk: successful, `data` field is a list in the same order as 'items', each element is a map:
+	  {"status": "ok"|"conflict"|"invalid", "message": optional message, "data": ...}. On "ok", `data` tells if the
+	  mapping has been removed (false if the object was not mapping to any target); on "conflict", the object maps to
+	  another target and the existing mapping is returned.
+
+Items are unmapped with bulk writes.
+*/
+func apiUnmapObjectsToTargets(ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+	items, result := parseBatchItems(params, "items")
+	if result != nil {
+		return result
+	}
+	appId := auth.GetAppId()
+	reg, result := namespaceRegistryOf(ctx, appId)
+	if result != nil {
+		return result
+	}
+	mappings, results, result := parseBatchMappings(ctx, appId, reg, items, nil)
+	if result != nil {
+		return result
+	}
+
+	toUnmap, indexes := nonNilMappings(mappings)
+	if len(toUnmap) == 0 {
+		return itineris.NewApiResult(itineris.StatusOk).SetData(results)
+	}
+	removed, err := daoMappings.UnmapMany(ctx.GetGoContext(), appId, toUnmap)
+	if err != nil {
+		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+	}
+	// find out why the other items were not removed
+	objsPerNs := make(map[string][]string)
+	for j, bo := range toUnmap {
+		if !removed[j] {
+			objsPerNs[bo.Namespace] = append(objsPerNs[bo.Namespace], bo.From)
+		}
+	}
+	found, err := findMappingsPerNamespace(ctx.GetGoContext(), appId, objsPerNs)
+	if err != nil {
+		return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+	}
+	for j, bo := range toUnmap {
+		i := indexes[j]
+		if existing := found[bo.Namespace][bo.From]; !removed[j] && existing != nil && existing.To != bo.To {
+			results[i] = &batchItemResult{Status: batchStatusConflict, Message: (&MappingConflictError{Mapping: existing}).Error(), Data: existing}
+		} else {
+			results[i] = okResult(results[i], removed[j])
+		}
+	}
+	return itineris.NewApiResult(itineris.StatusOk).SetData(results)
+}
@@ -7,6 +7,9 @@ import (
 	"strings"
 )
 
+// context key of the authenticated app (*BoApp)
+const ctxApp = "mom_app"
+
 func NewMomApiAuthenticator() itineris.IApiAuthenticator {
 	return &ApiAuthenticator{}
 }
@@ -23,5 +26,7 @@ func (a *ApiAuthenticator) Authenticate(ctx *itineris.ApiContext, auth *itineris
 	if app == nil || !strings.EqualFold(app.Secret, utils.Sha1SumStr(app.Id+"."+auth.GetAccessToken())) {
 		return false
 	}
+	// keep the app for API handlers, saving them another lookup
+	ctx.SetContextValue(ctxApp, app)
 	return true
 }
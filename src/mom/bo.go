@@ -1,9 +1,13 @@
 package mom
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
 	"log"
+	"sort"
 	"strings"
 	"time"
 )
@@ -21,17 +25,78 @@ const (
 	fieldMapTo        = "to"
 	fieldMapTime      = "t"
 	fieldMapAppId     = "app"
+	fieldMapAttrs     = "attrs"
 )
 
 /*
 BoMapping defines a mapping record
+
+Expiry is optional: a mapping with expiry is no longer visible once the expiry time has passed, and is eventually
+removed from storage.
+
+Attrs holds optional free-form metadata attached to the mapping (e.g. source system, confidence, verification status).
 */
 type BoMapping struct {
-	Namespace string    `json:"ns"`
-	From      string    `json:"frm"`
-	To        string    `json:"to"`
-	Time      time.Time `json:"t"`
-	AppId     string    `json:"app"`
+	Namespace string                 `json:"ns"`
+	From      string                 `json:"frm"`
+	To        string                 `json:"to"`
+	Time      time.Time              `json:"t"`
+	AppId     string                 `json:"app"`
+	Expiry    *time.Time             `json:"exp,omitempty"`
+	Attrs     map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// isExpired checks if the mapping has expired as of time 'now'.
+func (bo *BoMapping) isExpired(now time.Time) bool {
+	return bo != nil && bo.Expiry != nil && !now.Before(*bo.Expiry)
+}
+
+// liveMapping returns the mapping, or nil if it has expired.
+func liveMapping(bo *BoMapping) *BoMapping {
+	if bo.isExpired(time.Now()) {
+		return nil
+	}
+	return bo
+}
+
+// liveMappings filters out expired mappings.
+func liveMappings(mappings []*BoMapping) []*BoMapping {
+	now := time.Now()
+	result := make([]*BoMapping, 0, len(mappings))
+	for _, bo := range mappings {
+		if !bo.isExpired(now) {
+			result = append(result, bo)
+		}
+	}
+	return result
+}
+
+// patchAttrs applies a patch to mapping attributes and returns the result as a new map: attributes in 'patch' are set,
+// except for nil values which remove the corresponding attributes. It returns nil if the result has no attribute.
+func patchAttrs(attrs, patch map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(attrs)+len(patch))
+	for k, v := range attrs {
+		result[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(result, k)
+		} else {
+			result[k] = v
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// expiryOf returns the expiry of a namespace in 'expiries' ({namespace: expiry}), or nil if there is none.
+func expiryOf(expiries map[string]time.Time, namespace string) *time.Time {
+	if expiry, ok := expiries[namespace]; ok {
+		return &expiry
+	}
+	return nil
 }
 
 func (bo *BoMapping) FromMap(data map[string]interface{}) *BoMapping {
@@ -58,6 +123,9 @@ IDaoMoMapping defines many-to-one mapping API.
 
 A mapping is a direction {from/object -> to/target} (e.g. object maps to target}
 
+All functions receive a context.Context as first argument; implementations should honor its cancellation/deadline
+when talking to the underlying storage.
+
 	- An object can map to maximum one target
 	- A target can be mapped by many objects
 */
@@ -65,22 +133,58 @@ type IDaoMoMapping interface {
 	/*
 	   InitStorage initializes storage to store an app's mappings.
 	*/
-	InitStorage(appId string) error
+	InitStorage(ctx context.Context, appId string) error
 
 	/*
 	   DestroyStorage cleans up storage allocated to store an app's mappings.
 	*/
-	DestroyStorage(appId string) error
+	DestroyStorage(ctx context.Context, appId string) error
 
 	/*
 		FindTargetForObject is given an object, finds the target of direction {object -> target}.
 	*/
-	FindTargetForObject(appId, namespace, object string) (*BoMapping, error)
+	FindTargetForObject(ctx context.Context, appId, namespace, object string) (*BoMapping, error)
+
+	/*
+		FindTargetsForObjects is the batch version of FindTargetForObject: given objects in a namespace, finds their
+		mappings (in no particular order) with a single lookup. Objects that have not mapped to any target are skipped.
+	*/
+	FindTargetsForObjects(ctx context.Context, appId, namespace string, objects []string) ([]*BoMapping, error)
 
 	/*
 		FindObjectsToTargets is given a target, finds all the objects of direction {target <- objects}.
 	*/
-	FindObjectsToTarget(appId, namespace, target string) ([]*BoMapping, error)
+	FindObjectsToTarget(ctx context.Context, appId, namespace, target string) ([]*BoMapping, error)
+
+	/*
+		FindObjectsToTargetPage is the paginated version of FindObjectsToTarget: mappings are sorted by time (then by
+		object), and the page specified by 'page' is returned (see mapping_page.go).
+	*/
+	FindObjectsToTargetPage(ctx context.Context, appId, namespace, target string, page PageRequest) ([]*BoMapping, error)
+
+	/*
+		FindAllObjectsToTarget finds all the objects of direction {target <- objects} across all namespaces (including
+		reserved ones), with a single lookup.
+	*/
+	FindAllObjectsToTarget(ctx context.Context, appId, target string) ([]*BoMapping, error)
+
+	/*
+		TranslateObject finds the mapping of an object, and the objects mapping to the same target in other namespaces.
+
+		It returns the object's mapping (nil if the object is not mapping to any target) and the mappings of the object's
+		target in the target namespaces.
+	*/
+	TranslateObject(ctx context.Context, appId, namespace, from string, targetNamespaces []string) (*BoMapping, []*BoMapping, error)
+
+	/*
+		CountObjectsToTarget counts the objects of direction {target <- objects}.
+	*/
+	CountObjectsToTarget(ctx context.Context, appId, namespace, target string) (int, error)
+
+	/*
+		HasObjects checks if a namespace has at least one object mapping to a target (expired mappings are not counted).
+	*/
+	HasObjects(ctx context.Context, appId, namespace string) (bool, error)
 
 	/*
 		Map maps object to target.
@@ -88,18 +192,516 @@ type IDaoMoMapping interface {
 
 		    - 'object' has not mapped to any target, or
 		    - 'object' had mapped to the target
+
+		If 'object' has already mapped to another target, Map returns the existing mapping along with an error.
+
+		If 'expiry' is not nil, the mapping expires at that time. 'attrs' (may be nil) is attached to the mapping as metadata.
+		Mapping an object that had mapped to the target does not change expiry nor attributes of the existing mapping.
+		Expired mappings are treated as non-existent.
+
+		'uniqueNamespaces' lists namespaces in which a target can have at most one object: if 'namespace' is one of them
+		and the target already has another object in it, nothing is written and a UniqueConflictError is returned.
+	*/
+	Map(ctx context.Context, appId, namespace, object, target string, expiry *time.Time, attrs map[string]interface{}, uniqueNamespaces []string) (*BoMapping, error)
+
+	/*
+		PatchAttrs updates attributes of an object's mapping without changing its target (see patchAttrs), and returns the
+		updated mapping, or nil if the object has not mapped to any target.
+	*/
+	PatchAttrs(ctx context.Context, appId, namespace, object string, patch map[string]interface{}) (*BoMapping, error)
+
+	/*
+		MapMany is the batch version of Map: maps objects to targets as listed in 'items' (only fields Namespace, From,
+		To, Expiry and Attrs are used) with bulk writes, and returns, for each item, the object's mapping after the call.
+
+		Each item is mapped atomically but the batch is not: if an item's returned mapping points to another target than
+		the item's, the item conflicted with the existing mapping and was not applied. Items are applied in order, i.e.
+		a later item of the same object conflicts with an earlier one that maps it to another target.
+
+		Items in namespaces listed in 'uniqueNamespaces' are checked as in Map: if an item's returned mapping is of
+		another object, the item's target already has that object in the namespace (or an earlier item maps that object
+		to the target) and the item was not applied.
 	*/
-	Map(appId, namespace, object, target string) (*BoMapping, error)
+	MapMany(ctx context.Context, appId string, items []*BoMapping, uniqueNamespaces []string) ([]*BoMapping, error)
 
 	/*
 		Map removes the mapping from object to target.
 	*/
-	Unmap(appId, namespace, object, target string) (bool, error)
+	Unmap(ctx context.Context, appId, namespace, object, target string) (bool, error)
+
+	/*
+		UnmapMany is the batch version of Unmap: removes mappings listed in 'items' (only fields Namespace, From and To
+		are used) with bulk writes, and returns, for each item, whether the mapping has been removed.
+	*/
+	UnmapMany(ctx context.Context, appId string, items []*BoMapping) ([]bool, error)
+
+	/*
+		Remap atomically moves an object from its current target to another target.
+
+		    - If 'object' has not mapped to any target, Remap returns (nil, nil).
+		    - If 'expectedTarget' is not empty and 'object' currently maps to another target, Remap returns the existing
+		      mapping along with a MappingConflictError.
+		    - If 'namespace' is listed in 'uniqueNamespaces' and 'target' already has another object in it, nothing is
+		      moved and a UniqueConflictError is returned.
+		    - Otherwise the mapping is moved to 'target' and returned.
+	*/
+	Remap(ctx context.Context, appId, namespace, object, target, expectedTarget string, uniqueNamespaces []string) (*BoMapping, error)
+
+	/*
+		MergeTargets atomically repoints all objects of target 'from' (across all namespaces) to target 'into', records
+		'from' as an alias of 'into' (see target_alias.go), and returns the moved mappings.
+
+		'uniqueNamespaces' lists namespaces in which a target can have at most one object: if both targets have an object
+		in one of these namespaces, nothing is moved and a MergeConflictError is returned.
+	*/
+	MergeTargets(ctx context.Context, appId, from, into string, uniqueNamespaces []string) ([]*BoMapping, error)
+
+	/*
+		SplitTarget atomically moves the objects listed in 'mapNsObj' ({namespace: object}) from target 'from' to target
+		'into', and returns the moved mappings.
+
+		If any of the listed objects does not map to 'from', nothing is moved and a SplitConflictError is returned.
+		Objects that already map to 'into' are left untouched, so that an interrupted split can be safely re-run. If 'into'
+		already has another object in one of the namespaces listed in 'uniqueNamespaces', nothing is moved and a
+		UniqueConflictError is returned.
+	*/
+	SplitTarget(ctx context.Context, appId, from string, mapNsObj map[string]string, into string, uniqueNamespaces []string) ([]*BoMapping, error)
 
 	/*
 	   Allocate performs bulk mapping from objects to a target on multiple namespaces.
+
+	   'expiries' ({namespace: expiry}, may be nil) specifies expiry of the newly created mappings.
+
+	   If some objects have already mapped to a target, the other objects are mapped to that target: if it already has
+	   another object in one of their namespaces listed in 'uniqueNamespaces', nothing is written and a
+	   UniqueConflictError is returned. If the objects have already mapped to different targets, nothing is written and
+	   an AllocateConflictError is returned. The returned target is empty if an error is returned.
 	*/
-	Allocate(appId string, mapNsObj map[string]string, target string) (string, error)
+	Allocate(ctx context.Context, appId string, mapNsObj map[string]string, target string, expiries map[string]time.Time, uniqueNamespaces []string) (string, error)
+
+	/*
+		GetMappingHistory returns history entries of an object's mapping in a namespace (see mapping_history.go), sorted
+		by time.
+	*/
+	GetMappingHistory(ctx context.Context, appId, namespace, from string) ([]*BoMappingHistory, error)
+
+	/*
+		SweepExpired removes expired mappings of an app from storage, and returns the number of removed mappings.
+
+		Backends that expire mappings by themselves (e.g. MongoDB's TTL index) may do nothing and return 0.
+	*/
+	SweepExpired(ctx context.Context, appId string) (int, error)
+}
+
+/*
+MappingConflictError is returned by IDaoMoMapping.Map when the object has already mapped to another target.
+
+Mapping holds the existing (winning) mapping.
+*/
+type MappingConflictError struct {
+	Mapping *BoMapping
+}
+
+// Error implements error.Error
+func (e *MappingConflictError) Error() string {
+	return fmt.Sprintf("[%s] has already mapped to another target in namespace [%s].", e.Mapping.From, e.Mapping.Namespace)
+}
+
+/*
+IsMappingConflict checks if an error is a MappingConflictError, and returns the existing mapping if so.
+*/
+func IsMappingConflict(err error) (*BoMapping, bool) {
+	if e, ok := errors.Cause(err).(*MappingConflictError); ok {
+		return e.Mapping, true
+	}
+	return nil, false
+}
+
+/*
+UniqueConflictError is returned by IDaoMoMapping when a mapping would leave its target with more than one object in a
+unique namespace.
+
+Mapping holds the existing mapping of the target's other object.
+*/
+type UniqueConflictError struct {
+	Mapping *BoMapping
+}
+
+// Error implements error.Error
+func (e *UniqueConflictError) Error() string {
+	return fmt.Sprintf("Target [%s] already has object [%s] in unique namespace [%s].", e.Mapping.To, e.Mapping.From, e.Mapping.Namespace)
+}
+
+/*
+IsUniqueConflict checks if an error is a UniqueConflictError, and returns the target's existing mapping if so.
+*/
+func IsUniqueConflict(err error) (*BoMapping, bool) {
+	if e, ok := errors.Cause(err).(*UniqueConflictError); ok {
+		return e.Mapping, true
+	}
+	return nil, false
+}
+
+/*
+AllocateConflictError is returned by IDaoMoMapping.Allocate when the input objects have already mapped to different
+targets.
+*/
+type AllocateConflictError struct {
+	Targets []string
+}
+
+// Error implements error.Error
+func (e *AllocateConflictError) Error() string {
+	return fmt.Sprintf("Input objects cannot map to a same target, they have already mapped to targets [%s].", strings.Join(e.Targets, ","))
+}
+
+// newAllocateConflictError returns an AllocateConflictError on (distinct) targets 'targets', sorted.
+func newAllocateConflictError(targets ...string) *AllocateConflictError {
+	sort.Strings(targets)
+	return &AllocateConflictError{Targets: targets}
+}
+
+// uniqueNamespaceSet returns normalized 'uniqueNamespaces' as a set. Reserved namespaces are never unique.
+func uniqueNamespaceSet(uniqueNamespaces []string) map[string]bool {
+	result := map[string]bool{}
+	for _, ns := range uniqueNamespaces {
+		if ns = normalizeNamespace(ns); !isReservedNamespace(ns) {
+			result[ns] = true
+		}
+	}
+	return result
+}
+
+// checkUniqueTargets verifies that (normalized) mappings 'bos' do not leave their targets with more than one object in
+// namespaces listed in 'uniqueNamespaces'. Live mappings to a target are looked up via 'findFunc'.
+//
+// It returns a UniqueConflictError holding the mapping of a target's other object if the check fails. Backends must call
+// it inside the atomic unit that writes 'bos'.
+func checkUniqueTargets(bos []*BoMapping, uniqueNamespaces []string, findFunc func(namespace, target string) ([]*BoMapping, error)) error {
+	uniqueNs := uniqueNamespaceSet(uniqueNamespaces)
+	for _, bo := range bos {
+		if !uniqueNs[bo.Namespace] {
+			continue
+		}
+		mappings, err := findFunc(bo.Namespace, bo.To)
+		if err != nil {
+			return err
+		}
+		for _, mapping := range mappings {
+			if mapping.From != bo.From {
+				return &UniqueConflictError{Mapping: mapping}
+			}
+		}
+	}
+	return nil
+}
+
+// checkMappedTarget verifies that an existing mapping points to the same target as the requested mapping.
+// It returns the existing mapping, along with a MappingConflictError if the targets are different.
+func checkMappedTarget(existing, requested *BoMapping) (*BoMapping, error) {
+	if existing == nil {
+		return requested, nil
+	}
+	if existing.To != requested.To {
+		return existing, &MappingConflictError{Mapping: existing}
+	}
+	return existing, nil
+}
+
+// compareAndMap implements IDaoMoMapping.Map as an atomic compare-and-set on top of an "insert if not exists" primitive
+// (e.g. backed by a unique index) and a lookup of the existing mapping.
+//
+// If the existing mapping disappears between the failed insert and the lookup (e.g. unmapped concurrently, or it has
+// expired), the insert is attempted again. 'getFunc' must not return expired mappings; 'purgeFunc' removes the stored
+// mapping if it has expired, so that it does not block the insert.
+func compareAndMap(ctx context.Context, bo *BoMapping, insertFunc func() (bool, error), getFunc func() (*BoMapping, error), purgeFunc func() error) (*BoMapping, error) {
+	for {
+		inserted, err := insertFunc()
+		if err != nil {
+			return nil, err
+		}
+		if inserted {
+			return bo, nil
+		}
+		existing, err := getFunc()
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return checkMappedTarget(existing, bo)
+		}
+		if err := purgeFunc(); err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// normalizeBatchItems returns normalized copies of items of MapMany/UnmapMany, stamped with app id and time.
+func normalizeBatchItems(appId string, items []*BoMapping, t time.Time) []*BoMapping {
+	result := make([]*BoMapping, len(items))
+	for i, item := range items {
+		result[i] = &BoMapping{
+			Namespace: normalizeNamespace(item.Namespace),
+			From:      item.From,
+			To:        normalizeMappingTarget(item.To),
+			Time:      t,
+			AppId:     appId,
+			Expiry:    item.Expiry,
+			Attrs:     patchAttrs(nil, item.Attrs),
+		}
+	}
+	return result
+}
+
+// batchKey identifies the object of a (normalized) mapping within a batch.
+func batchKey(bo *BoMapping) string {
+	return bo.Namespace + "\x00" + bo.From
+}
+
+// batchMap implements IDaoMoMapping.MapMany on top of a bulk "insert if not exists" primitive and a bulk lookup of
+// existing mappings, the batch version of compareAndMap.
+//
+// 'items' must be normalized. 'insertFunc' is given mappings of distinct objects and returns keys (see batchKey) of the
+// inserted ones; it must replace expired mappings. 'fetchFunc' returns the live mappings of the given objects.
+func batchMap(ctx context.Context, items []*BoMapping, insertFunc func(bos []*BoMapping) (map[string]bool, error), fetchFunc func(bos []*BoMapping) ([]*BoMapping, error)) ([]*BoMapping, error) {
+	mappings := make(map[string]*BoMapping)
+	pending := make([]*BoMapping, 0, len(items))
+	seen := make(map[string]bool)
+	for _, bo := range items {
+		if key := batchKey(bo); !seen[key] {
+			seen[key] = true
+			pending = append(pending, bo)
+		}
+	}
+	for len(pending) > 0 {
+		inserted, err := insertFunc(pending)
+		if err != nil {
+			return nil, err
+		}
+		notInserted := make([]*BoMapping, 0)
+		for _, bo := range pending {
+			if inserted[batchKey(bo)] {
+				mappings[batchKey(bo)] = bo
+			} else {
+				notInserted = append(notInserted, bo)
+			}
+		}
+		if len(notInserted) == 0 {
+			break
+		}
+		existing, err := fetchFunc(notInserted)
+		if err != nil {
+			return nil, err
+		}
+		for _, bo := range existing {
+			mappings[batchKey(bo)] = bo
+		}
+		// existing mappings that disappeared in the meantime: attempt to insert again
+		pending = pending[:0]
+		for _, bo := range notInserted {
+			if mappings[batchKey(bo)] == nil {
+				pending = append(pending, bo)
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	result := make([]*BoMapping, len(items))
+	for i, bo := range items {
+		result[i] = mappings[batchKey(bo)]
+	}
+	return result, nil
+}
+
+// mapManyUnique implements the uniqueness check of IDaoMoMapping.MapMany on top of 'mapFunc' that maps (normalized)
+// items without checking. Live mappings to a target are looked up via 'findFunc'.
+//
+// Items violating uniqueness of 'uniqueNamespaces' are not given to 'mapFunc', the mapping of their target's other
+// object is returned for them instead. Backends must call it inside the atomic unit that writes the items.
+func mapManyUnique(items []*BoMapping, uniqueNamespaces []string, findFunc func(namespace, target string) ([]*BoMapping, error), mapFunc func(bos []*BoMapping) ([]*BoMapping, error)) ([]*BoMapping, error) {
+	uniqueNs := uniqueNamespaceSet(uniqueNamespaces)
+	result := make([]*BoMapping, len(items))
+	toMap, indexes := make([]*BoMapping, 0, len(items)), make([]int, 0, len(items))
+	owners := make(map[string]*BoMapping) // {namespace+target: mapping of the target's object}
+	for i, bo := range items {
+		if uniqueNs[bo.Namespace] {
+			key := bo.Namespace + "\x00" + bo.To
+			owner, ok := owners[key]
+			if !ok {
+				mappings, err := findFunc(bo.Namespace, bo.To)
+				if err != nil {
+					return nil, err
+				}
+				for _, mapping := range mappings {
+					if owner == nil || mapping.From == bo.From {
+						owner = mapping
+					}
+				}
+			}
+			if owner != nil && owner.From != bo.From {
+				result[i] = owner
+				continue
+			}
+			if owner == nil {
+				owner = bo
+			}
+			owners[key] = owner
+		}
+		toMap, indexes = append(toMap, bo), append(indexes, i)
+	}
+	if len(toMap) > 0 {
+		mapped, err := mapFunc(toMap)
+		if err != nil {
+			return nil, err
+		}
+		for j, mapping := range mapped {
+			result[indexes[j]] = mapping
+		}
+	}
+	return result, nil
+}
+
+// compareAndRemap implements IDaoMoMapping.Remap as a compare-and-set loop on top of a lookup of the existing mapping
+// and an "update target if it is still 'currentTarget'" primitive.
+//
+// 'bo' and 'expectedTarget' must be normalized. The moved mapping keeps expiry and attributes of the existing mapping.
+func compareAndRemap(ctx context.Context, bo *BoMapping, expectedTarget string, getFunc func() (*BoMapping, error), updateFunc func(currentTarget string) (bool, error)) (*BoMapping, error) {
+	for {
+		existing, err := getFunc()
+		if err != nil || existing == nil {
+			return nil, err
+		}
+		if expectedTarget != "" && existing.To != expectedTarget {
+			return existing, &MappingConflictError{Mapping: existing}
+		}
+		if existing.To == bo.To {
+			return existing, nil
+		}
+		bo.Expiry, bo.Attrs = existing.Expiry, existing.Attrs
+		updated, err := updateFunc(existing.To)
+		if err != nil {
+			return nil, err
+		}
+		if updated {
+			return bo, nil
+		}
+		// mapping has been modified concurrently, try again
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+/*
+MergeConflictError is returned by IDaoMoMapping.MergeTargets when merging would leave the surviving target with more
+than one object in a unique namespace.
+*/
+type MergeConflictError struct {
+	Namespaces []string
+}
+
+// Error implements error.Error
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("Both targets have objects in unique namespace(s) [%s].", strings.Join(e.Namespaces, ","))
+}
+
+// planMergeTargets calculates the mappings resulted from repointing 'fromMappings' to target 'into', or returns a
+// MergeConflictError if the merge would violate 'uniqueNamespaces'.
+//
+// Result is sorted by namespace and object.
+func planMergeTargets(fromMappings, intoMappings []*BoMapping, into string, uniqueNamespaces []string) ([]*BoMapping, error) {
+	uniqueNs := uniqueNamespaceSet(uniqueNamespaces)
+	intoNs := map[string]bool{}
+	for _, bo := range intoMappings {
+		intoNs[bo.Namespace] = true
+	}
+	conflictNs := map[string]bool{}
+	now := time.Now()
+	result := make([]*BoMapping, 0, len(fromMappings))
+	for _, bo := range fromMappings {
+		if uniqueNs[bo.Namespace] && intoNs[bo.Namespace] {
+			conflictNs[bo.Namespace] = true
+		}
+		moved := *bo
+		moved.To = into
+		moved.Time = now
+		result = append(result, &moved)
+	}
+	if len(conflictNs) > 0 {
+		namespaces := make([]string, 0, len(conflictNs))
+		for ns := range conflictNs {
+			namespaces = append(namespaces, ns)
+		}
+		sort.Strings(namespaces)
+		return nil, &MergeConflictError{Namespaces: namespaces}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].From < result[j].From
+	})
+	return result, nil
+}
+
+/*
+SplitConflictError is returned by IDaoMoMapping.SplitTarget when some of the objects to be moved do not map to the
+target being split.
+*/
+type SplitConflictError struct {
+	Namespaces []string
+}
+
+// Error implements error.Error
+func (e *SplitConflictError) Error() string {
+	return fmt.Sprintf("Object(s) in namespace(s) [%s] do not map to the target being split.", strings.Join(e.Namespaces, ","))
+}
+
+// planSplitTarget calculates the mappings resulted from moving objects listed in 'mapNsObj' from target 'from' to
+// target 'into', or returns a SplitConflictError if some objects do not map to 'from'. Existing mappings are looked up
+// via 'getFunc', live mappings to a target via 'findFunc'.
+//
+// A UniqueConflictError is returned if the split would leave 'into' with more than one object in a namespace listed in
+// 'uniqueNamespaces' (see checkUniqueTargets).
+//
+// Objects already mapping to 'into' are not included in the result. Result is sorted by namespace and object.
+func planSplitTarget(appId, from string, mapNsObj map[string]string, into string, uniqueNamespaces []string, getFunc func(namespace, object string) (*BoMapping, error), findFunc func(namespace, target string) ([]*BoMapping, error)) ([]*BoMapping, error) {
+	var conflictNs []string
+	now := time.Now()
+	result := make([]*BoMapping, 0, len(mapNsObj))
+	for ns, obj := range mapNsObj {
+		ns = normalizeNamespace(ns)
+		existing, err := getFunc(ns, obj)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case existing != nil && existing.To == into:
+			continue
+		case existing == nil || existing.To != from:
+			conflictNs = append(conflictNs, ns)
+		default:
+			result = append(result, &BoMapping{Namespace: ns, From: obj, To: into, Time: now, AppId: appId, Expiry: existing.Expiry, Attrs: existing.Attrs})
+		}
+	}
+	if len(conflictNs) > 0 {
+		sort.Strings(conflictNs)
+		return nil, &SplitConflictError{Namespaces: conflictNs}
+	}
+	if err := checkUniqueTargets(result, uniqueNamespaces, findFunc); err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].From < result[j].From
+	})
+	return result, nil
 }
 
 /*----------------------------------------------------------------------*/
@@ -109,6 +711,7 @@ const (
 	fieldAppSecret = "sec"
 	fieldAppTime   = "t"
 	fieldAppConfig = "cfg"
+	fieldAppNsr    = "nsr"
 )
 
 var (
@@ -123,6 +726,9 @@ type BoApp struct {
 	Secret string                 `json:"sec"`
 	Time   time.Time              `json:"t"`
 	Config map[string]interface{} `json:"cfg"`
+
+	// Namespaces is the app's namespace registry, nil if the app has not declared any namespace.
+	Namespaces *BoNamespaceRegistry `json:"nsr,omitempty"`
 }
 
 func (bo *BoApp) Clone() *BoApp {
@@ -175,5 +781,48 @@ func initData(dbtype string) error {
 		}
 		return nil
 	}
+	if strings.EqualFold("pgsql", dbtype) || strings.EqualFold("postgres", dbtype) || strings.EqualFold("postgresql", dbtype) {
+		for _, sqlStm := range pgsqlAppTableStms {
+			if _, err := sqlConnect.GetDB().Exec(fmt.Sprintf(sqlStm, tableApps)); err != nil {
+				log.Printf("Error while creating table [%s]: %e", tableApps, err)
+				return err
+			}
+		}
+		return nil
+	}
+	if strings.EqualFold("embedded", dbtype) || strings.EqualFold("bolt", dbtype) || strings.EqualFold("boltdb", dbtype) {
+		return boltDb.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte(bucketApps))
+			return err
+		})
+	}
+	if strings.EqualFold("memory", dbtype) || strings.EqualFold("inmem", dbtype) {
+		// nothing to initialize
+		return nil
+	}
 	return errors.Errorf("Unknown database type: [%s].", dbtype)
 }
+
+// splitTranslation separates the mapping of an object from the mappings in the target namespaces, for backends fetching
+// them with a single query.
+func splitTranslation(namespace, from string, targetNamespaces []string, mappings []*BoMapping) (*BoMapping, []*BoMapping) {
+	namespace = normalizeNamespace(namespace)
+	isTarget := make(map[string]bool)
+	for _, ns := range targetNamespaces {
+		isTarget[normalizeNamespace(ns)] = true
+	}
+	var mapping *BoMapping
+	result := make([]*BoMapping, 0)
+	for _, bo := range mappings {
+		if bo.Namespace == namespace && bo.From == from {
+			mapping = bo
+		}
+		if isTarget[bo.Namespace] {
+			result = append(result, bo)
+		}
+	}
+	if mapping == nil {
+		return nil, make([]*BoMapping, 0)
+	}
+	return mapping, result
+}
@@ -0,0 +1,1143 @@
+package mom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"log"
+	"main/src/goems"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+MOM's DAO implementation: embedded single-file storage (BoltDB)
+
+@author Thanh Nguyen <btnguyen2k@gmail.com>
+@since 0.1.0
+*/
+
+const (
+	bucketApps        = "apps"
+	bucketTemplateMom = "${bucket}_${app}"
+	baseBucketMom     = "mom"
+
+	// sub-buckets of an app's mapping bucket
+	bucketForward = "f" // key: namespace+sep+object, value: mapping as JSON
+	bucketReverse = "r" // key: namespace+sep+target+sep+object, value: empty
+	bucketByTime  = "t" // key: namespace+sep+target+sep+time+sep+object, value: expiry (empty if none), see boltTimeKey
+	bucketHistory = "h" // key: namespace+sep+object+sep+sequence, value: history entry as JSON
+
+	boltKeySeparator = "\x00"
+)
+
+// open the embedded database file
+func createBoltConnect() *bolt.DB {
+	path := goems.AppConfig.GetString("mom.embedded.path", "./data/mom.db")
+	timeoutMs := goems.AppConfig.GetInt32("mom.embedded.timeout", 10000)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		log.Println(err)
+		panic("error creating directory for embedded database [" + path + "]")
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Duration(timeoutMs) * time.Millisecond})
+	if db == nil || err != nil {
+		if err != nil {
+			log.Println(err)
+		}
+		panic("error opening embedded database [" + path + "]")
+	}
+	return db
+}
+
+func boltKey(parts ...string) []byte {
+	return []byte(strings.Join(parts, boltKeySeparator))
+}
+
+// boltTimeKey encodes a timestamp as a fixed-length string, so that encoded timestamps sort by time.
+func boltTimeKey(t time.Time) string {
+	return fmt.Sprintf("%016x", uint64(t.UnixNano()))
+}
+
+// boltByTimeEntry returns key and value of a mapping in the reverse-by-time index.
+func boltByTimeEntry(bo *BoMapping) ([]byte, []byte) {
+	key := boltKey(bo.Namespace, bo.To, boltTimeKey(bo.Time), bo.From)
+	if bo.Expiry == nil {
+		return key, []byte{}
+	}
+	return key, []byte(boltTimeKey(*bo.Expiry))
+}
+
+// boltIsExpired checks if a value of the reverse-by-time index is the expiry of an expired mapping, 'now' is encoded by
+// boltTimeKey.
+func boltIsExpired(value []byte, now string) bool {
+	return len(value) > 0 && string(value) <= now
+}
+
+func NewBoltDaoMoMapping(db *bolt.DB, baseBucketName string) IDaoMoMapping {
+	return &BoltDaoMoMapping{db: db, baseBucketName: baseBucketName}
+}
+
+/*
+BoltDaoMoMapping is BoltDB implementation of IDaoMoMapping.
+
+Each app's mappings are stored in a separated bucket, which has 4 sub-buckets: forward index {namespace, object} -> mapping,
+reverse index {namespace, target, object}, reverse-by-time index {namespace, target, time, object} -> expiry (for
+paginated reverse lookups and counting) and mapping history {namespace, object, sequence} -> history entry.
+*/
+type BoltDaoMoMapping struct {
+	db             *bolt.DB
+	baseBucketName string // name of bucket to store data (or base name if bucket-per-app)
+}
+
+func (dao *BoltDaoMoMapping) calcBucketName(appId string) []byte {
+	bucketName := strings.ReplaceAll(bucketTemplateMom, "${bucket}", dao.baseBucketName)
+	bucketName = strings.ReplaceAll(bucketName, "${app}", strings.ToLower(appId))
+	return []byte(bucketName)
+}
+
+// getBuckets returns forward and reverse buckets of an app, creating them if tx is writable.
+func (dao *BoltDaoMoMapping) getBuckets(tx *bolt.Tx, appId string) (*bolt.Bucket, *bolt.Bucket, error) {
+	bucketName := dao.calcBucketName(appId)
+	if !tx.Writable() {
+		bucket := tx.Bucket(bucketName)
+		if bucket == nil {
+			return nil, nil, nil
+		}
+		return bucket.Bucket([]byte(bucketForward)), bucket.Bucket([]byte(bucketReverse)), nil
+	}
+	bucket, err := tx.CreateBucketIfNotExists(bucketName)
+	if err != nil {
+		return nil, nil, err
+	}
+	forward, err := bucket.CreateBucketIfNotExists([]byte(bucketForward))
+	if err != nil {
+		return nil, nil, err
+	}
+	reverse, err := bucket.CreateBucketIfNotExists([]byte(bucketReverse))
+	return forward, reverse, err
+}
+
+// getByTimeBucket returns the reverse-by-time index of an app, creating it if tx is writable.
+//
+// Databases created by older versions do not have this index: it is built from the forward index by the first write
+// transaction of the app. Until then, nil is returned to read-only transactions, which fall back to the reverse index.
+func (dao *BoltDaoMoMapping) getByTimeBucket(tx *bolt.Tx, appId string) (*bolt.Bucket, error) {
+	bucketName := dao.calcBucketName(appId)
+	if !tx.Writable() {
+		bucket := tx.Bucket(bucketName)
+		if bucket == nil {
+			return nil, nil
+		}
+		return bucket.Bucket([]byte(bucketByTime)), nil
+	}
+	forward, _, err := dao.getBuckets(tx, appId)
+	if err != nil {
+		return nil, err
+	}
+	bucket := tx.Bucket(bucketName)
+	if byTime := bucket.Bucket([]byte(bucketByTime)); byTime != nil {
+		return byTime, nil
+	}
+	byTime, err := bucket.CreateBucket([]byte(bucketByTime))
+	if err != nil {
+		return nil, err
+	}
+	err = forward.ForEach(func(_, data []byte) error {
+		bo := &BoMapping{}
+		if err := json.Unmarshal(data, bo); err != nil {
+			return err
+		}
+		key, value := boltByTimeEntry(bo)
+		return byTime.Put(key, value)
+	})
+	return byTime, err
+}
+
+// getHistoryBucket returns the mapping history bucket of an app, creating it if tx is writable.
+func (dao *BoltDaoMoMapping) getHistoryBucket(tx *bolt.Tx, appId string) (*bolt.Bucket, error) {
+	bucketName := dao.calcBucketName(appId)
+	if !tx.Writable() {
+		bucket := tx.Bucket(bucketName)
+		if bucket == nil {
+			return nil, nil
+		}
+		return bucket.Bucket([]byte(bucketHistory)), nil
+	}
+	bucket, err := tx.CreateBucketIfNotExists(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	return bucket.CreateBucketIfNotExists([]byte(bucketHistory))
+}
+
+// update runs 'fn' inside a read-write transaction, unless 'ctx' is done when the transaction starts.
+//
+// BoltDB is not context-aware; 'ctx' is checked once the (exclusive) write lock has been acquired so that a cancelled
+// request does not modify data.
+func (dao *BoltDaoMoMapping) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	return dao.db.Update(func(tx *bolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// view runs 'fn' inside a read-only transaction, unless 'ctx' is done when the transaction starts.
+func (dao *BoltDaoMoMapping) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	return dao.db.View(func(tx *bolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+/*
+InitStorage implements IDaoMoMapping.InitStorage
+*/
+func (dao *BoltDaoMoMapping) InitStorage(ctx context.Context, appId string) error {
+	return dao.update(ctx, func(tx *bolt.Tx) error {
+		_, err := dao.getByTimeBucket(tx, appId)
+		return err
+	})
+}
+
+/*
+DestroyStorage implements IDaoMoMapping.DestroyStorage
+*/
+func (dao *BoltDaoMoMapping) DestroyStorage(ctx context.Context, appId string) error {
+	return dao.update(ctx, func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket(dao.calcBucketName(appId))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// doGetMapping returns the mapping of an object, or nil if the object has not mapped to any target or the mapping has
+// expired.
+func (dao *BoltDaoMoMapping) doGetMapping(tx *bolt.Tx, appId, namespace, from string) (*BoMapping, error) {
+	forward, _, err := dao.getBuckets(tx, appId)
+	if forward == nil || err != nil {
+		return nil, err
+	}
+	data := forward.Get(boltKey(normalizeNamespace(namespace), from))
+	if data == nil {
+		return nil, nil
+	}
+	bo := &BoMapping{}
+	if err := json.Unmarshal(data, bo); err != nil {
+		return nil, err
+	}
+	return liveMapping(bo), nil
+}
+
+/*
+FindTargetForObject implements IDaoMoMapping.FindTargetForObject
+*/
+func (dao *BoltDaoMoMapping) FindTargetForObject(ctx context.Context, appId, namespace, from string) (*BoMapping, error) {
+	var result *BoMapping
+	err := dao.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		result, err = dao.doGetMapping(tx, appId, namespace, from)
+		return err
+	})
+	return result, err
+}
+
+/*
+FindTargetsForObjects implements IDaoMoMapping.FindTargetsForObjects
+*/
+func (dao *BoltDaoMoMapping) FindTargetsForObjects(ctx context.Context, appId, namespace string, objects []string) ([]*BoMapping, error) {
+	result := make([]*BoMapping, 0)
+	err := dao.view(ctx, func(tx *bolt.Tx) error {
+		for _, from := range objects {
+			bo, err := dao.doGetMapping(tx, appId, namespace, from)
+			if err != nil {
+				return err
+			}
+			if bo != nil {
+				result = append(result, bo)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (dao *BoltDaoMoMapping) doGetReversedMappings(tx *bolt.Tx, appId, namespace, to string) ([]*BoMapping, error) {
+	result := make([]*BoMapping, 0)
+	forward, reverse, err := dao.getBuckets(tx, appId)
+	if reverse == nil || err != nil {
+		return result, err
+	}
+	namespace = normalizeNamespace(namespace)
+	prefix := boltKey(namespace, normalizeMappingTarget(to), "")
+	cursor := reverse.Cursor()
+	for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+		from := string(k[len(prefix):])
+		data := forward.Get(boltKey(namespace, from))
+		if data == nil {
+			continue
+		}
+		bo := &BoMapping{}
+		if err := json.Unmarshal(data, bo); err != nil {
+			return nil, err
+		}
+		result = append(result, bo)
+	}
+	return liveMappings(result), nil
+}
+
+// targetFinder returns the function looking up live mappings to a target within a transaction, for checkUniqueTargets.
+func (dao *BoltDaoMoMapping) targetFinder(tx *bolt.Tx, appId string) func(namespace, target string) ([]*BoMapping, error) {
+	return func(namespace, target string) ([]*BoMapping, error) {
+		return dao.doGetReversedMappings(tx, appId, namespace, target)
+	}
+}
+
+/*
+FindObjectsToTarget implements IDaoMoMapping.FindObjectsToTarget
+*/
+func (dao *BoltDaoMoMapping) FindObjectsToTarget(ctx context.Context, appId, namespace, to string) ([]*BoMapping, error) {
+	var result []*BoMapping
+	err := dao.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		result, err = dao.doGetReversedMappings(tx, appId, namespace, to)
+		return err
+	})
+	return result, err
+}
+
+// doGetReversedMappingsPage returns a page of mappings to a target, seeking the reverse-by-time index with a cursor.
+func (dao *BoltDaoMoMapping) doGetReversedMappingsPage(tx *bolt.Tx, byTime *bolt.Bucket, appId, namespace, to string, page PageRequest) ([]*BoMapping, error) {
+	result := make([]*BoMapping, 0)
+	forward, _, err := dao.getBuckets(tx, appId)
+	if forward == nil || err != nil {
+		return result, err
+	}
+	prefix := boltKey(namespace, to, "")
+	cursor := byTime.Cursor()
+	next := cursor.Next
+	if page.Desc {
+		next = cursor.Prev
+	}
+	var k, v []byte
+	switch {
+	case page.After != nil:
+		position := append(append([]byte{}, prefix...), boltKey(boltTimeKey(page.After.Time), page.After.From)...)
+		k, v = cursor.Seek(position)
+		if page.Desc {
+			// Seek lands on the first key >= position, the page starts right before it
+			if k == nil {
+				k, v = cursor.Last()
+			} else {
+				k, v = cursor.Prev()
+			}
+		} else if bytes.Equal(k, position) {
+			k, v = cursor.Next()
+		}
+	case page.Desc:
+		// the separator is the smallest byte, hence the first key after all keys of the target is target+(separator+1)
+		if k, v = cursor.Seek(append(boltKey(namespace, to), boltKeySeparator[0]+1)); k == nil {
+			k, v = cursor.Last()
+		} else {
+			k, v = cursor.Prev()
+		}
+	default:
+		k, v = cursor.Seek(prefix)
+	}
+	now := boltTimeKey(time.Now())
+	for ; k != nil && bytes.HasPrefix(k, prefix) && (page.Limit <= 0 || len(result) < page.Limit); k, v = next() {
+		if boltIsExpired(v, now) {
+			continue
+		}
+		tokens := strings.SplitN(string(k[len(prefix):]), boltKeySeparator, 2)
+		data := forward.Get(boltKey(namespace, tokens[len(tokens)-1]))
+		if data == nil {
+			continue
+		}
+		bo := &BoMapping{}
+		if err := json.Unmarshal(data, bo); err != nil {
+			return nil, err
+		}
+		result = append(result, bo)
+	}
+	return result, nil
+}
+
+/*
+FindObjectsToTargetPage implements IDaoMoMapping.FindObjectsToTargetPage
+*/
+func (dao *BoltDaoMoMapping) FindObjectsToTargetPage(ctx context.Context, appId, namespace, to string, page PageRequest) ([]*BoMapping, error) {
+	var result []*BoMapping
+	err := dao.view(ctx, func(tx *bolt.Tx) error {
+		byTime, err := dao.getByTimeBucket(tx, appId)
+		if err != nil {
+			return err
+		}
+		if byTime == nil {
+			// the index has not been built yet, all mappings of the target are loaded to be sorted by time
+			mappings, err := dao.doGetReversedMappings(tx, appId, namespace, to)
+			if err == nil {
+				result = pageMappings(mappings, page)
+			}
+			return err
+		}
+		result, err = dao.doGetReversedMappingsPage(tx, byTime, appId, normalizeNamespace(namespace), normalizeMappingTarget(to), page)
+		return err
+	})
+	return result, err
+}
+
+/*
+TranslateObject implements IDaoMoMapping.TranslateObject
+*/
+func (dao *BoltDaoMoMapping) TranslateObject(ctx context.Context, appId, namespace, from string, targetNamespaces []string) (*BoMapping, []*BoMapping, error) {
+	var mapping *BoMapping
+	result := make([]*BoMapping, 0)
+	err := dao.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		if mapping, err = dao.doGetMapping(tx, appId, namespace, from); mapping == nil || err != nil {
+			return err
+		}
+		for _, ns := range targetNamespaces {
+			mappings, err := dao.doGetReversedMappings(tx, appId, ns, mapping.To)
+			if err != nil {
+				return err
+			}
+			result = append(result, mappings...)
+		}
+		return nil
+	})
+	return mapping, result, err
+}
+
+/*
+CountObjectsToTarget implements IDaoMoMapping.CountObjectsToTarget
+
+Mappings are counted by scanning keys of the reverse-by-time index, whose values hold expiries: no mapping is decoded.
+*/
+func (dao *BoltDaoMoMapping) CountObjectsToTarget(ctx context.Context, appId, namespace, to string) (int, error) {
+	result := 0
+	err := dao.view(ctx, func(tx *bolt.Tx) error {
+		byTime, err := dao.getByTimeBucket(tx, appId)
+		if err != nil {
+			return err
+		}
+		if byTime == nil {
+			// the index has not been built yet
+			mappings, err := dao.doGetReversedMappings(tx, appId, namespace, to)
+			result = len(mappings)
+			return err
+		}
+		now := boltTimeKey(time.Now())
+		prefix := boltKey(normalizeNamespace(namespace), normalizeMappingTarget(to), "")
+		cursor := byTime.Cursor()
+		for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			if !boltIsExpired(v, now) {
+				result++
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+/*
+HasObjects implements IDaoMoMapping.HasObjects
+*/
+func (dao *BoltDaoMoMapping) HasObjects(ctx context.Context, appId, namespace string) (bool, error) {
+	result := false
+	err := dao.view(ctx, func(tx *bolt.Tx) error {
+		forward, _, err := dao.getBuckets(tx, appId)
+		if forward == nil || err != nil {
+			return err
+		}
+		now := time.Now()
+		prefix := boltKey(normalizeNamespace(namespace), "")
+		c := forward.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			bo := &BoMapping{}
+			if err := json.Unmarshal(v, bo); err != nil {
+				return err
+			}
+			if !bo.isExpired(now) {
+				result = true
+				return nil
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (dao *BoltDaoMoMapping) doInsert(tx *bolt.Tx, bo *BoMapping) (bool, error) {
+	forward, reverse, err := dao.getBuckets(tx, bo.AppId)
+	if err != nil {
+		return false, err
+	}
+	byTime, err := dao.getByTimeBucket(tx, bo.AppId)
+	if err != nil {
+		return false, err
+	}
+	key := boltKey(bo.Namespace, bo.From)
+	if data := forward.Get(key); data != nil {
+		existing := &BoMapping{}
+		if err := json.Unmarshal(data, existing); err != nil {
+			return false, err
+		}
+		if !existing.isExpired(time.Now()) {
+			return false, nil
+		}
+		// expired mapping does not block the insert
+		if err := dao.doRemove(forward, reverse, byTime, existing); err != nil {
+			return false, err
+		}
+	}
+	data, err := json.Marshal(bo)
+	if err != nil {
+		return false, err
+	}
+	if err := forward.Put(key, data); err != nil {
+		return false, err
+	}
+	if err := reverse.Put(boltKey(bo.Namespace, bo.To, bo.From), []byte{}); err != nil {
+		return false, err
+	}
+	byTimeKey, byTimeValue := boltByTimeEntry(bo)
+	return true, byTime.Put(byTimeKey, byTimeValue)
+}
+
+// doUpsert inserts a mapping, replacing the existing one (if any).
+func (dao *BoltDaoMoMapping) doUpsert(tx *bolt.Tx, bo *BoMapping) error {
+	existing, err := dao.doGetMapping(tx, bo.AppId, bo.Namespace, bo.From)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if _, err := dao.doDelete(tx, existing); err != nil {
+			return err
+		}
+	}
+	_, err = dao.doInsert(tx, bo)
+	return err
+}
+
+// doRecordHistory appends a history entry for a change of a mapping.
+func (dao *BoltDaoMoMapping) doRecordHistory(tx *bolt.Tx, op string, bo *BoMapping, prevTo string) error {
+	entry := newMappingHistory(op, bo, prevTo)
+	if entry == nil {
+		return nil
+	}
+	history, err := dao.getHistoryBucket(tx, bo.AppId)
+	if err != nil {
+		return err
+	}
+	seq, err := history.NextSequence()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return history.Put(boltKey(entry.Namespace, entry.From, fmt.Sprintf("%016x", seq)), data)
+}
+
+/*
+Map implements IDaoMoMapping.Map
+*/
+func (dao *BoltDaoMoMapping) Map(ctx context.Context, appId, namespace, object, target string, expiry *time.Time, attrs map[string]interface{}, uniqueNamespaces []string) (*BoMapping, error) {
+	bo := &BoMapping{
+		Namespace: normalizeNamespace(namespace),
+		From:      object,
+		To:        normalizeMappingTarget(target),
+		Time:      time.Now(),
+		AppId:     appId,
+		Expiry:    expiry,
+		Attrs:     patchAttrs(nil, attrs),
+	}
+	var existing *BoMapping
+	err := dao.update(ctx, func(tx *bolt.Tx) error {
+		inserted, err := dao.doInsert(tx, bo)
+		if err != nil || inserted {
+			existing = bo
+			if inserted {
+				// the transaction is rolled back if the check fails
+				if err = checkUniqueTargets([]*BoMapping{bo}, uniqueNamespaces, dao.targetFinder(tx, appId)); err == nil {
+					err = dao.doRecordHistory(tx, historyOpMap, bo, "")
+				}
+			}
+			return err
+		}
+		existing, err = dao.doGetMapping(tx, appId, namespace, object)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return checkMappedTarget(existing, bo)
+}
+
+/*
+MapMany implements IDaoMoMapping.MapMany
+*/
+func (dao *BoltDaoMoMapping) MapMany(ctx context.Context, appId string, items []*BoMapping, uniqueNamespaces []string) ([]*BoMapping, error) {
+	var result []*BoMapping
+	err := dao.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		result, err = mapManyUnique(normalizeBatchItems(appId, items, time.Now()), uniqueNamespaces, dao.targetFinder(tx, appId),
+			func(bos []*BoMapping) ([]*BoMapping, error) {
+				mapped := make([]*BoMapping, len(bos))
+				for i, bo := range bos {
+					inserted, err := dao.doInsert(tx, bo)
+					if err != nil {
+						return nil, err
+					}
+					if inserted {
+						mapped[i] = bo
+						err = dao.doRecordHistory(tx, historyOpMap, bo, "")
+					} else {
+						mapped[i], err = dao.doGetMapping(tx, appId, bo.Namespace, bo.From)
+					}
+					if err != nil {
+						return nil, err
+					}
+				}
+				return mapped, nil
+			})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+PatchAttrs implements IDaoMoMapping.PatchAttrs
+*/
+func (dao *BoltDaoMoMapping) PatchAttrs(ctx context.Context, appId, namespace, object string, patch map[string]interface{}) (*BoMapping, error) {
+	var result *BoMapping
+	err := dao.update(ctx, func(tx *bolt.Tx) error {
+		existing, err := dao.doGetMapping(tx, appId, namespace, object)
+		if existing == nil || err != nil {
+			return err
+		}
+		existing.Attrs = patchAttrs(existing.Attrs, patch)
+		forward, _, err := dao.getBuckets(tx, appId)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(existing)
+		if err != nil {
+			return err
+		}
+		result = existing
+		return forward.Put(boltKey(existing.Namespace, existing.From), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (dao *BoltDaoMoMapping) doDelete(tx *bolt.Tx, bo *BoMapping) (bool, error) {
+	existing, err := dao.doGetMapping(tx, bo.AppId, bo.Namespace, bo.From)
+	if existing == nil || err != nil || existing.To != bo.To {
+		return false, err
+	}
+	forward, reverse, err := dao.getBuckets(tx, bo.AppId)
+	if err != nil {
+		return false, err
+	}
+	byTime, err := dao.getByTimeBucket(tx, bo.AppId)
+	if err != nil {
+		return false, err
+	}
+	// the stored mapping holds the time that keys the reverse-by-time index
+	return true, dao.doRemove(forward, reverse, byTime, existing)
+}
+
+// doRemove removes a mapping from forward, reverse and reverse-by-time indexes unconditionally.
+func (dao *BoltDaoMoMapping) doRemove(forward, reverse, byTime *bolt.Bucket, bo *BoMapping) error {
+	if err := forward.Delete(boltKey(bo.Namespace, bo.From)); err != nil {
+		return err
+	}
+	if err := reverse.Delete(boltKey(bo.Namespace, bo.To, bo.From)); err != nil {
+		return err
+	}
+	byTimeKey, _ := boltByTimeEntry(bo)
+	return byTime.Delete(byTimeKey)
+}
+
+/*
+Unmap implements IDaoMoMapping.Unmap
+*/
+func (dao *BoltDaoMoMapping) Unmap(ctx context.Context, appId, namespace, object, target string) (bool, error) {
+	bo := &BoMapping{
+		Namespace: normalizeNamespace(namespace),
+		From:      object,
+		To:        normalizeMappingTarget(target),
+		AppId:     appId,
+	}
+	var result bool
+	err := dao.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		if result, err = dao.doDelete(tx, bo); err != nil || !result {
+			return err
+		}
+		return dao.doRecordHistory(tx, historyOpUnmap, bo, bo.To)
+	})
+	return result, err
+}
+
+/*
+UnmapMany implements IDaoMoMapping.UnmapMany
+*/
+func (dao *BoltDaoMoMapping) UnmapMany(ctx context.Context, appId string, items []*BoMapping) ([]bool, error) {
+	result := make([]bool, len(items))
+	err := dao.update(ctx, func(tx *bolt.Tx) error {
+		for i, bo := range normalizeBatchItems(appId, items, time.Time{}) {
+			deleted, err := dao.doDelete(tx, bo)
+			if err == nil && deleted {
+				result[i] = true
+				err = dao.doRecordHistory(tx, historyOpUnmap, bo, bo.To)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+Remap implements IDaoMoMapping.Remap
+*/
+func (dao *BoltDaoMoMapping) Remap(ctx context.Context, appId, namespace, object, target, expectedTarget string, uniqueNamespaces []string) (*BoMapping, error) {
+	bo := &BoMapping{
+		Namespace: normalizeNamespace(namespace),
+		From:      object,
+		To:        normalizeMappingTarget(target),
+		Time:      time.Now(),
+		AppId:     appId,
+	}
+	if expectedTarget != "" {
+		expectedTarget = normalizeMappingTarget(expectedTarget)
+	}
+	var result *BoMapping
+	var conflictErr error
+	err := dao.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		result, err = compareAndRemap(ctx, bo, expectedTarget,
+			func() (*BoMapping, error) { return dao.doGetMapping(tx, appId, bo.Namespace, bo.From) },
+			func(currentTarget string) (bool, error) {
+				if err := checkUniqueTargets([]*BoMapping{bo}, uniqueNamespaces, dao.targetFinder(tx, appId)); err != nil {
+					return false, err
+				}
+				current := &BoMapping{Namespace: bo.Namespace, From: bo.From, To: currentTarget, AppId: appId}
+				if _, err := dao.doDelete(tx, current); err != nil {
+					return false, err
+				}
+				if inserted, err := dao.doInsert(tx, bo); err != nil || !inserted {
+					return inserted, err
+				}
+				return true, dao.doRecordHistory(tx, historyOpRemap, bo, currentTarget)
+			})
+		if _, ok := IsMappingConflict(err); ok {
+			// nothing has been written, commit the (empty) transaction and report the conflict to caller
+			conflictErr, err = err, nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, conflictErr
+}
+
+// doGetMappingsToTarget returns all mappings to a target, across all namespaces.
+//
+// The reverse index is keyed by namespace first, hence it is skip-scanned: one seek per namespace to the target's keys.
+func (dao *BoltDaoMoMapping) doGetMappingsToTarget(tx *bolt.Tx, appId, to string) ([]*BoMapping, error) {
+	result := make([]*BoMapping, 0)
+	forward, reverse, err := dao.getBuckets(tx, appId)
+	if reverse == nil || err != nil {
+		return result, err
+	}
+	cursor := reverse.Cursor()
+	for k, _ := cursor.First(); k != nil; {
+		namespace := string(k[:bytes.Index(k, []byte(boltKeySeparator))])
+		prefix := boltKey(namespace, to, "")
+		for k, _ = cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+			data := forward.Get(boltKey(namespace, string(k[len(prefix):])))
+			if data == nil {
+				continue
+			}
+			bo := &BoMapping{}
+			if err := json.Unmarshal(data, bo); err != nil {
+				return nil, err
+			}
+			result = append(result, bo)
+		}
+		// jump to the next namespace: the separator is the smallest byte, hence keys of the next namespace come right
+		// after all keys starting with namespace+separator
+		k, _ = cursor.Seek(append([]byte(namespace), boltKeySeparator[0]+1))
+	}
+	return liveMappings(result), nil
+}
+
+/*
+FindAllObjectsToTarget implements IDaoMoMapping.FindAllObjectsToTarget
+*/
+func (dao *BoltDaoMoMapping) FindAllObjectsToTarget(ctx context.Context, appId, to string) ([]*BoMapping, error) {
+	var result []*BoMapping
+	err := dao.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		result, err = dao.doGetMappingsToTarget(tx, appId, normalizeMappingTarget(to))
+		return err
+	})
+	return result, err
+}
+
+/*
+MergeTargets implements IDaoMoMapping.MergeTargets
+*/
+func (dao *BoltDaoMoMapping) MergeTargets(ctx context.Context, appId, from, into string, uniqueNamespaces []string) ([]*BoMapping, error) {
+	from, into = normalizeMappingTarget(from), normalizeMappingTarget(into)
+	var result []*BoMapping
+	err := dao.update(ctx, func(tx *bolt.Tx) error {
+		fromMappings, err := dao.doGetMappingsToTarget(tx, appId, from)
+		if err != nil {
+			return err
+		}
+		intoMappings, err := dao.doGetMappingsToTarget(tx, appId, into)
+		if err != nil {
+			return err
+		}
+		if result, err = planMergeTargets(fromMappings, intoMappings, into, uniqueNamespaces); err != nil {
+			return err
+		}
+		for _, bo := range fromMappings {
+			if _, err := dao.doDelete(tx, bo); err != nil {
+				return err
+			}
+		}
+		for _, bo := range result {
+			if _, err := dao.doInsert(tx, bo); err != nil {
+				return err
+			}
+			if err := dao.doRecordHistory(tx, historyOpRemap, bo, from); err != nil {
+				return err
+			}
+		}
+		if len(fromMappings) > 0 {
+			return dao.doUpsert(tx, newTargetAlias(appId, from, into, time.Now()))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+SplitTarget implements IDaoMoMapping.SplitTarget
+*/
+func (dao *BoltDaoMoMapping) SplitTarget(ctx context.Context, appId, from string, mapNsObj map[string]string, into string, uniqueNamespaces []string) ([]*BoMapping, error) {
+	from, into = normalizeMappingTarget(from), normalizeMappingTarget(into)
+	var result []*BoMapping
+	err := dao.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		result, err = planSplitTarget(appId, from, mapNsObj, into, uniqueNamespaces, func(namespace, object string) (*BoMapping, error) {
+			return dao.doGetMapping(tx, appId, namespace, object)
+		}, dao.targetFinder(tx, appId))
+		if err != nil {
+			return err
+		}
+		for _, bo := range result {
+			if err := dao.doUpsert(tx, bo); err != nil {
+				return err
+			}
+			if err := dao.doRecordHistory(tx, historyOpRemap, bo, from); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (dao *BoltDaoMoMapping) doAllocate(tx *bolt.Tx, appId string, mapNsObj map[string]string, target string, expiries map[string]time.Time, uniqueNamespaces []string) (string, error) {
+	var existingTarget = ""
+	var objsToMap = make([]*BoMapping, 0)
+	for ns, obj := range mapNsObj {
+		mapping, err := dao.doGetMapping(tx, appId, ns, obj)
+		if err != nil {
+			return "", err
+		}
+		if mapping != nil {
+			if existingTarget == "" {
+				existingTarget = mapping.To
+			} else if existingTarget != mapping.To {
+				return "", newAllocateConflictError(existingTarget, mapping.To)
+			}
+		} else {
+			objsToMap = append(objsToMap, &BoMapping{
+				Namespace: normalizeNamespace(ns),
+				From:      obj,
+				AppId:     appId,
+				Expiry:    expiryOf(expiries, normalizeNamespace(ns)),
+			})
+		}
+	}
+	var finalTarget = target
+	if existingTarget != "" {
+		finalTarget = existingTarget
+	}
+	for _, mapping := range objsToMap {
+		mapping.To = finalTarget
+		mapping.Time = time.Now()
+	}
+	if err := checkUniqueTargets(objsToMap, uniqueNamespaces, dao.targetFinder(tx, appId)); err != nil {
+		return "", err
+	}
+	for _, mapping := range objsToMap {
+		if _, err := dao.doInsert(tx, mapping); err != nil {
+			return "", err
+		}
+		if err := dao.doRecordHistory(tx, historyOpMap, mapping, ""); err != nil {
+			return "", err
+		}
+	}
+	return finalTarget, nil
+}
+
+/*
+GetMappingHistory implements IDaoMoMapping.GetMappingHistory
+*/
+func (dao *BoltDaoMoMapping) GetMappingHistory(ctx context.Context, appId, namespace, from string) ([]*BoMappingHistory, error) {
+	result := make([]*BoMappingHistory, 0)
+	prefix := boltKey(normalizeNamespace(namespace), from, "")
+	err := dao.view(ctx, func(tx *bolt.Tx) error {
+		history, err := dao.getHistoryBucket(tx, appId)
+		if history == nil || err != nil {
+			return err
+		}
+		c := history.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			entry := &BoMappingHistory{}
+			if err := json.Unmarshal(v, entry); err != nil {
+				return err
+			}
+			result = append(result, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortMappingHistory(result), nil
+}
+
+/*
+Allocate implements IDaoMoMapping.Allocate
+*/
+func (dao *BoltDaoMoMapping) Allocate(ctx context.Context, appId string, mapNsObj map[string]string, target string, expiries map[string]time.Time, uniqueNamespaces []string) (string, error) {
+	if mapNsObj == nil || len(mapNsObj) == 0 {
+		return "", nil
+	}
+	var finalTarget string
+	err := dao.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		finalTarget, err = dao.doAllocate(tx, appId, mapNsObj, target, expiries, uniqueNamespaces)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return finalTarget, nil
+}
+
+/*
+SweepExpired implements IDaoMoMapping.SweepExpired
+*/
+func (dao *BoltDaoMoMapping) SweepExpired(ctx context.Context, appId string) (int, error) {
+	var result int
+	err := dao.update(ctx, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(dao.calcBucketName(appId))
+		if bucket == nil {
+			return nil
+		}
+		forward, reverse, err := dao.getBuckets(tx, appId)
+		if err != nil {
+			return err
+		}
+		byTime, err := dao.getByTimeBucket(tx, appId)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		var expired []*BoMapping
+		err = forward.ForEach(func(_, data []byte) error {
+			bo := &BoMapping{}
+			if err := json.Unmarshal(data, bo); err != nil {
+				return err
+			}
+			if bo.isExpired(now) {
+				expired = append(expired, bo)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// buckets must not be modified while being iterated
+		for _, bo := range expired {
+			if err := dao.doRemove(forward, reverse, byTime, bo); err != nil {
+				return err
+			}
+		}
+		result = len(expired)
+		return nil
+	})
+	return result, err
+}
+
+/*----------------------------------------------------------------------*/
+
+func NewBoltDaoApp(db *bolt.DB, bucketName string) IDaoApp {
+	return &BoltDaoApp{db: db, bucketName: []byte(bucketName)}
+}
+
+/*
+BoltDaoApp is BoltDB implementation of IDaoApp.
+*/
+type BoltDaoApp struct {
+	db         *bolt.DB
+	bucketName []byte
+}
+
+func (dao *BoltDaoApp) doGet(tx *bolt.Tx, id string) (*BoApp, error) {
+	bucket := tx.Bucket(dao.bucketName)
+	if bucket == nil {
+		return nil, nil
+	}
+	data := bucket.Get([]byte(id))
+	if data == nil {
+		return nil, nil
+	}
+	bo := &BoApp{}
+	return bo, json.Unmarshal(data, bo)
+}
+
+func (dao *BoltDaoApp) doPut(tx *bolt.Tx, bo *BoApp) error {
+	bucket, err := tx.CreateBucketIfNotExists(dao.bucketName)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(bo)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(bo.Id), data)
+}
+
+// Create implements IDaoApp.Create
+func (dao *BoltDaoApp) Create(bo *BoApp) (bool, error) {
+	if bo == nil {
+		return false, nil
+	}
+	var result bool
+	err := dao.db.Update(func(tx *bolt.Tx) error {
+		existing, err := dao.doGet(tx, bo.Id)
+		if existing != nil || err != nil {
+			return err
+		}
+		result = true
+		return dao.doPut(tx, bo)
+	})
+	return result && err == nil, err
+}
+
+// Get implements IDaoApp.Get
+func (dao *BoltDaoApp) Get(id string) (*BoApp, error) {
+	var result *BoApp
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		var err error
+		result, err = dao.doGet(tx, id)
+		return err
+	})
+	return result, err
+}
+
+// GetAll implements IDaoApp.GetAll
+func (dao *BoltDaoApp) GetAll() ([]*BoApp, error) {
+	result := make([]*BoApp, 0)
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(dao.bucketName)
+		if bucket == nil {
+			return nil
+		}
+		// keys are iterated in byte-sorted order
+		return bucket.ForEach(func(_, data []byte) error {
+			bo := &BoApp{}
+			if err := json.Unmarshal(data, bo); err != nil {
+				return err
+			}
+			result = append(result, bo)
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Update implements IDaoApp.Update
+func (dao *BoltDaoApp) Update(bo *BoApp) (bool, error) {
+	if bo == nil {
+		return false, nil
+	}
+	var result bool
+	err := dao.db.Update(func(tx *bolt.Tx) error {
+		existing, err := dao.doGet(tx, bo.Id)
+		if existing == nil || err != nil {
+			return err
+		}
+		result = true
+		return dao.doPut(tx, bo)
+	})
+	return result && err == nil, err
+}
+
+// Delete implements IDaoApp.Delete
+func (dao *BoltDaoApp) Delete(bo *BoApp) (bool, error) {
+	if bo == nil {
+		return false, nil
+	}
+	var result bool
+	err := dao.db.Update(func(tx *bolt.Tx) error {
+		existing, err := dao.doGet(tx, bo.Id)
+		if existing == nil || err != nil {
+			return err
+		}
+		result = true
+		return tx.Bucket(dao.bucketName).Delete([]byte(bo.Id))
+	})
+	return result && err == nil, err
+}
@@ -0,0 +1,173 @@
+package mom
+
+import (
+	"context"
+	bolt "go.etcd.io/bbolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	_testBoltBucketApps         = "test_apps"
+	_testBoltBaseBucketMappings = "test_mom"
+)
+
+func _openBoltDb(t *testing.T) *bolt.DB {
+	dir, err := ioutil.TempDir("", "mom")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %e", err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "mom.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("error opening bolt db: %e", err)
+	}
+	return db
+}
+
+func _closeBoltDb(db *bolt.DB) {
+	_ = db.Close()
+	_ = os.RemoveAll(filepath.Dir(db.Path()))
+}
+
+/*----------------------------------------------------------------------*/
+
+func TestBoltDaoMoMapping_InitStorage(t *testing.T) {
+	name := "TestBoltDaoMoMapping_InitStorage"
+	db := _openBoltDb(t)
+	defer _closeBoltDb(db)
+	dao := NewBoltDaoMoMapping(db, _testBoltBaseBucketMappings)
+	err := dao.InitStorage(_testCtx, _testAppId)
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+}
+
+func TestBoltDaoMoMapping_DestroyStorage(t *testing.T) {
+	name := "TestBoltDaoMoMapping_DestroyStorage"
+	db := _openBoltDb(t)
+	defer _closeBoltDb(db)
+	dao := NewBoltDaoMoMapping(db, _testBoltBaseBucketMappings)
+	err := dao.DestroyStorage(_testCtx, _testAppId)
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+}
+
+func TestBoltDaoMoMapping_MapCancelledContext(t *testing.T) {
+	name := "TestBoltDaoMoMapping_MapCancelledContext"
+	db := _openBoltDb(t)
+	defer _closeBoltDb(db)
+	dao := NewBoltDaoMoMapping(db, _testBoltBaseBucketMappings)
+	err := dao.InitStorage(_testCtx, _testAppId)
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ns := "email"
+	object := "btnguyen2k(at)1.email"
+	target := "thanhnb"
+	if _, err := dao.Map(ctx, _testAppId, ns, object, target, nil, nil, nil); err != context.Canceled {
+		t.Fatalf("%s failed - expect %#v but received %#v", name, context.Canceled, err)
+	}
+	bo, err := dao.FindTargetForObject(_testCtx, _testAppId, ns, object)
+	if bo != nil || err != nil {
+		t.Fatalf("%s failed - expect no mapping but received %#v/%e", name, bo, err)
+	}
+}
+
+func TestBoltDaoMoMapping_Reopen(t *testing.T) {
+	name := "TestBoltDaoMoMapping_Reopen"
+	db := _openBoltDb(t)
+	defer func() { _closeBoltDb(db) }()
+	dao := NewBoltDaoMoMapping(db, _testBoltBaseBucketMappings)
+	err := dao.InitStorage(_testCtx, _testAppId)
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	ns := "email"
+	object := "btnguyen2k(at)1.email"
+	target := "thanhnb"
+	if _, err := dao.Map(_testCtx, _testAppId, ns, object, target, nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := NewBoltDaoApp(db, _testBoltBucketApps).Create(_testApp); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+
+	// mappings and apps must survive closing and reopening the database file
+	path := db.Path()
+	if err := db.Close(); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if db, err = bolt.Open(path, 0600, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	dao = NewBoltDaoMoMapping(db, _testBoltBaseBucketMappings)
+	bo, err := dao.FindTargetForObject(_testCtx, _testAppId, ns, object)
+	if bo == nil || err != nil || bo.To != target {
+		t.Fatalf("%s failed - expect [%s:%s] to map to %#v but received %#v/%e", name, ns, object, target, bo, err)
+	}
+	app, err := NewBoltDaoApp(db, _testBoltBucketApps).Get(_testAppId)
+	if app == nil || err != nil || app.Id != _testAppId {
+		t.Fatalf("%s failed - expect app %#v but received %#v/%e", name, _testAppId, app, err)
+	}
+}
+
+func TestBoltDaoMoMapping_BuildByTimeIndex(t *testing.T) {
+	name := "TestBoltDaoMoMapping_BuildByTimeIndex"
+	db := _openBoltDb(t)
+	defer _closeBoltDb(db)
+	dao := NewBoltDaoMoMapping(db, _testBoltBaseBucketMappings)
+	objs := []string{"c@domain.com", "b@domain.com"}
+	for _, obj := range objs {
+		if _, err := dao.Map(_testCtx, _testAppId, "email", obj, "target", nil, nil, nil); err != nil {
+			t.Fatalf("%s failed: %e", name, err)
+		}
+	}
+	// simulate a database created before the reverse-by-time index was introduced
+	err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(dao.(*BoltDaoMoMapping).calcBucketName(_testAppId)).DeleteBucket([]byte(bucketByTime))
+	})
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	expectObjects := func(expected []string) {
+		page, err := dao.FindObjectsToTargetPage(_testCtx, _testAppId, "email", "target", PageRequest{})
+		if err != nil || len(page) != len(expected) {
+			t.Fatalf("%s failed - expect %#v but received %#v / %e", name, expected, page, err)
+		}
+		for i, bo := range page {
+			if bo.From != expected[i] {
+				t.Fatalf("%s failed - expect %#v but received %#v at #%d", name, expected[i], bo.From, i)
+			}
+		}
+		if count, err := dao.CountObjectsToTarget(_testCtx, _testAppId, "email", "target"); err != nil || count != len(expected) {
+			t.Fatalf("%s failed - expect %d objects but received %d / %e", name, len(expected), count, err)
+		}
+	}
+	// readers fall back to the reverse index, the first write builds the index
+	expectObjects(objs)
+	if _, err := dao.Map(_testCtx, _testAppId, "email", "a@domain.com", "target", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	expectObjects(append(objs, "a@domain.com"))
+}
+
+/*----------------------------------------------------------------------*/
+
+func TestBoltDaoApp_Conformance(t *testing.T) {
+	testDaoAppConformance(t, func(t *testing.T) (IDaoApp, func()) {
+		db := _openBoltDb(t)
+		return NewBoltDaoApp(db, _testBoltBucketApps), func() { _closeBoltDb(db) }
+	})
+}
+
+func TestBoltDaoMoMapping_Conformance(t *testing.T) {
+	testDaoMoMappingConformance(t, func(t *testing.T) (IDaoMoMapping, func()) {
+		db := _openBoltDb(t)
+		return NewBoltDaoMoMapping(db, _testBoltBaseBucketMappings), func() { _closeBoltDb(db) }
+	})
+}
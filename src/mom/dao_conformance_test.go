@@ -0,0 +1,1351 @@
+package mom
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+Backend-agnostic conformance tests for IDaoMoMapping and IDaoApp.
+
+Each backend's test file calls testDaoMoMappingConformance/testDaoAppConformance with a factory that returns a ready-to-use DAO instance,
+so that all backends are verified against the same set of rules.
+*/
+
+const (
+	_testConformanceAppId      = "conformance"
+	_testConformanceOtherAppId = "conformance_other"
+	_testConcurrency           = 16
+)
+
+// daoMoMappingFactory creates a new IDaoMoMapping instance for a test, and returns a function to clean up after the test.
+type daoMoMappingFactory func(t *testing.T) (IDaoMoMapping, func())
+
+// daoAppFactory creates a new empty IDaoApp instance for a test, and returns a function to clean up after the test.
+type daoAppFactory func(t *testing.T) (IDaoApp, func())
+
+func _resetStorage(t *testing.T, dao IDaoMoMapping, appIds ...string) {
+	for _, appId := range appIds {
+		if err := dao.DestroyStorage(_testCtx, appId); err != nil {
+			t.Fatalf("error destroying storage of app [%s]: %e", appId, err)
+		}
+		if err := dao.InitStorage(_testCtx, appId); err != nil {
+			t.Fatalf("error initializing storage of app [%s]: %e", appId, err)
+		}
+	}
+}
+
+func _expectTarget(t *testing.T, name string, dao IDaoMoMapping, appId, ns, obj, expectedTarget string) {
+	bo, err := dao.FindTargetForObject(_testCtx, appId, ns, obj)
+	if err != nil {
+		t.Fatalf("%s failed - error finding target for [%s:%s]: %e", name, ns, obj, err)
+	}
+	if expectedTarget == "" {
+		if bo != nil {
+			t.Fatalf("%s failed - expect [%s:%s] to be unmapped but it maps to %#v", name, ns, obj, bo.To)
+		}
+		return
+	}
+	if bo == nil {
+		t.Fatalf("%s failed - expect [%s:%s] to map to %#v but it is unmapped", name, ns, obj, expectedTarget)
+	}
+	if bo.To != normalizeMappingTarget(expectedTarget) {
+		t.Fatalf("%s failed - expect [%s:%s] to map to %#v but received %#v", name, ns, obj, normalizeMappingTarget(expectedTarget), bo.To)
+	}
+	if bo.Namespace != normalizeNamespace(ns) || bo.From != obj || bo.AppId != appId {
+		t.Fatalf("%s failed - invalid mapping data %#v", name, bo)
+	}
+}
+
+func _expectNumObjects(t *testing.T, name string, dao IDaoMoMapping, appId, ns, target string, expected int) []*BoMapping {
+	boList, err := dao.FindObjectsToTarget(_testCtx, appId, ns, target)
+	if err != nil {
+		t.Fatalf("%s failed - error finding objects for [%s:%s]: %e", name, ns, target, err)
+	}
+	if len(boList) != expected {
+		t.Fatalf("%s failed - expect %d objects map to [%s:%s] but received %d", name, expected, ns, target, len(boList))
+	}
+	return boList
+}
+
+/*
+testDaoMoMappingConformance verifies that an IDaoMoMapping implementation follows all rules documented in IDaoMoMapping.
+*/
+func testDaoMoMappingConformance(t *testing.T, factory daoMoMappingFactory) {
+	tests := []struct {
+		name string
+		f    func(t *testing.T, name string, dao IDaoMoMapping)
+	}{
+		{"MapUnmapped", _conformanceMapUnmapped},
+		{"MapSameTarget", _conformanceMapSameTarget},
+		{"MapAnotherTarget", _conformanceMapAnotherTarget},
+		{"MapNormalization", _conformanceMapNormalization},
+		{"UnmapWrongTarget", _conformanceUnmapWrongTarget},
+		{"UnmapNotExist", _conformanceUnmapNotExist},
+		{"FindObjectsPerNamespace", _conformanceFindObjectsPerNamespace},
+		{"AppIsolation", _conformanceAppIsolation},
+		{"DestroyStorage", _conformanceDestroyStorage},
+		{"AllocateEmpty", _conformanceAllocateEmpty},
+		{"AllocateNew", _conformanceAllocateNew},
+		{"AllocateExisting", _conformanceAllocateExisting},
+		{"AllocateConflict", _conformanceAllocateConflict},
+		{"ConcurrentMap", _conformanceConcurrentMap},
+		{"ConcurrentAllocate", _conformanceConcurrentAllocate},
+		{"ConcurrentAllocateOverlapping", _conformanceConcurrentAllocateOverlapping},
+		{"RemapUnmapped", _conformanceRemapUnmapped},
+		{"RemapNewTarget", _conformanceRemapNewTarget},
+		{"RemapSameTarget", _conformanceRemapSameTarget},
+		{"RemapExpectedTarget", _conformanceRemapExpectedTarget},
+		{"ConcurrentRemap", _conformanceConcurrentRemap},
+		{"MapUniqueNamespace", _conformanceMapUniqueNamespace},
+		{"RemapUniqueNamespace", _conformanceRemapUniqueNamespace},
+		{"AllocateUniqueNamespace", _conformanceAllocateUniqueNamespace},
+		{"MapManyUniqueNamespace", _conformanceMapManyUniqueNamespace},
+		{"ConcurrentMapUniqueNamespace", _conformanceConcurrentMapUniqueNamespace},
+		{"MergeTargets", _conformanceMergeTargets},
+		{"MergeTargetsNotExist", _conformanceMergeTargetsNotExist},
+		{"MergeTargetsUniqueNamespace", _conformanceMergeTargetsUniqueNamespace},
+		{"MergeTargetsAlias", _conformanceMergeTargetsAlias},
+		{"MergeTargetsAliasChain", _conformanceMergeTargetsAliasChain},
+		{"SplitTarget", _conformanceSplitTarget},
+		{"SplitTargetConflict", _conformanceSplitTargetConflict},
+		{"SplitTargetRerun", _conformanceSplitTargetRerun},
+		{"SplitTargetUniqueNamespace", _conformanceSplitTargetUniqueNamespace},
+		{"MappingHistory", _conformanceMappingHistory},
+		{"MappingHistoryMergeSplit", _conformanceMappingHistoryMergeSplit},
+		{"FindTargetForObjectAt", _conformanceFindTargetForObjectAt},
+		{"MapExpiry", _conformanceMapExpiry},
+		{"MapExpired", _conformanceMapExpired},
+		{"RemapKeepsExpiry", _conformanceRemapKeepsExpiry},
+		{"AllocateExpired", _conformanceAllocateExpired},
+		{"SweepExpired", _conformanceSweepExpired},
+		{"MapAttrs", _conformanceMapAttrs},
+		{"PatchAttrs", _conformancePatchAttrs},
+		{"RemapKeepsAttrs", _conformanceRemapKeepsAttrs},
+		{"FindTargetsForObjects", _conformanceFindTargetsForObjects},
+		{"MapMany", _conformanceMapMany},
+		{"UnmapMany", _conformanceUnmapMany},
+		{"FindObjectsToTargetPage", _conformanceFindObjectsToTargetPage},
+		{"CountObjectsToTarget", _conformanceCountObjectsToTarget},
+		{"HasObjects", _conformanceHasObjects},
+		{"FindAllObjectsToTarget", _conformanceFindAllObjectsToTarget},
+		{"TranslateObject", _conformanceTranslateObject},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dao, cleanup := factory(t)
+			if cleanup != nil {
+				defer cleanup()
+			}
+			_resetStorage(t, dao, _testConformanceAppId, _testConformanceOtherAppId)
+			test.f(t, t.Name(), dao)
+		})
+	}
+}
+
+func _conformanceMapUnmapped(t *testing.T, name string, dao IDaoMoMapping) {
+	bo, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil)
+	if bo == nil || err != nil {
+		t.Fatalf("%s failed: %#v / %e", name, bo, err)
+	}
+	if bo.To != "target1" || bo.Time.IsZero() {
+		t.Fatalf("%s failed - invalid mapping data %#v", name, bo)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "target1")
+}
+
+func _conformanceMapSameTarget(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	bo, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil)
+	if bo == nil || err != nil {
+		t.Fatalf("%s failed - mapping an object to its current target must succeed: %#v / %e", name, bo, err)
+	}
+	if bo.To != "target1" {
+		t.Fatalf("%s failed - expect %#v but received %#v", name, "target1", bo.To)
+	}
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target1", 1)
+}
+
+func _conformanceMapAnotherTarget(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	bo, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target2", nil, nil, nil)
+	if err == nil {
+		t.Fatalf("%s failed - mapping an object to another target must fail", name)
+	}
+	if existing, ok := IsMappingConflict(err); !ok || existing == nil || existing.To != "target1" {
+		t.Fatalf("%s failed - expect MappingConflictError with existing mapping but received %#v", name, err)
+	}
+	if bo == nil || bo.To != "target1" {
+		t.Fatalf("%s failed - expect existing mapping to be returned but received %#v", name, bo)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "target1")
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target2", 0)
+}
+
+func _conformanceMapNormalization(t *testing.T, name string, dao IDaoMoMapping) {
+	// namespaces and targets are normalized, objects are stored as given (they are normalized by the API layer)
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, " EMAIL ", "User@Domain.COM", " target1 ", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "Email", "User@Domain.COM", "target1")
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "")
+}
+
+func _conformanceUnmapWrongTarget(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	ok, err := dao.Unmap(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target2")
+	if ok || err != nil {
+		t.Fatalf("%s failed - unmapping from another target must not remove the mapping: %#v / %e", name, ok, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "target1")
+
+	ok, err = dao.Unmap(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1")
+	if !ok || err != nil {
+		t.Fatalf("%s failed: %#v / %e", name, ok, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "")
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target1", 0)
+}
+
+func _conformanceUnmapNotExist(t *testing.T, name string, dao IDaoMoMapping) {
+	ok, err := dao.Unmap(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1")
+	if ok || err != nil {
+		t.Fatalf("%s failed: %#v / %e", name, ok, err)
+	}
+}
+
+func _conformanceFindObjectsPerNamespace(t *testing.T, name string, dao IDaoMoMapping) {
+	for i := 0; i < 3; i++ {
+		if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", fmt.Sprintf("user%d@domain.com", i), "target1", nil, nil, nil); err != nil {
+			t.Fatalf("%s failed: %e", name, err)
+		}
+	}
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "phone", "0123456789", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "other@domain.com", "target2", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	for _, bo := range _expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target1", 3) {
+		if bo.Namespace != "email" || bo.To != "target1" {
+			t.Fatalf("%s failed - invalid mapping data %#v", name, bo)
+		}
+	}
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "phone", "target1", 1)
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target2", 1)
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target3", 0)
+}
+
+func _conformanceAppIsolation(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceOtherAppId, "email", "user@domain.com", "")
+	if _, err := dao.Map(_testCtx, _testConformanceOtherAppId, "email", "user@domain.com", "target2", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed - same object in another app must be mappable: %e", name, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "target1")
+	_expectTarget(t, name, dao, _testConformanceOtherAppId, "email", "user@domain.com", "target2")
+}
+
+func _conformanceDestroyStorage(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Map(_testCtx, _testConformanceOtherAppId, "email", "user@domain.com", "target2", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if err := dao.DestroyStorage(_testCtx, _testConformanceAppId); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "")
+	_expectTarget(t, name, dao, _testConformanceOtherAppId, "email", "user@domain.com", "target2")
+}
+
+func _conformanceAllocateEmpty(t *testing.T, name string, dao IDaoMoMapping) {
+	target, err := dao.Allocate(_testCtx, _testConformanceAppId, map[string]string{}, "target1", nil, nil)
+	if target != "" || err != nil {
+		t.Fatalf("%s failed: %#v / %e", name, target, err)
+	}
+}
+
+func _conformanceAllocateNew(t *testing.T, name string, dao IDaoMoMapping) {
+	target, err := dao.Allocate(_testCtx, _testConformanceAppId, map[string]string{"email": "user@domain.com", "phone": "0123456789"}, "target1", nil, nil)
+	if target != "target1" || err != nil {
+		t.Fatalf("%s failed: %#v / %e", name, target, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "target1")
+	_expectTarget(t, name, dao, _testConformanceAppId, "phone", "0123456789", "target1")
+}
+
+func _conformanceAllocateExisting(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	target, err := dao.Allocate(_testCtx, _testConformanceAppId, map[string]string{"email": "user@domain.com", "phone": "0123456789"}, "target2", nil, nil)
+	if target != "target1" || err != nil {
+		t.Fatalf("%s failed - expect existing target %#v to be used but received %#v / %e", name, "target1", target, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "phone", "0123456789", "target1")
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "phone", "target2", 0)
+}
+
+func _conformanceAllocateConflict(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "phone", "0123456789", "target2", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	mapNsObj := map[string]string{"email": "user@domain.com", "phone": "0123456789", "fb": "user.fb"}
+	target, err := dao.Allocate(_testCtx, _testConformanceAppId, mapNsObj, "target3", nil, nil)
+	if e, ok := err.(*AllocateConflictError); !ok || target != "" || len(e.Targets) != 2 || e.Targets[0] != "target1" || e.Targets[1] != "target2" {
+		t.Fatalf("%s failed - expect AllocateConflictError on targets [target1,target2] and an empty target but received %#v / %#v", name, target, err)
+	}
+	// Allocate is all-or-nothing: no new mapping must be created
+	_expectTarget(t, name, dao, _testConformanceAppId, "fb", "user.fb", "")
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "target1")
+	_expectTarget(t, name, dao, _testConformanceAppId, "phone", "0123456789", "target2")
+}
+
+func _conformanceConcurrentMap(t *testing.T, name string, dao IDaoMoMapping) {
+	var wg sync.WaitGroup
+	results := make([]*BoMapping, _testConcurrency)
+	errs := make([]error, _testConcurrency)
+	for i := 0; i < _testConcurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", fmt.Sprintf("target%d", i), nil, nil, nil)
+		}(i)
+	}
+	wg.Wait()
+	final, err := dao.FindTargetForObject(_testCtx, _testConformanceAppId, "email", "user@domain.com")
+	if final == nil || err != nil {
+		t.Fatalf("%s failed - object must be mapped by one of the racers: %#v / %e", name, final, err)
+	}
+	numSuccess := 0
+	for i := 0; i < _testConcurrency; i++ {
+		if errs[i] == nil {
+			numSuccess++
+			if results[i] == nil || results[i].To != final.To || final.To != fmt.Sprintf("target%d", i) {
+				t.Fatalf("%s failed - racer #%d succeeded but object maps to %#v", name, i, final.To)
+			}
+		} else if winner, ok := IsMappingConflict(errs[i]); !ok || winner == nil || winner.To != final.To {
+			t.Fatalf("%s failed - racer #%d expect conflict with winning target %#v but received %#v", name, i, final.To, errs[i])
+		}
+	}
+	if numSuccess != 1 {
+		t.Fatalf("%s failed - expect exactly 1 racer to succeed but %d succeeded", name, numSuccess)
+	}
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", final.To, 1)
+}
+
+func _conformanceConcurrentAllocate(t *testing.T, name string, dao IDaoMoMapping) {
+	var wg sync.WaitGroup
+	results := make([]string, _testConcurrency)
+	errs := make([]error, _testConcurrency)
+	for i := 0; i < _testConcurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			mapNsObj := map[string]string{"email": "user@domain.com", "phone": "0123456789"}
+			results[i], errs[i] = dao.Allocate(_testCtx, _testConformanceAppId, mapNsObj, fmt.Sprintf("target%d", i), nil, nil)
+		}(i)
+	}
+	wg.Wait()
+	email, _ := dao.FindTargetForObject(_testCtx, _testConformanceAppId, "email", "user@domain.com")
+	phone, _ := dao.FindTargetForObject(_testCtx, _testConformanceAppId, "phone", "0123456789")
+	if email == nil || phone == nil || email.To != phone.To {
+		t.Fatalf("%s failed - objects must map to a same target: %#v / %#v", name, email, phone)
+	}
+	for i := 0; i < _testConcurrency; i++ {
+		if errs[i] == nil && results[i] != email.To {
+			t.Fatalf("%s failed - racer #%d succeeded with target %#v but objects map to %#v", name, i, results[i], email.To)
+		}
+	}
+}
+
+func _conformanceConcurrentAllocateOverlapping(t *testing.T, name string, dao IDaoMoMapping) {
+	// racer #i allocates {email: user<i/2>, phone: <(i+1)/2>}: each racer shares one object with each of its neighbours
+	mapNsObjs := make([]map[string]string, _testConcurrency)
+	for i := 0; i < _testConcurrency; i++ {
+		mapNsObjs[i] = map[string]string{"email": fmt.Sprintf("user%d@domain.com", i/2), "phone": fmt.Sprintf("0%d", (i+1)/2)}
+	}
+	var wg sync.WaitGroup
+	results := make([]string, _testConcurrency)
+	errs := make([]error, _testConcurrency)
+	for i := 0; i < _testConcurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = dao.Allocate(_testCtx, _testConformanceAppId, mapNsObjs[i], fmt.Sprintf("target%d", i), nil, nil)
+		}(i)
+	}
+	wg.Wait()
+	numSuccess := 0
+	for i := 0; i < _testConcurrency; i++ {
+		if errs[i] != nil {
+			continue
+		}
+		numSuccess++
+		// a successful Allocate must never be undone by a concurrent one
+		for ns, obj := range mapNsObjs[i] {
+			_expectTarget(t, name, dao, _testConformanceAppId, ns, obj, results[i])
+		}
+	}
+	if numSuccess == 0 {
+		t.Fatalf("%s failed - expect at least 1 racer to succeed", name)
+	}
+}
+
+/*
+testDaoAppConformance verifies that an IDaoApp implementation follows all rules documented in IDaoApp.
+*/
+func testDaoAppConformance(t *testing.T, factory daoAppFactory) {
+	name := t.Name()
+	dao, cleanup := factory(t)
+	if cleanup != nil {
+		defer cleanup()
+	}
+
+	if app, err := dao.Get(_testAppId); app != nil || err != nil {
+		t.Fatalf("%s failed - app must not exist: %#v / %e", name, app, err)
+	}
+	if ok, err := dao.Update(_testApp); ok || err != nil {
+		t.Fatalf("%s failed - updating non-exist app must return false: %#v / %e", name, ok, err)
+	}
+	if ok, err := dao.Create(_testApp); !ok || err != nil {
+		t.Fatalf("%s failed - error creating app: %#v / %e", name, ok, err)
+	}
+	if ok, err := dao.Create(_testApp); ok || err != nil {
+		t.Fatalf("%s failed - creating existing app must return false: %#v / %e", name, ok, err)
+	}
+	other := _testApp.Clone()
+	other.Id = _testAppId + "_other"
+	if ok, err := dao.Create(other); !ok || err != nil {
+		t.Fatalf("%s failed - error creating app: %#v / %e", name, ok, err)
+	}
+	if apps, err := dao.GetAll(); len(apps) != 2 || err != nil {
+		t.Fatalf("%s failed - expect 2 apps: %#v / %e", name, apps, err)
+	} else if apps[0].Id != _testAppId || apps[1].Id != other.Id {
+		t.Fatalf("%s failed - apps must be sorted by id: %#v", name, apps)
+	}
+
+	app := _testApp.Clone()
+	app.Secret = _testAppSecret + "-updated"
+	if ok, err := dao.Update(app); !ok || err != nil {
+		t.Fatalf("%s failed - error updating app: %#v / %e", name, ok, err)
+	}
+	if app, err := dao.Get(_testAppId); app == nil || err != nil || app.Secret != _testAppSecret+"-updated" {
+		t.Fatalf("%s failed - app must be updated: %#v / %e", name, app, err)
+	} else if app.Config["desc"] != _testAppDesc {
+		t.Fatalf("%s failed - app config must be persisted: %#v", name, app.Config)
+	}
+
+	ttl := int64(60)
+	app.Namespaces = &BoNamespaceRegistry{Strict: true, Namespaces: map[string]*BoNamespace{
+		"email": {Normalizer: "email", Validation: "@", Ttl: &ttl, Unique: true},
+	}}
+	if ok, err := dao.Update(app); !ok || err != nil {
+		t.Fatalf("%s failed - error updating app: %#v / %e", name, ok, err)
+	}
+	if loaded, err := dao.Get(_testAppId); loaded == nil || err != nil || !reflect.DeepEqual(loaded.Namespaces, app.Namespaces) {
+		t.Fatalf("%s failed - namespace registry must be persisted: %#v / %e", name, loaded, err)
+	}
+
+	if ok, err := dao.Delete(app); !ok || err != nil {
+		t.Fatalf("%s failed - error deleting app: %#v / %e", name, ok, err)
+	}
+	if ok, err := dao.Delete(app); ok || err != nil {
+		t.Fatalf("%s failed - deleting non-exist app must return false: %#v / %e", name, ok, err)
+	}
+	if app, err := dao.Get(_testAppId); app != nil || err != nil {
+		t.Fatalf("%s failed - app must have been deleted: %#v / %e", name, app, err)
+	}
+}
+
+func _conformanceRemapUnmapped(t *testing.T, name string, dao IDaoMoMapping) {
+	bo, err := dao.Remap(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", "", nil)
+	if bo != nil || err != nil {
+		t.Fatalf("%s failed - remapping an unmapped object must return nothing: %#v / %e", name, bo, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "")
+}
+
+func _conformanceRemapNewTarget(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	bo, err := dao.Remap(_testCtx, _testConformanceAppId, " EMAIL ", "user@domain.com", " target2 ", "", nil)
+	if bo == nil || err != nil {
+		t.Fatalf("%s failed: %#v / %e", name, bo, err)
+	}
+	if bo.To != "target2" || bo.Namespace != "email" || bo.From != "user@domain.com" || bo.Time.IsZero() {
+		t.Fatalf("%s failed - invalid mapping data %#v", name, bo)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "target2")
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target1", 0)
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target2", 1)
+}
+
+func _conformanceRemapSameTarget(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	bo, err := dao.Remap(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", "target1", nil)
+	if bo == nil || err != nil || bo.To != "target1" {
+		t.Fatalf("%s failed: %#v / %e", name, bo, err)
+	}
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target1", 1)
+}
+
+func _conformanceRemapExpectedTarget(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	bo, err := dao.Remap(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target3", "target2", nil)
+	if existing, ok := IsMappingConflict(err); !ok || existing == nil || existing.To != "target1" {
+		t.Fatalf("%s failed - expect MappingConflictError with existing mapping but received %#v", name, err)
+	}
+	if bo == nil || bo.To != "target1" {
+		t.Fatalf("%s failed - expect existing mapping to be returned but received %#v", name, bo)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "target1")
+
+	bo, err = dao.Remap(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target3", " target1 ", nil)
+	if bo == nil || err != nil || bo.To != "target3" {
+		t.Fatalf("%s failed: %#v / %e", name, bo, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "target3")
+}
+
+func _conformanceConcurrentRemap(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, _testConcurrency)
+	for i := 0; i < _testConcurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = dao.Remap(_testCtx, _testConformanceAppId, "email", "user@domain.com", fmt.Sprintf("target%d", i), "target", nil)
+		}(i)
+	}
+	wg.Wait()
+	numSuccess := 0
+	for i := 0; i < _testConcurrency; i++ {
+		if errs[i] == nil {
+			numSuccess++
+			_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", fmt.Sprintf("target%d", i))
+		} else if _, ok := IsMappingConflict(errs[i]); !ok {
+			t.Fatalf("%s failed - racer #%d expect conflict but received %#v", name, i, errs[i])
+		}
+	}
+	if numSuccess != 1 {
+		t.Fatalf("%s failed - expect exactly 1 racer to succeed but %d succeeded", name, numSuccess)
+	}
+}
+
+func _expectUniqueConflict(t *testing.T, name string, err error, expectedFrom string) {
+	if conflict, ok := IsUniqueConflict(err); !ok || conflict == nil || conflict.From != expectedFrom {
+		t.Fatalf("%s failed - expect UniqueConflictError with object %#v but received %#v", name, expectedFrom, err)
+	}
+}
+
+func _conformanceMapUniqueNamespace(t *testing.T, name string, dao IDaoMoMapping) {
+	unique := []string{" LOGIN "}
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "login", "user1", "target1", nil, nil, unique); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	_, err := dao.Map(_testCtx, _testConformanceAppId, "login", "user2", "target1", nil, nil, unique)
+	_expectUniqueConflict(t, name, err, "user1")
+	_expectTarget(t, name, dao, _testConformanceAppId, "login", "user2", "")
+	if history, err := dao.GetMappingHistory(_testCtx, _testConformanceAppId, "login", "user2"); err != nil || len(history) != 0 {
+		t.Fatalf("%s failed - expect no history entry: %#v / %e", name, history, err)
+	}
+
+	// the object itself does not violate uniqueness
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "login", "user1", "target1", nil, nil, unique); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	// an object mapped to another target conflicts with its own mapping first
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "login", "user3", "target3", nil, nil, unique)
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "login", "user3", "target1", nil, nil, unique); err == nil {
+		t.Fatalf("%s failed - expect conflict", name)
+	} else if winner, ok := IsMappingConflict(err); !ok || winner.To != "target3" {
+		t.Fatalf("%s failed - expect MappingConflictError but received %#v", name, err)
+	}
+	// other namespaces are not restricted
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user2@domain.com", "target1", nil, nil, unique); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user1@domain.com", "target1", nil, nil, unique); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+
+	// expired mapping does not violate uniqueness
+	expired := time.Now().Add(-time.Second)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "login", "expired", "target4", &expired, nil, nil)
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "login", "user4", "target4", nil, nil, unique); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+}
+
+func _conformanceRemapUniqueNamespace(t *testing.T, name string, dao IDaoMoMapping) {
+	unique := []string{"login"}
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "login", "user1", "target1", nil, nil, unique)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "login", "user2", "target2", nil, nil, unique)
+	_, err := dao.Remap(_testCtx, _testConformanceAppId, "login", "user2", "target1", "", unique)
+	_expectUniqueConflict(t, name, err, "user1")
+	_expectTarget(t, name, dao, _testConformanceAppId, "login", "user2", "target2")
+
+	if bo, err := dao.Remap(_testCtx, _testConformanceAppId, "login", "user2", "target3", "target2", unique); err != nil || bo == nil || bo.To != "target3" {
+		t.Fatalf("%s failed: %#v / %e", name, bo, err)
+	}
+}
+
+func _conformanceAllocateUniqueNamespace(t *testing.T, name string, dao IDaoMoMapping) {
+	unique := []string{"login"}
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "user1@domain.com", "target1", nil, nil, unique)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "login", "user1", "target1", nil, nil, unique)
+	// the existing target is reused, but already has another login
+	_, err := dao.Allocate(_testCtx, _testConformanceAppId, map[string]string{"email": "user1@domain.com", "login": "user2", "phone": "0123456789"}, "target2", nil, unique)
+	_expectUniqueConflict(t, name, err, "user1")
+	_expectTarget(t, name, dao, _testConformanceAppId, "login", "user2", "")
+	_expectTarget(t, name, dao, _testConformanceAppId, "phone", "0123456789", "")
+
+	target, err := dao.Allocate(_testCtx, _testConformanceAppId, map[string]string{"email": "user1@domain.com", "login": "user1", "phone": "0123456789"}, "target2", nil, unique)
+	if err != nil || target != "target1" {
+		t.Fatalf("%s failed: %#v / %e", name, target, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "phone", "0123456789", "target1")
+}
+
+func _conformanceMapManyUniqueNamespace(t *testing.T, name string, dao IDaoMoMapping) {
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "login", "user1", "target1", nil, nil, nil)
+	items := []*BoMapping{
+		{Namespace: "login", From: "user2", To: "target1"},
+		{Namespace: "LOGIN", From: "user3", To: "target2"},
+		{Namespace: "login", From: "user4", To: "target2"},
+		{Namespace: "login", From: "user1", To: "target1"},
+		{Namespace: "email", From: "user2@domain.com", To: "target1"},
+	}
+	expected := []*BoMapping{
+		{From: "user1", To: "target1"},
+		{From: "user3", To: "target2"},
+		{From: "user3", To: "target2"},
+		{From: "user1", To: "target1"},
+		{From: "user2@domain.com", To: "target1"},
+	}
+	mappings, err := dao.MapMany(_testCtx, _testConformanceAppId, items, []string{"login"})
+	if err != nil || len(mappings) != len(items) {
+		t.Fatalf("%s failed: %#v / %e", name, mappings, err)
+	}
+	for i, bo := range mappings {
+		if bo == nil || bo.From != expected[i].From || bo.To != expected[i].To {
+			t.Fatalf("%s failed - item #%d: expect %#v but received %#v", name, i, expected[i], bo)
+		}
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "login", "user2", "")
+	_expectTarget(t, name, dao, _testConformanceAppId, "login", "user4", "")
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "login", "target2", 1)
+}
+
+func _conformanceConcurrentMapUniqueNamespace(t *testing.T, name string, dao IDaoMoMapping) {
+	if mongoDao, ok := dao.(*MongodbDaoMoMapping); ok && mongoDao.allocateStrategy == allocateStrategyOptimistic {
+		t.Skip("uniqueness is best-effort with optimistic strategy")
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, _testConcurrency)
+	for i := 0; i < _testConcurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = dao.Map(_testCtx, _testConformanceAppId, "login", fmt.Sprintf("user%d", i), "target", nil, nil, []string{"login"})
+		}(i)
+	}
+	wg.Wait()
+	mappings := _expectNumObjects(t, name, dao, _testConformanceAppId, "login", "target", 1)
+	numSuccess := 0
+	for i := 0; i < _testConcurrency; i++ {
+		if errs[i] == nil {
+			numSuccess++
+			if mappings[0].From != fmt.Sprintf("user%d", i) {
+				t.Fatalf("%s failed - racer #%d succeeded but target has object %#v", name, i, mappings[0].From)
+			}
+		} else if _, ok := IsUniqueConflict(errs[i]); !ok && classifyTransientError(errs[i]) == "" {
+			// backends with transactions may report the race as a transient error, to be retried
+			t.Fatalf("%s failed - racer #%d expect conflict but received %#v", name, i, errs[i])
+		}
+	}
+	if numSuccess != 1 {
+		t.Fatalf("%s failed - expect exactly 1 racer to succeed but %d succeeded", name, numSuccess)
+	}
+}
+
+func _conformanceMergeTargets(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Allocate(_testCtx, _testConformanceAppId, map[string]string{"email": "user1@domain.com", "phone": "0123456789"}, "target1", nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user2@domain.com", "target2", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Map(_testCtx, _testConformanceOtherAppId, "email", "user3@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	moved, err := dao.MergeTargets(_testCtx, _testConformanceAppId, "target1", "target2", []string{"phone"})
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if len(moved) != 2 || moved[0].Namespace != "email" || moved[1].Namespace != "phone" || moved[0].To != "target2" || moved[1].To != "target2" {
+		t.Fatalf("%s failed - invalid moved mappings %#v", name, moved)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user1@domain.com", "target2")
+	_expectTarget(t, name, dao, _testConformanceAppId, "phone", "0123456789", "target2")
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target1", 0)
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target2", 2)
+	// other apps are not affected
+	_expectTarget(t, name, dao, _testConformanceOtherAppId, "email", "user3@domain.com", "target1")
+}
+
+func _conformanceMergeTargetsNotExist(t *testing.T, name string, dao IDaoMoMapping) {
+	moved, err := dao.MergeTargets(_testCtx, _testConformanceAppId, "target1", "target2", nil)
+	if err != nil || len(moved) != 0 {
+		t.Fatalf("%s failed: %#v / %e", name, moved, err)
+	}
+}
+
+func _conformanceMergeTargetsUniqueNamespace(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Allocate(_testCtx, _testConformanceAppId, map[string]string{"email": "user1@domain.com", "phone": "0123456789"}, "target1", nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Allocate(_testCtx, _testConformanceAppId, map[string]string{"email": "user2@domain.com", "phone": "0987654321"}, "target2", nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	moved, err := dao.MergeTargets(_testCtx, _testConformanceAppId, "target1", "target2", []string{" PHONE ", "sms"})
+	if e, ok := err.(*MergeConflictError); !ok || len(e.Namespaces) != 1 || e.Namespaces[0] != "phone" {
+		t.Fatalf("%s failed - expect MergeConflictError on namespace [phone] but received %#v / %#v", name, moved, err)
+	}
+	// nothing is moved
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user1@domain.com", "target1")
+	_expectTarget(t, name, dao, _testConformanceAppId, "phone", "0123456789", "target1")
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target2", 1)
+}
+
+func _expectResolvedTarget(t *testing.T, name string, dao IDaoMoMapping, appId, target, expected string, expectedAliased bool) {
+	resolved, aliased, err := resolveTarget(_testCtx, dao, appId, target)
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if resolved != expected || aliased != expectedAliased {
+		t.Fatalf("%s failed - expect [%s] to resolve to %#v/%#v but received %#v/%#v", name, target, expected, expectedAliased, resolved, aliased)
+	}
+}
+
+func _conformanceMergeTargetsAlias(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user1@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user2@domain.com", "target2", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.MergeTargets(_testCtx, _testConformanceAppId, "target1", "target2", nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	_expectResolvedTarget(t, name, dao, _testConformanceAppId, "target1", "target2", true)
+	_expectResolvedTarget(t, name, dao, _testConformanceAppId, " target2 ", "target2", false)
+	// aliases are app-scoped
+	_expectResolvedTarget(t, name, dao, _testConformanceOtherAppId, "target1", "target1", false)
+}
+
+func _conformanceMergeTargetsAliasChain(t *testing.T, name string, dao IDaoMoMapping) {
+	for i := 1; i <= 3; i++ {
+		if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", fmt.Sprintf("user%d@domain.com", i), fmt.Sprintf("target%d", i), nil, nil, nil); err != nil {
+			t.Fatalf("%s failed: %e", name, err)
+		}
+	}
+	if _, err := dao.MergeTargets(_testCtx, _testConformanceAppId, "target1", "target2", nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	moved, err := dao.MergeTargets(_testCtx, _testConformanceAppId, "target2", "target3", nil)
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if moved = removeReservedMappings(moved); len(moved) != 2 {
+		t.Fatalf("%s failed - expect 2 moved objects but received %#v", name, moved)
+	}
+	// chain target1 -> target2 -> target3 is collapsed
+	alias, err := dao.FindTargetForObject(_testCtx, _testConformanceAppId, namespaceTargetAlias, "target1")
+	if alias == nil || err != nil || alias.To != "target3" {
+		t.Fatalf("%s failed - expect alias [target1 -> target3] but received %#v / %e", name, alias, err)
+	}
+	_expectResolvedTarget(t, name, dao, _testConformanceAppId, "target1", "target3", true)
+	_expectResolvedTarget(t, name, dao, _testConformanceAppId, "target2", "target3", true)
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target3", 3)
+}
+
+func _conformanceSplitTarget(t *testing.T, name string, dao IDaoMoMapping) {
+	mapNsObj := map[string]string{"email": "user1@domain.com", "phone": "0123456789", "sms": "0987654321"}
+	if _, err := dao.Allocate(_testCtx, _testConformanceAppId, mapNsObj, "target1", nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	moved, err := dao.SplitTarget(_testCtx, _testConformanceAppId, "target1", map[string]string{"SMS": "0987654321", "phone": "0123456789"}, "target2", nil)
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if len(moved) != 2 || moved[0].Namespace != "phone" || moved[1].Namespace != "sms" || moved[0].To != "target2" || moved[1].To != "target2" {
+		t.Fatalf("%s failed - invalid moved mappings %#v", name, moved)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user1@domain.com", "target1")
+	_expectTarget(t, name, dao, _testConformanceAppId, "phone", "0123456789", "target2")
+	_expectTarget(t, name, dao, _testConformanceAppId, "sms", "0987654321", "target2")
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "phone", "target1", 0)
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "phone", "target2", 1)
+}
+
+func _conformanceSplitTargetConflict(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Allocate(_testCtx, _testConformanceAppId, map[string]string{"email": "user1@domain.com", "phone": "0123456789"}, "target1", nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "sms", "0987654321", "target3", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	mapNsObj := map[string]string{"phone": "0123456789", "sms": "0987654321", "passport": "A1234567"}
+	moved, err := dao.SplitTarget(_testCtx, _testConformanceAppId, "target1", mapNsObj, "target2", nil)
+	if e, ok := err.(*SplitConflictError); !ok || len(e.Namespaces) != 2 || e.Namespaces[0] != "passport" || e.Namespaces[1] != "sms" {
+		t.Fatalf("%s failed - expect SplitConflictError on namespaces [passport,sms] but received %#v / %#v", name, moved, err)
+	}
+	// nothing is moved
+	_expectTarget(t, name, dao, _testConformanceAppId, "phone", "0123456789", "target1")
+	_expectTarget(t, name, dao, _testConformanceAppId, "sms", "0987654321", "target3")
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "phone", "target2", 0)
+}
+
+func _conformanceSplitTargetRerun(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Allocate(_testCtx, _testConformanceAppId, map[string]string{"email": "user1@domain.com", "phone": "0123456789"}, "target1", nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.SplitTarget(_testCtx, _testConformanceAppId, "target1", map[string]string{"phone": "0123456789"}, "target2", nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	moved, err := dao.SplitTarget(_testCtx, _testConformanceAppId, "target1", map[string]string{"email": "user1@domain.com", "phone": "0123456789"}, "target2", nil)
+	if err != nil || len(moved) != 1 || moved[0].Namespace != "email" {
+		t.Fatalf("%s failed - expect only [email] to be moved but received %#v / %e", name, moved, err)
+	}
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target2", 1)
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "phone", "target2", 1)
+}
+
+func _conformanceSplitTargetUniqueNamespace(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Allocate(_testCtx, _testConformanceAppId, map[string]string{"email": "user1@domain.com", "phone": "0123456789"}, "target1", nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user2@domain.com", "target2", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	moved, err := dao.SplitTarget(_testCtx, _testConformanceAppId, "target1", map[string]string{"email": "user1@domain.com", "phone": "0123456789"}, "target2", []string{"Email"})
+	if moved != nil {
+		t.Fatalf("%s failed - expect nothing to be moved but received %#v", name, moved)
+	}
+	_expectUniqueConflict(t, name, err, "user2@domain.com")
+	// nothing is moved
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user1@domain.com", "target1")
+	_expectTarget(t, name, dao, _testConformanceAppId, "phone", "0123456789", "target1")
+
+	// target2 has no object in namespace "phone"
+	if moved, err = dao.SplitTarget(_testCtx, _testConformanceAppId, "target1", map[string]string{"phone": "0123456789"}, "target2", []string{"email", "phone"}); err != nil || len(moved) != 1 {
+		t.Fatalf("%s failed - expect [phone] to be moved but received %#v / %e", name, moved, err)
+	}
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "phone", "target2", 1)
+}
+
+// _expectHistory checks history entries of an object, each expected entry is either "op:to" or "op:prev_to->to".
+func _expectHistory(t *testing.T, name string, dao IDaoMoMapping, appId, ns, obj string, expected ...string) []*BoMappingHistory {
+	history, err := dao.GetMappingHistory(_testCtx, appId, ns, obj)
+	if err != nil {
+		t.Fatalf("%s failed - error fetching history of [%s:%s]: %e", name, ns, obj, err)
+	}
+	if len(history) != len(expected) {
+		t.Fatalf("%s failed - expect %d history entries of [%s:%s] but received %d", name, len(expected), ns, obj, len(history))
+	}
+	for i, entry := range history {
+		opTarget := entry.Op + ":" + entry.To
+		if entry.PrevTo != "" {
+			opTarget = entry.Op + ":" + entry.PrevTo + "->" + entry.To
+		}
+		if opTarget != expected[i] || entry.Version != i+1 || entry.Time.IsZero() {
+			t.Fatalf("%s failed - expect history entry #%d to be %#v but received %#v", name, i+1, expected[i], entry)
+		}
+	}
+	return history
+}
+
+func _conformanceMappingHistory(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	// mapping to the current target changes nothing
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Remap(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target2", "", nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Unmap(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target2"); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Allocate(_testCtx, _testConformanceAppId, map[string]string{"email": "user@domain.com"}, "target3", nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	_expectHistory(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "map:target1", "remap:target1->target2", "unmap:target2->target2", "map:target3")
+	_expectHistory(t, name, dao, _testConformanceOtherAppId, "email", "user@domain.com")
+}
+
+func _conformanceMappingHistoryMergeSplit(t *testing.T, name string, dao IDaoMoMapping) {
+	if _, err := dao.Allocate(_testCtx, _testConformanceAppId, map[string]string{"email": "user1@domain.com", "phone": "0123456789"}, "target1", nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user2@domain.com", "target2", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.MergeTargets(_testCtx, _testConformanceAppId, "target1", "target2", nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.SplitTarget(_testCtx, _testConformanceAppId, "target2", map[string]string{"phone": "0123456789"}, "target3", nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	_expectHistory(t, name, dao, _testConformanceAppId, "email", "user1@domain.com", "map:target1", "remap:target1->target2")
+	_expectHistory(t, name, dao, _testConformanceAppId, "phone", "0123456789", "map:target1", "remap:target1->target2", "remap:target2->target3")
+	// target aliases are not recorded
+	_expectHistory(t, name, dao, _testConformanceAppId, namespaceTargetAlias, "target1")
+}
+
+func _conformanceFindTargetForObjectAt(t *testing.T, name string, dao IDaoMoMapping) {
+	var checkpoints []time.Time
+	checkpoint := func() {
+		// ensure checkpoints are strictly between changes, regardless of the storage's time precision
+		time.Sleep(5 * time.Millisecond)
+		checkpoints = append(checkpoints, time.Now())
+		time.Sleep(5 * time.Millisecond)
+	}
+	checkpoint()
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	checkpoint()
+	if _, err := dao.Remap(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target2", "", nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	checkpoint()
+	if _, err := dao.Unmap(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target2"); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	checkpoint()
+	expected := []string{"", "target1", "target2", ""}
+	for i, at := range checkpoints {
+		bo, err := findTargetForObjectAt(_testCtx, dao, _testConformanceAppId, "email", "user@domain.com", at)
+		if err != nil {
+			t.Fatalf("%s failed: %e", name, err)
+		}
+		if target := ""; (bo == nil && expected[i] != "") || (bo != nil && bo.To != expected[i]) {
+			if bo != nil {
+				target = bo.To
+			}
+			t.Fatalf("%s failed - checkpoint #%d: expect %#v but received %#v", name, i, expected[i], target)
+		}
+	}
+}
+
+func _expectExpiry(t *testing.T, name string, bo *BoMapping, expected time.Time) {
+	// storage may truncate precision of timestamps
+	if bo.Expiry == nil || bo.Expiry.Sub(expected) > time.Second || expected.Sub(*bo.Expiry) > time.Second {
+		t.Fatalf("%s failed - expect mapping to expire at %s but received %#v", name, expected, bo.Expiry)
+	}
+}
+
+func _conformanceMapExpiry(t *testing.T, name string, dao IDaoMoMapping) {
+	expiry := time.Now().Add(time.Hour)
+	bo, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", &expiry, nil, nil)
+	if bo == nil || err != nil {
+		t.Fatalf("%s failed: %#v / %e", name, bo, err)
+	}
+	_expectExpiry(t, name, bo, expiry)
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "target1")
+	bo, _ = dao.FindTargetForObject(_testCtx, _testConformanceAppId, "email", "user@domain.com")
+	_expectExpiry(t, name, bo, expiry)
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target1", 1)
+}
+
+func _conformanceMapExpired(t *testing.T, name string, dao IDaoMoMapping) {
+	expiry := time.Now().Add(-time.Second)
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", &expiry, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "")
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target1", 0)
+	if ok, err := dao.Unmap(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1"); ok || err != nil {
+		t.Fatalf("%s failed - unmapping an expired mapping must do nothing: %#v / %e", name, ok, err)
+	}
+
+	// expired mapping does not block mapping the object to another target
+	bo, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target2", nil, nil, nil)
+	if bo == nil || err != nil || bo.To != "target2" || bo.Expiry != nil {
+		t.Fatalf("%s failed - expect object to be mapped to %#v: %#v / %e", name, "target2", bo, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "target2")
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target1", 0)
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target2", 1)
+}
+
+func _conformanceRemapKeepsExpiry(t *testing.T, name string, dao IDaoMoMapping) {
+	expiry := time.Now().Add(time.Hour)
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", &expiry, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Remap(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target2", "", nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "target2")
+	bo, _ := dao.FindTargetForObject(_testCtx, _testConformanceAppId, "email", "user@domain.com")
+	_expectExpiry(t, name, bo, expiry)
+}
+
+func _conformanceAllocateExpired(t *testing.T, name string, dao IDaoMoMapping) {
+	expired := time.Now().Add(-time.Second)
+	mapNsObj := map[string]string{"email": "user@domain.com", "mobile": "+84123456789"}
+	target1, err := dao.Allocate(_testCtx, _testConformanceAppId, mapNsObj, "target1", map[string]time.Time{"email": expired}, nil)
+	if target1 != "target1" || err != nil {
+		t.Fatalf("%s failed: %#v / %e", name, target1, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "")
+	_expectTarget(t, name, dao, _testConformanceAppId, "mobile", "+84123456789", "target1")
+
+	// expired mapping is replaced
+	target, err := dao.Allocate(_testCtx, _testConformanceAppId, map[string]string{"email": "user@domain.com"}, "target2", nil, nil)
+	if target != "target2" || err != nil {
+		t.Fatalf("%s failed - expect %#v but received %#v / %e", name, "target2", target, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user@domain.com", "target2")
+}
+
+func _conformanceSweepExpired(t *testing.T, name string, dao IDaoMoMapping) {
+	expired, live := time.Now().Add(-time.Second), time.Now().Add(time.Hour)
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "expired@domain.com", "target1", &expired, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "live@domain.com", "target1", &live, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "forever@domain.com", "target1", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	// backends relying on storage's own expiry mechanism may remove nothing
+	if numRemoved, err := dao.SweepExpired(_testCtx, _testConformanceAppId); err != nil || numRemoved > 1 {
+		t.Fatalf("%s failed: %#v / %e", name, numRemoved, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "expired@domain.com", "")
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "live@domain.com", "target1")
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "forever@domain.com", "target1")
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target1", 2)
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "expired@domain.com", "target2", nil, nil, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "expired@domain.com", "target2")
+}
+
+func _expectAttrs(t *testing.T, name string, bo *BoMapping, expected map[string]interface{}) {
+	if bo == nil || len(bo.Attrs) != len(expected) || (len(expected) > 0 && !reflect.DeepEqual(bo.Attrs, expected)) {
+		t.Fatalf("%s failed - expect attributes %#v but received %#v", name, expected, bo)
+	}
+}
+
+func _conformanceMapAttrs(t *testing.T, name string, dao IDaoMoMapping) {
+	attrs := map[string]interface{}{"source": "signup", "verified": true}
+	bo, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, attrs, nil)
+	if bo == nil || err != nil {
+		t.Fatalf("%s failed: %#v / %e", name, bo, err)
+	}
+	_expectAttrs(t, name, bo, attrs)
+	bo, _ = dao.FindTargetForObject(_testCtx, _testConformanceAppId, "email", "user@domain.com")
+	_expectAttrs(t, name, bo, attrs)
+	mappings, _ := dao.FindObjectsToTarget(_testCtx, _testConformanceAppId, "email", "target1")
+	if len(mappings) != 1 {
+		t.Fatalf("%s failed - expect 1 reverse mapping but received %#v", name, mappings)
+	}
+	_expectAttrs(t, name, mappings[0], attrs)
+
+	// mapping to the same target does not change attributes
+	bo, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, map[string]interface{}{"source": "other"}, nil)
+	_expectAttrs(t, name, bo, attrs)
+
+	bo, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "other@domain.com", "target1", nil, nil, nil)
+	_expectAttrs(t, name, bo, nil)
+}
+
+func _conformancePatchAttrs(t *testing.T, name string, dao IDaoMoMapping) {
+	if bo, err := dao.PatchAttrs(_testCtx, _testConformanceAppId, "email", "user@domain.com", map[string]interface{}{"a": "1"}); bo != nil || err != nil {
+		t.Fatalf("%s failed - patching an unmapped object must return nil: %#v / %e", name, bo, err)
+	}
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, map[string]interface{}{"a": "1", "b": "2"}, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	bo, err := dao.PatchAttrs(_testCtx, _testConformanceAppId, "email", "user@domain.com", map[string]interface{}{"a": nil, "b": "3", "c": "4"})
+	if bo == nil || err != nil || bo.To != "target1" {
+		t.Fatalf("%s failed: %#v / %e", name, bo, err)
+	}
+	expected := map[string]interface{}{"b": "3", "c": "4"}
+	_expectAttrs(t, name, bo, expected)
+	bo, _ = dao.FindTargetForObject(_testCtx, _testConformanceAppId, "email", "user@domain.com")
+	_expectAttrs(t, name, bo, expected)
+
+	bo, _ = dao.PatchAttrs(_testCtx, _testConformanceAppId, "email", "user@domain.com", map[string]interface{}{"b": nil, "c": nil})
+	_expectAttrs(t, name, bo, nil)
+	bo, _ = dao.FindTargetForObject(_testCtx, _testConformanceAppId, "email", "user@domain.com")
+	_expectAttrs(t, name, bo, nil)
+}
+
+func _conformanceRemapKeepsAttrs(t *testing.T, name string, dao IDaoMoMapping) {
+	attrs := map[string]interface{}{"source": "signup"}
+	if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target1", nil, attrs, nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	if _, err := dao.Remap(_testCtx, _testConformanceAppId, "email", "user@domain.com", "target2", "", nil); err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	bo, _ := dao.FindTargetForObject(_testCtx, _testConformanceAppId, "email", "user@domain.com")
+	if bo == nil || bo.To != "target2" {
+		t.Fatalf("%s failed - expect object to be remapped: %#v", name, bo)
+	}
+	_expectAttrs(t, name, bo, attrs)
+}
+
+func _conformanceFindTargetsForObjects(t *testing.T, name string, dao IDaoMoMapping) {
+	expired := time.Now().Add(-time.Second)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "user1@domain.com", "target1", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "user2@domain.com", "target2", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "expired@domain.com", "target3", &expired, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "mobile", "user3@domain.com", "target3", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceOtherAppId, "email", "user4@domain.com", "target4", nil, nil, nil)
+
+	mappings, err := dao.FindTargetsForObjects(_testCtx, _testConformanceAppId, "email",
+		[]string{"user1@domain.com", "user2@domain.com", "expired@domain.com", "user3@domain.com", "user4@domain.com", "none@domain.com"})
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	found := make(map[string]string)
+	for _, bo := range mappings {
+		found[bo.From] = bo.To
+	}
+	expected := map[string]string{"user1@domain.com": "target1", "user2@domain.com": "target2"}
+	if !reflect.DeepEqual(found, expected) {
+		t.Fatalf("%s failed - expect %#v but received %#v", name, expected, found)
+	}
+
+	if mappings, err := dao.FindTargetsForObjects(_testCtx, _testConformanceAppId, "email", nil); err != nil || len(mappings) != 0 {
+		t.Fatalf("%s failed - expect no mapping: %#v / %e", name, mappings, err)
+	}
+}
+
+func _conformanceMapMany(t *testing.T, name string, dao IDaoMoMapping) {
+	expired, expiry := time.Now().Add(-time.Second), time.Now().Add(time.Hour)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "mapped@domain.com", "target0", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "expired@domain.com", "target0", &expired, nil, nil)
+
+	items := []*BoMapping{
+		{Namespace: "EMAIL", From: "new@domain.com", To: " target1 ", Expiry: &expiry, Attrs: map[string]interface{}{"source": "import"}},
+		{Namespace: "email", From: "mapped@domain.com", To: "target0"},
+		{Namespace: "email", From: "mapped@domain.com", To: "target1"},
+		{Namespace: "email", From: "expired@domain.com", To: "target1"},
+		{Namespace: "mobile", From: "+84123456789", To: "target1"},
+		{Namespace: "mobile", From: "+84123456789", To: "target2"},
+	}
+	expected := []string{"target1", "target0", "target0", "target1", "target1", "target1"}
+	mappings, err := dao.MapMany(_testCtx, _testConformanceAppId, items, nil)
+	if err != nil || len(mappings) != len(items) {
+		t.Fatalf("%s failed: %#v / %e", name, mappings, err)
+	}
+	for i, bo := range mappings {
+		if bo == nil || bo.To != expected[i] {
+			t.Fatalf("%s failed - item #%d: expect %#v but received %#v", name, i, expected[i], bo)
+		}
+	}
+	if mappings[0].Namespace != "email" || mappings[0].From != "new@domain.com" {
+		t.Fatalf("%s failed - expect normalized namespace but received %#v", name, mappings[0])
+	}
+	bo, _ := dao.FindTargetForObject(_testCtx, _testConformanceAppId, "email", "new@domain.com")
+	_expectExpiry(t, name, bo, expiry)
+	_expectAttrs(t, name, bo, map[string]interface{}{"source": "import"})
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "expired@domain.com", "target1")
+	_expectTarget(t, name, dao, _testConformanceAppId, "mobile", "+84123456789", "target1")
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "email", "target1", 2)
+	_expectNumObjects(t, name, dao, _testConformanceAppId, "mobile", "target2", 0)
+
+	if history, err := dao.GetMappingHistory(_testCtx, _testConformanceAppId, "email", "new@domain.com"); err != nil || len(history) != 1 || history[0].Op != historyOpMap {
+		t.Fatalf("%s failed - expect 1 history entry: %#v / %e", name, history, err)
+	}
+	if mappings, err := dao.MapMany(_testCtx, _testConformanceAppId, nil, nil); err != nil || len(mappings) != 0 {
+		t.Fatalf("%s failed - expect no mapping: %#v / %e", name, mappings, err)
+	}
+}
+
+func _conformanceUnmapMany(t *testing.T, name string, dao IDaoMoMapping) {
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "user1@domain.com", "target1", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "user2@domain.com", "target2", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "mobile", "+84123456789", "target1", nil, nil, nil)
+
+	items := []*BoMapping{
+		{Namespace: "EMAIL", From: "user1@domain.com", To: "target1"},
+		{Namespace: "email", From: "user1@domain.com", To: "target1"},
+		{Namespace: "email", From: "user2@domain.com", To: "target1"},
+		{Namespace: "email", From: "none@domain.com", To: "target1"},
+		{Namespace: "mobile", From: "+84123456789", To: "target1"},
+	}
+	expected := []bool{true, false, false, false, true}
+	removed, err := dao.UnmapMany(_testCtx, _testConformanceAppId, items)
+	if err != nil || !reflect.DeepEqual(removed, expected) {
+		t.Fatalf("%s failed - expect %#v but received %#v / %e", name, expected, removed, err)
+	}
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user1@domain.com", "")
+	_expectTarget(t, name, dao, _testConformanceAppId, "email", "user2@domain.com", "target2")
+	_expectTarget(t, name, dao, _testConformanceAppId, "mobile", "+84123456789", "")
+
+	if history, err := dao.GetMappingHistory(_testCtx, _testConformanceAppId, "email", "user1@domain.com"); err != nil || len(history) != 2 || history[1].Op != historyOpUnmap {
+		t.Fatalf("%s failed - expect 2 history entries: %#v / %e", name, history, err)
+	}
+}
+
+func _expectPage(t *testing.T, name string, dao IDaoMoMapping, page PageRequest, expected []string) []*BoMapping {
+	mappings, err := dao.FindObjectsToTargetPage(_testCtx, _testConformanceAppId, "email", "target1", page)
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	objs := make([]string, 0)
+	for _, bo := range mappings {
+		objs = append(objs, bo.From)
+	}
+	if !reflect.DeepEqual(objs, expected) {
+		t.Fatalf("%s failed - expect %#v but received %#v", name, expected, objs)
+	}
+	return mappings
+}
+
+func _conformanceFindObjectsToTargetPage(t *testing.T, name string, dao IDaoMoMapping) {
+	// mapped in reverse alphabetical order, so that order by time differs from order by object
+	objs := []string{"e@domain.com", "d@domain.com", "c@domain.com", "b@domain.com", "a@domain.com"}
+	for _, obj := range objs {
+		if _, err := dao.Map(_testCtx, _testConformanceAppId, "email", obj, "target1", nil, nil, nil); err != nil {
+			t.Fatalf("%s failed: %e", name, err)
+		}
+		// storage may truncate precision of timestamps
+		time.Sleep(5 * time.Millisecond)
+	}
+	expired := time.Now().Add(-time.Second)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "expired@domain.com", "target1", &expired, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "other@domain.com", "target2", nil, nil, nil)
+
+	_expectPage(t, name, dao, PageRequest{}, objs)
+	page := _expectPage(t, name, dao, PageRequest{Limit: 2}, objs[0:2])
+	page = _expectPage(t, name, dao, PageRequest{Limit: 2, After: positionOf(page[1])}, objs[2:4])
+	page = _expectPage(t, name, dao, PageRequest{Limit: 2, After: positionOf(page[1])}, objs[4:5])
+	_expectPage(t, name, dao, PageRequest{Limit: 2, After: positionOf(page[0])}, []string{})
+
+	reversed := []string{"a@domain.com", "b@domain.com", "c@domain.com", "d@domain.com", "e@domain.com"}
+	page = _expectPage(t, name, dao, PageRequest{Limit: 3, Desc: true}, reversed[0:3])
+	_expectPage(t, name, dao, PageRequest{Limit: 3, Desc: true, After: positionOf(page[2])}, reversed[3:5])
+}
+
+func _conformanceCountObjectsToTarget(t *testing.T, name string, dao IDaoMoMapping) {
+	expired := time.Now().Add(-time.Second)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "user1@domain.com", "target1", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "user2@domain.com", "target1", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "expired@domain.com", "target1", &expired, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "mobile", "+84123456789", "target1", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceOtherAppId, "email", "user3@domain.com", "target1", nil, nil, nil)
+
+	for ns, expected := range map[string]int{"email": 2, "mobile": 1, "other": 0} {
+		if count, err := dao.CountObjectsToTarget(_testCtx, _testConformanceAppId, ns, "target1"); err != nil || count != expected {
+			t.Fatalf("%s failed - namespace %#v: expect %#v but received %#v / %e", name, ns, expected, count, err)
+		}
+	}
+}
+
+func _conformanceHasObjects(t *testing.T, name string, dao IDaoMoMapping) {
+	expired := time.Now().Add(-time.Second)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "user1@domain.com", "target1", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "mobile", "+84123456789", "target1", &expired, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceOtherAppId, "zalo", "zalo1", "target1", nil, nil, nil)
+
+	for ns, expected := range map[string]bool{"email": true, "EMAIL": true, "e": false, "mobile": false, "zalo": false} {
+		if has, err := dao.HasObjects(_testCtx, _testConformanceAppId, ns); err != nil || has != expected {
+			t.Fatalf("%s failed - namespace %#v: expect %#v but received %#v / %e", name, ns, expected, has, err)
+		}
+	}
+}
+
+func _conformanceFindAllObjectsToTarget(t *testing.T, name string, dao IDaoMoMapping) {
+	expired := time.Now().Add(-time.Second)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "e", "user0", "target1", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "user1@domain.com", "target1", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "user2@domain.com", "target10", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "expired@domain.com", "target1", &expired, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "facebook", "fb1", "target1", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "zalo", "zalo1", "target2", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceOtherAppId, "email", "user3@domain.com", "target1", nil, nil, nil)
+
+	mappings, err := dao.FindAllObjectsToTarget(_testCtx, _testConformanceAppId, "target1")
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+	found := make(map[string]string)
+	for _, bo := range mappings {
+		found[bo.Namespace+":"+bo.From] = bo.To
+	}
+	expected := map[string]string{"e:user0": "target1", "email:user1@domain.com": "target1", "facebook:fb1": "target1"}
+	if !reflect.DeepEqual(found, expected) {
+		t.Fatalf("%s failed: expect %#v but received %#v", name, expected, found)
+	}
+
+	if mappings, err = dao.FindAllObjectsToTarget(_testCtx, _testConformanceAppId, "not-exist"); err != nil || len(mappings) != 0 {
+		t.Fatalf("%s failed: expect no mapping but received %#v / %e", name, mappings, err)
+	}
+}
+
+func _conformanceTranslateObject(t *testing.T, name string, dao IDaoMoMapping) {
+	expired := time.Now().Add(-time.Second)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "user1@domain.com", "target1", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "user2@domain.com", "target1", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "facebook", "fb1", "target1", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "facebook", "fb2", "target2", nil, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "zalo", "expired", "target1", &expired, nil, nil)
+	_, _ = dao.Map(_testCtx, _testConformanceAppId, "email", "expired@domain.com", "target1", &expired, nil, nil)
+
+	mapping, mappings, err := dao.TranslateObject(_testCtx, _testConformanceAppId, "email", "user1@domain.com", []string{"facebook", "zalo", "email"})
+	if err != nil || mapping == nil || mapping.Namespace != "email" || mapping.From != "user1@domain.com" || mapping.To != "target1" {
+		t.Fatalf("%s failed: unexpected mapping %#v / %e", name, mapping, err)
+	}
+	found := make(map[string]string)
+	for _, bo := range mappings {
+		found[bo.Namespace+":"+bo.From] = bo.To
+	}
+	expected := map[string]string{"facebook:fb1": "target1", "email:user1@domain.com": "target1", "email:user2@domain.com": "target1"}
+	if !reflect.DeepEqual(found, expected) {
+		t.Fatalf("%s failed: expect %#v but received %#v", name, expected, found)
+	}
+
+	for _, obj := range []string{"not-exist@domain.com", "expired@domain.com"} {
+		if mapping, mappings, err = dao.TranslateObject(_testCtx, _testConformanceAppId, "email", obj, []string{"facebook"}); err != nil || mapping != nil || len(mappings) != 0 {
+			t.Fatalf("%s failed - object %#v: expect no mapping but received %#v / %#v / %e", name, obj, mapping, mappings, err)
+		}
+	}
+}
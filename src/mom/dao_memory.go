@@ -0,0 +1,664 @@
+package mom
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+MOM's DAO implementation: in-memory storage, suitable for development and tests.
+
+Data is lost when the process exits.
+
+@author Thanh Nguyen <btnguyen2k@gmail.com>
+@since 0.1.0
+*/
+
+func NewMemoryDaoMoMapping() IDaoMoMapping {
+	return &MemoryDaoMoMapping{storages: map[string]*memoryMappingStorage{}}
+}
+
+// memoryMappingStorage holds all mappings of an app
+type memoryMappingStorage struct {
+	forward map[string]map[string]*BoMapping            // {namespace: {object: mapping}}
+	reverse map[string]map[string]map[string]*BoMapping // {namespace: {target: {object: mapping}}}
+	history map[string]map[string][]*BoMappingHistory   // {namespace: {object: [history entries]}}
+}
+
+func newMemoryMappingStorage() *memoryMappingStorage {
+	return &memoryMappingStorage{
+		forward: map[string]map[string]*BoMapping{},
+		reverse: map[string]map[string]map[string]*BoMapping{},
+		history: map[string]map[string][]*BoMappingHistory{},
+	}
+}
+
+// get returns the stored mapping of an object, or nil if the object has not mapped to any target or the mapping has
+// expired.
+func (s *memoryMappingStorage) get(namespace, from string) *BoMapping {
+	if objs, ok := s.forward[namespace]; ok {
+		return liveMapping(objs[from])
+	}
+	return nil
+}
+
+// put stores a mapping, replacing the object's existing (possibly expired) mapping.
+func (s *memoryMappingStorage) put(bo *BoMapping) {
+	if existing, ok := s.forward[bo.Namespace][bo.From]; ok {
+		s.remove(existing)
+	}
+	if _, ok := s.forward[bo.Namespace]; !ok {
+		s.forward[bo.Namespace] = map[string]*BoMapping{}
+	}
+	s.forward[bo.Namespace][bo.From] = bo
+	if _, ok := s.reverse[bo.Namespace]; !ok {
+		s.reverse[bo.Namespace] = map[string]map[string]*BoMapping{}
+	}
+	if _, ok := s.reverse[bo.Namespace][bo.To]; !ok {
+		s.reverse[bo.Namespace][bo.To] = map[string]*BoMapping{}
+	}
+	s.reverse[bo.Namespace][bo.To][bo.From] = bo
+}
+
+func (s *memoryMappingStorage) remove(bo *BoMapping) {
+	delete(s.forward[bo.Namespace], bo.From)
+	if targets, ok := s.reverse[bo.Namespace]; ok {
+		delete(targets[bo.To], bo.From)
+		if len(targets[bo.To]) == 0 {
+			delete(targets, bo.To)
+		}
+	}
+}
+
+// record appends a history entry for a change of a mapping.
+func (s *memoryMappingStorage) record(op string, bo *BoMapping, prevTo string) {
+	entry := newMappingHistory(op, bo, prevTo)
+	if entry == nil {
+		return
+	}
+	if _, ok := s.history[entry.Namespace]; !ok {
+		s.history[entry.Namespace] = map[string][]*BoMappingHistory{}
+	}
+	s.history[entry.Namespace][entry.From] = append(s.history[entry.Namespace][entry.From], entry)
+}
+
+// findByTarget returns all live mappings to a target, across all namespaces.
+func (s *memoryMappingStorage) findByTarget(target string) []*BoMapping {
+	result := make([]*BoMapping, 0)
+	for _, targets := range s.reverse {
+		for _, bo := range targets[target] {
+			result = append(result, bo)
+		}
+	}
+	return liveMappings(result)
+}
+
+/*
+MemoryDaoMoMapping is in-memory implementation of IDaoMoMapping.
+*/
+type MemoryDaoMoMapping struct {
+	lock     sync.RWMutex
+	storages map[string]*memoryMappingStorage // {appId: storage}
+}
+
+// getStorage returns the storage of an app, creating a new one if 'create' is true.
+//
+// Caller must hold the lock.
+func (dao *MemoryDaoMoMapping) getStorage(appId string, create bool) *memoryMappingStorage {
+	storage, ok := dao.storages[appId]
+	if !ok && create {
+		storage = newMemoryMappingStorage()
+		dao.storages[appId] = storage
+	}
+	return storage
+}
+
+// cloneMapping returns a copy of a mapping so that callers can not modify stored data.
+func cloneMapping(bo *BoMapping) *BoMapping {
+	if bo == nil {
+		return nil
+	}
+	clone := *bo
+	if bo.Attrs != nil {
+		clone.Attrs = patchAttrs(bo.Attrs, nil)
+	}
+	return &clone
+}
+
+/*
+InitStorage implements IDaoMoMapping.InitStorage
+*/
+func (dao *MemoryDaoMoMapping) InitStorage(_ context.Context, appId string) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	dao.getStorage(appId, true)
+	return nil
+}
+
+/*
+DestroyStorage implements IDaoMoMapping.DestroyStorage
+*/
+func (dao *MemoryDaoMoMapping) DestroyStorage(_ context.Context, appId string) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	delete(dao.storages, appId)
+	return nil
+}
+
+/*
+FindTargetForObject implements IDaoMoMapping.FindTargetForObject
+*/
+func (dao *MemoryDaoMoMapping) FindTargetForObject(_ context.Context, appId, namespace, from string) (*BoMapping, error) {
+	dao.lock.RLock()
+	defer dao.lock.RUnlock()
+	storage := dao.getStorage(appId, false)
+	if storage == nil {
+		return nil, nil
+	}
+	return cloneMapping(storage.get(normalizeNamespace(namespace), from)), nil
+}
+
+/*
+FindTargetsForObjects implements IDaoMoMapping.FindTargetsForObjects
+*/
+func (dao *MemoryDaoMoMapping) FindTargetsForObjects(_ context.Context, appId, namespace string, objects []string) ([]*BoMapping, error) {
+	dao.lock.RLock()
+	defer dao.lock.RUnlock()
+	result := make([]*BoMapping, 0)
+	storage := dao.getStorage(appId, false)
+	if storage == nil {
+		return result, nil
+	}
+	for _, from := range objects {
+		if bo := storage.get(normalizeNamespace(namespace), from); bo != nil {
+			result = append(result, cloneMapping(bo))
+		}
+	}
+	return result, nil
+}
+
+// findObjectsToTarget returns live mappings of direction {target <- objects}, unsorted.
+//
+// Caller must hold the lock.
+func (dao *MemoryDaoMoMapping) findObjectsToTarget(appId, namespace, to string) []*BoMapping {
+	result := make([]*BoMapping, 0)
+	storage := dao.getStorage(appId, false)
+	if storage == nil {
+		return result
+	}
+	if targets, ok := storage.reverse[normalizeNamespace(namespace)]; ok {
+		for _, bo := range targets[normalizeMappingTarget(to)] {
+			result = append(result, cloneMapping(bo))
+		}
+	}
+	return liveMappings(result)
+}
+
+// targetFinder returns the function looking up live mappings to a target, for checkUniqueTargets.
+//
+// Caller must hold the lock.
+func (dao *MemoryDaoMoMapping) targetFinder(appId string) func(namespace, target string) ([]*BoMapping, error) {
+	return func(namespace, target string) ([]*BoMapping, error) {
+		return dao.findObjectsToTarget(appId, namespace, target), nil
+	}
+}
+
+/*
+FindObjectsToTargetPage implements IDaoMoMapping.FindObjectsToTargetPage
+*/
+func (dao *MemoryDaoMoMapping) FindObjectsToTargetPage(_ context.Context, appId, namespace, to string, page PageRequest) ([]*BoMapping, error) {
+	dao.lock.RLock()
+	defer dao.lock.RUnlock()
+	return pageMappings(dao.findObjectsToTarget(appId, namespace, to), page), nil
+}
+
+/*
+FindAllObjectsToTarget implements IDaoMoMapping.FindAllObjectsToTarget
+*/
+func (dao *MemoryDaoMoMapping) FindAllObjectsToTarget(_ context.Context, appId, to string) ([]*BoMapping, error) {
+	dao.lock.RLock()
+	defer dao.lock.RUnlock()
+	result := make([]*BoMapping, 0)
+	storage := dao.getStorage(appId, false)
+	if storage == nil {
+		return result, nil
+	}
+	for _, bo := range storage.findByTarget(normalizeMappingTarget(to)) {
+		result = append(result, cloneMapping(bo))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Namespace < result[j].Namespace || (result[i].Namespace == result[j].Namespace && result[i].From < result[j].From)
+	})
+	return result, nil
+}
+
+/*
+TranslateObject implements IDaoMoMapping.TranslateObject
+*/
+func (dao *MemoryDaoMoMapping) TranslateObject(_ context.Context, appId, namespace, from string, targetNamespaces []string) (*BoMapping, []*BoMapping, error) {
+	dao.lock.RLock()
+	defer dao.lock.RUnlock()
+	result := make([]*BoMapping, 0)
+	storage := dao.getStorage(appId, false)
+	if storage == nil {
+		return nil, result, nil
+	}
+	mapping := cloneMapping(storage.get(normalizeNamespace(namespace), from))
+	if mapping == nil {
+		return nil, result, nil
+	}
+	for _, ns := range targetNamespaces {
+		result = append(result, dao.findObjectsToTarget(appId, ns, mapping.To)...)
+	}
+	return mapping, result, nil
+}
+
+/*
+CountObjectsToTarget implements IDaoMoMapping.CountObjectsToTarget
+*/
+func (dao *MemoryDaoMoMapping) CountObjectsToTarget(_ context.Context, appId, namespace, to string) (int, error) {
+	dao.lock.RLock()
+	defer dao.lock.RUnlock()
+	return len(dao.findObjectsToTarget(appId, namespace, to)), nil
+}
+
+/*
+HasObjects implements IDaoMoMapping.HasObjects
+*/
+func (dao *MemoryDaoMoMapping) HasObjects(_ context.Context, appId, namespace string) (bool, error) {
+	dao.lock.RLock()
+	defer dao.lock.RUnlock()
+	storage := dao.getStorage(appId, false)
+	if storage == nil {
+		return false, nil
+	}
+	now := time.Now()
+	for _, bo := range storage.forward[normalizeNamespace(namespace)] {
+		if !bo.isExpired(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+/*
+FindObjectsToTarget implements IDaoMoMapping.FindObjectsToTarget
+*/
+func (dao *MemoryDaoMoMapping) FindObjectsToTarget(_ context.Context, appId, namespace, to string) ([]*BoMapping, error) {
+	dao.lock.RLock()
+	defer dao.lock.RUnlock()
+	result := dao.findObjectsToTarget(appId, namespace, to)
+	sort.Slice(result, func(i, j int) bool { return result[i].From < result[j].From })
+	return result, nil
+}
+
+/*
+Map implements IDaoMoMapping.Map
+*/
+func (dao *MemoryDaoMoMapping) Map(_ context.Context, appId, namespace, object, target string, expiry *time.Time, attrs map[string]interface{}, uniqueNamespaces []string) (*BoMapping, error) {
+	bo := &BoMapping{
+		Namespace: normalizeNamespace(namespace),
+		From:      object,
+		To:        normalizeMappingTarget(target),
+		Time:      time.Now(),
+		AppId:     appId,
+		Expiry:    expiry,
+		Attrs:     patchAttrs(nil, attrs),
+	}
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	storage := dao.getStorage(appId, true)
+	if existing := storage.get(bo.Namespace, bo.From); existing != nil {
+		return checkMappedTarget(cloneMapping(existing), bo)
+	}
+	if err := checkUniqueTargets([]*BoMapping{bo}, uniqueNamespaces, dao.targetFinder(appId)); err != nil {
+		return nil, err
+	}
+	storage.put(cloneMapping(bo))
+	storage.record(historyOpMap, bo, "")
+	return bo, nil
+}
+
+/*
+MapMany implements IDaoMoMapping.MapMany
+*/
+func (dao *MemoryDaoMoMapping) MapMany(_ context.Context, appId string, items []*BoMapping, uniqueNamespaces []string) ([]*BoMapping, error) {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	storage := dao.getStorage(appId, true)
+	return mapManyUnique(normalizeBatchItems(appId, items, time.Now()), uniqueNamespaces, dao.targetFinder(appId),
+		func(bos []*BoMapping) ([]*BoMapping, error) {
+			result := make([]*BoMapping, len(bos))
+			for i, bo := range bos {
+				if existing := storage.get(bo.Namespace, bo.From); existing != nil {
+					result[i] = cloneMapping(existing)
+					continue
+				}
+				storage.put(cloneMapping(bo))
+				storage.record(historyOpMap, bo, "")
+				result[i] = bo
+			}
+			return result, nil
+		})
+}
+
+/*
+PatchAttrs implements IDaoMoMapping.PatchAttrs
+*/
+func (dao *MemoryDaoMoMapping) PatchAttrs(_ context.Context, appId, namespace, object string, patch map[string]interface{}) (*BoMapping, error) {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	storage := dao.getStorage(appId, false)
+	if storage == nil {
+		return nil, nil
+	}
+	existing := storage.get(normalizeNamespace(namespace), object)
+	if existing == nil {
+		return nil, nil
+	}
+	bo := cloneMapping(existing)
+	bo.Attrs = patchAttrs(existing.Attrs, patch)
+	storage.put(bo)
+	return cloneMapping(bo), nil
+}
+
+/*
+Unmap implements IDaoMoMapping.Unmap
+*/
+func (dao *MemoryDaoMoMapping) Unmap(_ context.Context, appId, namespace, object, target string) (bool, error) {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	storage := dao.getStorage(appId, false)
+	if storage == nil {
+		return false, nil
+	}
+	existing := storage.get(normalizeNamespace(namespace), object)
+	if existing == nil || existing.To != normalizeMappingTarget(target) {
+		return false, nil
+	}
+	storage.remove(existing)
+	storage.record(historyOpUnmap, existing, existing.To)
+	return true, nil
+}
+
+/*
+UnmapMany implements IDaoMoMapping.UnmapMany
+*/
+func (dao *MemoryDaoMoMapping) UnmapMany(_ context.Context, appId string, items []*BoMapping) ([]bool, error) {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	result := make([]bool, len(items))
+	storage := dao.getStorage(appId, false)
+	if storage == nil {
+		return result, nil
+	}
+	for i, bo := range normalizeBatchItems(appId, items, time.Time{}) {
+		existing := storage.get(bo.Namespace, bo.From)
+		if existing == nil || existing.To != bo.To {
+			continue
+		}
+		storage.remove(existing)
+		storage.record(historyOpUnmap, existing, existing.To)
+		result[i] = true
+	}
+	return result, nil
+}
+
+/*
+Remap implements IDaoMoMapping.Remap
+*/
+func (dao *MemoryDaoMoMapping) Remap(ctx context.Context, appId, namespace, object, target, expectedTarget string, uniqueNamespaces []string) (*BoMapping, error) {
+	bo := &BoMapping{
+		Namespace: normalizeNamespace(namespace),
+		From:      object,
+		To:        normalizeMappingTarget(target),
+		Time:      time.Now(),
+		AppId:     appId,
+	}
+	if expectedTarget != "" {
+		expectedTarget = normalizeMappingTarget(expectedTarget)
+	}
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	storage := dao.getStorage(appId, false)
+	if storage == nil {
+		return nil, nil
+	}
+	return compareAndRemap(ctx, bo, expectedTarget,
+		func() (*BoMapping, error) { return cloneMapping(storage.get(bo.Namespace, bo.From)), nil },
+		func(currentTarget string) (bool, error) {
+			if err := checkUniqueTargets([]*BoMapping{bo}, uniqueNamespaces, dao.targetFinder(appId)); err != nil {
+				return false, err
+			}
+			storage.put(cloneMapping(bo))
+			storage.record(historyOpRemap, bo, currentTarget)
+			return true, nil
+		})
+}
+
+/*
+MergeTargets implements IDaoMoMapping.MergeTargets
+*/
+func (dao *MemoryDaoMoMapping) MergeTargets(_ context.Context, appId, from, into string, uniqueNamespaces []string) ([]*BoMapping, error) {
+	from, into = normalizeMappingTarget(from), normalizeMappingTarget(into)
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	storage := dao.getStorage(appId, false)
+	if storage == nil {
+		return make([]*BoMapping, 0), nil
+	}
+	fromMappings := storage.findByTarget(from)
+	moved, err := planMergeTargets(fromMappings, storage.findByTarget(into), into, uniqueNamespaces)
+	if err != nil {
+		return nil, err
+	}
+	for _, bo := range fromMappings {
+		storage.remove(bo)
+	}
+	result := make([]*BoMapping, 0, len(moved))
+	for _, bo := range moved {
+		storage.put(bo)
+		storage.record(historyOpRemap, bo, from)
+		result = append(result, cloneMapping(bo))
+	}
+	if len(fromMappings) > 0 {
+		storage.put(newTargetAlias(appId, from, into, time.Now()))
+	}
+	return result, nil
+}
+
+/*
+SplitTarget implements IDaoMoMapping.SplitTarget
+*/
+func (dao *MemoryDaoMoMapping) SplitTarget(_ context.Context, appId, from string, mapNsObj map[string]string, into string, uniqueNamespaces []string) ([]*BoMapping, error) {
+	from, into = normalizeMappingTarget(from), normalizeMappingTarget(into)
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	storage := dao.getStorage(appId, false)
+	moved, err := planSplitTarget(appId, from, mapNsObj, into, uniqueNamespaces, func(namespace, object string) (*BoMapping, error) {
+		if storage == nil {
+			return nil, nil
+		}
+		return storage.get(namespace, object), nil
+	}, dao.targetFinder(appId))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*BoMapping, 0, len(moved))
+	for _, bo := range moved {
+		storage.put(bo)
+		storage.record(historyOpRemap, bo, from)
+		result = append(result, cloneMapping(bo))
+	}
+	return result, nil
+}
+
+/*
+GetMappingHistory implements IDaoMoMapping.GetMappingHistory
+*/
+func (dao *MemoryDaoMoMapping) GetMappingHistory(_ context.Context, appId, namespace, from string) ([]*BoMappingHistory, error) {
+	dao.lock.RLock()
+	defer dao.lock.RUnlock()
+	result := make([]*BoMappingHistory, 0)
+	storage := dao.getStorage(appId, false)
+	if storage == nil {
+		return result, nil
+	}
+	for _, entry := range storage.history[normalizeNamespace(namespace)][from] {
+		clone := *entry
+		result = append(result, &clone)
+	}
+	return sortMappingHistory(result), nil
+}
+
+/*
+Allocate implements IDaoMoMapping.Allocate
+*/
+func (dao *MemoryDaoMoMapping) Allocate(_ context.Context, appId string, mapNsObj map[string]string, target string, expiries map[string]time.Time, uniqueNamespaces []string) (string, error) {
+	if mapNsObj == nil || len(mapNsObj) == 0 {
+		return "", nil
+	}
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	storage := dao.getStorage(appId, true)
+	var existingTarget = ""
+	var objsToMap = make([]*BoMapping, 0)
+	for ns, obj := range mapNsObj {
+		mapping := storage.get(normalizeNamespace(ns), obj)
+		if mapping != nil {
+			if existingTarget == "" {
+				existingTarget = mapping.To
+			} else if existingTarget != mapping.To {
+				return "", newAllocateConflictError(existingTarget, mapping.To)
+			}
+		} else {
+			objsToMap = append(objsToMap, &BoMapping{
+				Namespace: normalizeNamespace(ns),
+				From:      obj,
+				AppId:     appId,
+				Expiry:    expiryOf(expiries, normalizeNamespace(ns)),
+			})
+		}
+	}
+	var finalTarget = target
+	if existingTarget != "" {
+		finalTarget = existingTarget
+	}
+	for _, mapping := range objsToMap {
+		mapping.To = finalTarget
+		mapping.Time = time.Now()
+	}
+	if err := checkUniqueTargets(objsToMap, uniqueNamespaces, dao.targetFinder(appId)); err != nil {
+		return "", err
+	}
+	for _, mapping := range objsToMap {
+		storage.put(mapping)
+		storage.record(historyOpMap, mapping, "")
+	}
+	return finalTarget, nil
+}
+
+/*
+SweepExpired implements IDaoMoMapping.SweepExpired
+*/
+func (dao *MemoryDaoMoMapping) SweepExpired(_ context.Context, appId string) (int, error) {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	storage := dao.getStorage(appId, false)
+	if storage == nil {
+		return 0, nil
+	}
+	now := time.Now()
+	var expired []*BoMapping
+	for _, objs := range storage.forward {
+		for _, bo := range objs {
+			if bo.isExpired(now) {
+				expired = append(expired, bo)
+			}
+		}
+	}
+	for _, bo := range expired {
+		storage.remove(bo)
+	}
+	return len(expired), nil
+}
+
+/*----------------------------------------------------------------------*/
+
+func NewMemoryDaoApp() IDaoApp {
+	return &MemoryDaoApp{apps: map[string]*BoApp{}}
+}
+
+/*
+MemoryDaoApp is in-memory implementation of IDaoApp.
+*/
+type MemoryDaoApp struct {
+	lock sync.RWMutex
+	apps map[string]*BoApp
+}
+
+// Create implements IDaoApp.Create
+func (dao *MemoryDaoApp) Create(bo *BoApp) (bool, error) {
+	if bo == nil {
+		return false, nil
+	}
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	if _, ok := dao.apps[bo.Id]; ok {
+		return false, nil
+	}
+	dao.apps[bo.Id] = bo.Clone()
+	return true, nil
+}
+
+// Get implements IDaoApp.Get
+func (dao *MemoryDaoApp) Get(id string) (*BoApp, error) {
+	dao.lock.RLock()
+	defer dao.lock.RUnlock()
+	if bo, ok := dao.apps[id]; ok {
+		return bo.Clone(), nil
+	}
+	return nil, nil
+}
+
+// GetAll implements IDaoApp.GetAll
+func (dao *MemoryDaoApp) GetAll() ([]*BoApp, error) {
+	dao.lock.RLock()
+	defer dao.lock.RUnlock()
+	result := make([]*BoApp, 0)
+	for _, bo := range dao.apps {
+		result = append(result, bo.Clone())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Id < result[j].Id })
+	return result, nil
+}
+
+// Update implements IDaoApp.Update
+func (dao *MemoryDaoApp) Update(bo *BoApp) (bool, error) {
+	if bo == nil {
+		return false, nil
+	}
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	if _, ok := dao.apps[bo.Id]; !ok {
+		return false, nil
+	}
+	dao.apps[bo.Id] = bo.Clone()
+	return true, nil
+}
+
+// Delete implements IDaoApp.Delete
+func (dao *MemoryDaoApp) Delete(bo *BoApp) (bool, error) {
+	if bo == nil {
+		return false, nil
+	}
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	if _, ok := dao.apps[bo.Id]; !ok {
+		return false, nil
+	}
+	delete(dao.apps, bo.Id)
+	return true, nil
+}
@@ -0,0 +1,56 @@
+package mom
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryDaoMoMapping_InitStorage(t *testing.T) {
+	name := "TestMemoryDaoMoMapping_InitStorage"
+	dao := NewMemoryDaoMoMapping()
+	err := dao.InitStorage(_testCtx, _testAppId)
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+}
+
+func TestMemoryDaoMoMapping_DestroyStorage(t *testing.T) {
+	name := "TestMemoryDaoMoMapping_DestroyStorage"
+	dao := NewMemoryDaoMoMapping()
+	err := dao.DestroyStorage(_testCtx, _testAppId)
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+}
+
+func TestMemoryDaoMoMapping_SweepExpired(t *testing.T) {
+	name := "TestMemoryDaoMoMapping_SweepExpired"
+	dao := NewMemoryDaoMoMapping()
+	expired, live := time.Now().Add(-time.Second), time.Now().Add(time.Hour)
+	dao.Map(_testCtx, _testAppId, "email", "expired@domain.com", "target", &expired, nil, nil)
+	dao.Map(_testCtx, _testAppId, "email", "live@domain.com", "target", &live, nil, nil)
+	if numRemoved, err := dao.SweepExpired(_testCtx, _testAppId); numRemoved != 1 || err != nil {
+		t.Fatalf("%s failed - expect 1 mapping removed but received %#v / %e", name, numRemoved, err)
+	}
+	storage := dao.(*MemoryDaoMoMapping).getStorage(_testAppId, false)
+	if _, ok := storage.forward["email"]["expired@domain.com"]; ok {
+		t.Fatalf("%s failed - expired mapping must be removed from storage", name)
+	}
+	if numRemoved, err := dao.SweepExpired(_testCtx, _testAppId); numRemoved != 0 || err != nil {
+		t.Fatalf("%s failed - expect nothing removed but received %#v / %e", name, numRemoved, err)
+	}
+}
+
+/*----------------------------------------------------------------------*/
+
+func TestMemoryDaoApp_Conformance(t *testing.T) {
+	testDaoAppConformance(t, func(t *testing.T) (IDaoApp, func()) {
+		return NewMemoryDaoApp(), nil
+	})
+}
+
+func TestMemoryDaoMoMapping_Conformance(t *testing.T) {
+	testDaoMoMappingConformance(t, func(t *testing.T) (IDaoMoMapping, func()) {
+		return NewMemoryDaoMoMapping(), nil
+	})
+}
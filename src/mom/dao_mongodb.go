@@ -15,6 +15,7 @@ import (
 	"log"
 	"main/src/goems"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -30,6 +31,18 @@ const (
 	collectionTemplateMom = "${collection}_${app}"
 	baseCollectionMom     = "mom"
 	_fieldId              = "_id"
+	// BSON date copy of a mapping's expiry, watched by TTL index "idx_ttl"
+	_fieldExpireAt = "expireAt"
+	// BSON date copy of a mapping's time, used to sort mappings by time (field 't' is a string)
+	_fieldTime = "time"
+
+	// Allocate runs inside a multi-document transaction (requires replica-set or sharded cluster)
+	allocateStrategyTransaction = "transaction"
+	// Allocate relies on unique index "uidx_from" with optimistic insert-verify-and-retry (works on standalone mongod)
+	allocateStrategyOptimistic = "optimistic"
+
+	// maximum number of attempts of optimistic Allocate before giving up
+	optimisticAllocateMaxAttempts = 5
 )
 
 // construct an 'prom.MongoConnect' instance
@@ -47,8 +60,20 @@ func createMongoConnect() *prom.MongoConnect {
 	return mongoConnect
 }
 
-func NewMongodbDaoMoMapping(mongoConnect *prom.MongoConnect, baseCollectionName string) IDaoMoMapping {
-	dao := &MongodbDaoMoMapping{baseCollectionName: baseCollectionName, collectionInitCache: map[string]bool{}}
+/*
+NewMongodbDaoMoMapping creates a new MongoDB implementation of IDaoMoMapping.
+
+	- allocateStrategy: either "transaction" (default) or "optimistic" (for standalone mongod that does not support transactions)
+*/
+func NewMongodbDaoMoMapping(mongoConnect *prom.MongoConnect, baseCollectionName, allocateStrategy string) IDaoMoMapping {
+	if !strings.EqualFold(allocateStrategy, allocateStrategyOptimistic) {
+		allocateStrategy = allocateStrategyTransaction
+	}
+	dao := &MongodbDaoMoMapping{
+		baseCollectionName:  baseCollectionName,
+		collectionInitCache: map[string]bool{},
+		allocateStrategy:    strings.ToLower(allocateStrategy),
+	}
 	dao.GenericDaoMongo = mongo.NewGenericDaoMongo(mongoConnect, godal.NewAbstractGenericDao(dao))
 	dao.SetTransactionMode(true)
 	return dao
@@ -58,6 +83,8 @@ type MongodbDaoMoMapping struct {
 	*mongo.GenericDaoMongo
 	baseCollectionName  string // name of collection store data
 	collectionInitCache map[string]bool
+	cacheLock           sync.Mutex
+	allocateStrategy    string // either "transaction" or "optimistic"
 }
 
 func (dao *MongodbDaoMoMapping) calcCollectionName(appId string) string {
@@ -66,37 +93,113 @@ func (dao *MongodbDaoMoMapping) calcCollectionName(appId string) string {
 	return collectionName
 }
 
+// isCollectionInitialized checks if a collection has been initialized by this DAO instance.
+func (dao *MongodbDaoMoMapping) isCollectionInitialized(collectionName string) bool {
+	dao.cacheLock.Lock()
+	defer dao.cacheLock.Unlock()
+	return dao.collectionInitCache[collectionName]
+}
+
+// setCollectionInitialized marks a collection as initialized (or not).
+func (dao *MongodbDaoMoMapping) setCollectionInitialized(collectionName string, initialized bool) {
+	dao.cacheLock.Lock()
+	defer dao.cacheLock.Unlock()
+	if initialized {
+		dao.collectionInitCache[collectionName] = true
+	} else {
+		delete(dao.collectionInitCache, collectionName)
+	}
+}
+
+// calcHistoryCollectionName returns name of the collection that stores mapping history of an app.
+func (dao *MongodbDaoMoMapping) calcHistoryCollectionName(appId string) string {
+	return dao.calcCollectionName(appId) + "_history"
+}
+
+// ensureHistoryCollection creates the mapping history collection of an app if it does not exist.
+//
+// Apps created before mapping history was introduced have no history collection, hence it is created lazily. The
+// collection must exist before being written inside a transaction.
+func (dao *MongodbDaoMoMapping) ensureHistoryCollection(appId string) error {
+	return dao.ensureCollection(dao.calcHistoryCollectionName(appId), []interface{}{
+		map[string]interface{}{
+			"key": map[string]interface{}{
+				fieldMapNamespace: 1,
+				fieldMapFrom:      1,
+			},
+			"name": "idx_from",
+		},
+	})
+}
+
+// calcClaimCollectionName returns name of the collection that stores claims of targets in unique namespaces of an app
+// (see doClaimTargets).
+func (dao *MongodbDaoMoMapping) calcClaimCollectionName(appId string) string {
+	return dao.calcCollectionName(appId) + "_claims"
+}
+
+// ensureCollection creates a collection along with its indexes if it does not exist.
+func (dao *MongodbDaoMoMapping) ensureCollection(collectionName string, indexes []interface{}) error {
+	if dao.isCollectionInitialized(collectionName) {
+		return nil
+	}
+	exists, err := dao.GetMongoConnect().HasCollection(collectionName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if dbResult, err := dao.GetMongoConnect().CreateCollection(collectionName); err != nil || dbResult.Err() != nil {
+			if err == nil {
+				err = dbResult.Err()
+			}
+			log.Printf("Error while creating collection %s: %e", collectionName, err)
+			return err
+		}
+		if len(indexes) > 0 {
+			if _, err = dao.GetMongoConnect().CreateCollectionIndexes(collectionName, indexes); err != nil {
+				log.Printf("Error while creating indexes on collection %s: %e", collectionName, err)
+				return err
+			}
+		}
+	}
+	dao.setCollectionInitialized(collectionName, true)
+	return nil
+}
+
 /*
 InitStorage implements IDaoMoMapping.IDaoMoMapping
 */
-func (dao *MongodbDaoMoMapping) InitStorage(appId string) error {
+func (dao *MongodbDaoMoMapping) InitStorage(ctx context.Context, appId string) error {
+	if err := dao.ensureHistoryCollection(appId); err != nil {
+		return err
+	}
+	if err := dao.ensureCollection(dao.calcClaimCollectionName(appId), nil); err != nil {
+		return err
+	}
 	collectionName := dao.calcCollectionName(appId)
-	exists := dao.collectionInitCache[collectionName]
-	if exists {
+	if dao.isCollectionInitialized(collectionName) {
 		return nil
 	}
-	if exists, err := dao.GetMongoConnect().HasCollection(collectionName); exists || err != nil {
-		if err != nil {
-			return err
-		}
-		dao.collectionInitCache[collectionName] = true
-		return nil
+	exists, err := dao.GetMongoConnect().HasCollection(collectionName)
+	if err != nil {
+		return err
 	}
 
 	// create collection if not exists
-	dbResult, err := dao.GetMongoConnect().CreateCollection(collectionName)
-	if err != nil || dbResult.Err() != nil {
-		if err != nil {
-			log.Printf("Error while creating collection %s: %e", collectionName, err)
-			return err
+	if !exists {
+		dbResult, err := dao.GetMongoConnect().CreateCollection(collectionName)
+		if err != nil || dbResult.Err() != nil {
+			if err != nil {
+				log.Printf("Error while creating collection %s: %e", collectionName, err)
+				return err
+			} else {
+				log.Printf("Error while creating collection %s: %e", collectionName, dbResult.Err())
+				return dbResult.Err()
+			}
 		} else {
-			log.Printf("Error while creating collection %s: %e", collectionName, dbResult.Err())
-			return dbResult.Err()
+			log.Printf("Created collection %s", collectionName)
 		}
-	} else {
-		log.Printf("Created collection %s", collectionName)
 	}
-	dao.collectionInitCache[collectionName] = true
 	// count := 0
 	// for ok, err := dao.GetMongoConnect().HasCollection(collectionName); !ok && count < 3; count++ {
 	// 	if err != nil {
@@ -105,7 +208,7 @@ func (dao *MongodbDaoMoMapping) InitStorage(appId string) error {
 	// 	ok, err = dao.GetMongoConnect().HasCollection(collectionName)
 	// }
 
-	// create indexes
+	// create indexes; existing collections are also upgraded with indexes added in later versions (e.g. "idx_ttl")
 	_, err = dao.GetMongoConnect().CreateCollectionIndexes(collectionName, []interface{}{
 		map[string]interface{}{
 			"key": map[string]interface{}{
@@ -122,6 +225,23 @@ func (dao *MongodbDaoMoMapping) InitStorage(appId string) error {
 			},
 			"name": "idx_to",
 		},
+		map[string]interface{}{
+			"key": map[string]interface{}{
+				fieldMapTo: 1,
+			},
+			"name": "idx_target",
+		},
+		map[string]interface{}{
+			"key": map[string]interface{}{
+				_fieldExpireAt: 1,
+			},
+			"name":               "idx_ttl",
+			"expireAfterSeconds": 0,
+		},
+		map[string]interface{}{
+			"key":  bson.D{{Key: fieldMapNamespace, Value: 1}, {Key: fieldMapTo, Value: 1}, {Key: _fieldTime, Value: 1}, {Key: fieldMapFrom, Value: 1}},
+			"name": "idx_to_time",
+		},
 	})
 	if err != nil {
 		log.Printf("Error while creating indexes on collection %s: %e", collectionName, err)
@@ -129,6 +249,14 @@ func (dao *MongodbDaoMoMapping) InitStorage(appId string) error {
 	} else {
 		log.Printf("Created indexes for collection %s", collectionName)
 	}
+	// documents created by older versions do not have field "time": fill it from field "t" (requires MongoDB v4.2+)
+	_, err = dao.GetMongoConnect().GetCollection(collectionName).UpdateMany(ctx,
+		bson.M{_fieldTime: bson.M{"$exists": false}},
+		[]bson.M{{"$set": bson.M{_fieldTime: bson.M{"$toDate": "$" + fieldMapTime}}}})
+	if err != nil {
+		log.Printf("Error while filling field [%s] of collection %s: %e", _fieldTime, collectionName, err)
+	}
+	dao.setCollectionInitialized(collectionName, true)
 
 	return nil
 }
@@ -136,11 +264,15 @@ func (dao *MongodbDaoMoMapping) InitStorage(appId string) error {
 /*
 DestroyStorage implements IDaoMoMapping.DestroyStorage
 */
-func (dao *MongodbDaoMoMapping) DestroyStorage(appId string) error {
-	collectionName := dao.calcCollectionName(appId)
-	err := dao.GetMongoConnect().GetCollection(collectionName).Drop(nil)
-	delete(dao.collectionInitCache, collectionName)
-	return err
+func (dao *MongodbDaoMoMapping) DestroyStorage(ctx context.Context, appId string) error {
+	for _, collectionName := range []string{dao.calcCollectionName(appId), dao.calcHistoryCollectionName(appId), dao.calcClaimCollectionName(appId)} {
+		err := dao.GetMongoConnect().GetCollection(collectionName).Drop(ctx)
+		dao.setCollectionInitialized(collectionName, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // GdaoCreateFilter implements godal.IGenericDao.GdaoCreateFilter.
@@ -149,7 +281,7 @@ func (dao *MongodbDaoMoMapping) DestroyStorage(appId string) error {
 func (dao *MongodbDaoMoMapping) GdaoCreateFilter(_ string, gbo godal.IGenericBo) interface{} {
 	namespace := gbo.GboGetAttrUnsafe(fieldMapNamespace, reddo.TypeString).(string)
 	from := gbo.GboGetAttrUnsafe(fieldMapFrom, reddo.TypeString).(string)
-	return bson.M{fieldMapNamespace: namespace, fieldMapFrom: normalizeMappingObject(namespace, from)}
+	return bson.M{fieldMapNamespace: namespace, fieldMapFrom: from}
 }
 
 // toBo transforms godal.IGenericBo to BoApp
@@ -176,99 +308,782 @@ func (dao *MongodbDaoMoMapping) toGbo(bo *BoMapping) godal.IGenericBo {
 	return gbo
 }
 
+// toDoc transforms BoMapping to the document to be stored.
+//
+// If the mapping has expiry, it is also stored as a BSON date (field "expireAt") so that MongoDB's TTL index removes
+// the document once expired. The mapping's time is also stored as a BSON date (field "time") to sort mappings by time.
+func (dao *MongodbDaoMoMapping) toDoc(collectionName string, bo *BoMapping) (interface{}, error) {
+	doc, err := dao.GetRowMapper().ToRow(collectionName, dao.toGbo(bo))
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := doc.(map[string]interface{}); ok {
+		m[_fieldTime] = bo.Time
+		if bo.Expiry != nil {
+			m[_fieldExpireAt] = *bo.Expiry
+		}
+	}
+	return doc, nil
+}
+
+// doGetMapping returns the mapping of an object, or nil if the object has not mapped to any target or the mapping has
+// expired.
+//
+// MongoDB's TTL monitor removes expired documents periodically, hence expired documents may still exist for a while.
 func (dao *MongodbDaoMoMapping) doGetMapping(ctx context.Context, appId, namespace, from string) (*BoMapping, error) {
 	collectionName := dao.calcCollectionName(appId)
-	filter := bson.M{fieldMapNamespace: normalizeNamespace(namespace), fieldMapFrom: normalizeMappingObject(namespace, from)}
-	gbo, err := dao.GdaoFetchOne(collectionName, filter)
-	return dao.toBo(gbo), err
+	filter := bson.M{fieldMapNamespace: normalizeNamespace(namespace), fieldMapFrom: from}
+	jsData, err := dao.GetMongoConnect().DecodeSingleResultRaw(dao.MongoFetchOne(ctx, collectionName, filter))
+	if err != nil || jsData == nil {
+		return nil, err
+	}
+	gbo, err := dao.GetRowMapper().ToBo(collectionName, jsData)
+	return liveMapping(dao.toBo(gbo)), err
 }
 
 /*
 FindTargetForObject implements IDaoMoMapping.FindTargetForObject
 */
-func (dao *MongodbDaoMoMapping) FindTargetForObject(appId, namespace, from string) (*BoMapping, error) {
-	return dao.doGetMapping(nil, appId, namespace, from)
+func (dao *MongodbDaoMoMapping) FindTargetForObject(ctx context.Context, appId, namespace, from string) (*BoMapping, error) {
+	return dao.doGetMapping(ctx, appId, namespace, from)
+}
+
+/*
+FindTargetsForObjects implements IDaoMoMapping.FindTargetsForObjects
+*/
+func (dao *MongodbDaoMoMapping) FindTargetsForObjects(ctx context.Context, appId, namespace string, objects []string) ([]*BoMapping, error) {
+	if len(objects) == 0 {
+		return make([]*BoMapping, 0), nil
+	}
+	froms := make([]string, len(objects))
+	for i, from := range objects {
+		froms[i] = from
+	}
+	filter := bson.M{fieldMapNamespace: normalizeNamespace(namespace), fieldMapFrom: bson.M{"$in": froms}}
+	return dao.doFetchMappings(ctx, appId, filter)
 }
 
 func (dao *MongodbDaoMoMapping) doGetReversedMappings(ctx context.Context, appId, namespace, to string) ([]*BoMapping, error) {
-	collectionName := dao.calcCollectionName(appId)
 	filter := bson.M{fieldMapNamespace: normalizeNamespace(namespace), fieldMapTo: normalizeMappingTarget(to)}
-	gboList, err := dao.GdaoFetchMany(collectionName, filter, nil, 0, 0)
+	return dao.doFetchMappings(ctx, appId, filter)
+}
+
+// doFetchMappings returns all mappings of an app matching a filter.
+func (dao *MongodbDaoMoMapping) doFetchMappings(ctx context.Context, appId string, filter bson.M, opts ...*options.FindOptions) ([]*BoMapping, error) {
+	collectionName := dao.calcCollectionName(appId)
+	// godal's MongoFetchMany does not support sorting by multiple fields in order, hence the collection is used directly
+	cursor, err := dao.GetMongoConnect().GetCollection(collectionName).Find(ctx, filter, opts...)
+	if cursor != nil {
+		defer func() { _ = cursor.Close(ctx) }()
+	}
 	if err != nil {
 		return nil, err
 	}
 	result := make([]*BoMapping, 0)
-	if gboList != nil {
-		for _, gbo := range gboList {
-			bo := dao.toBo(gbo)
-			if bo != nil {
-				result = append(result, bo)
-			}
+	var resultErr error
+	dao.GetMongoConnect().DecodeResultCallbackRaw(ctx, cursor, func(_ int, doc []byte, err error) bool {
+		if err != nil {
+			resultErr = err
+			return false
+		}
+		gbo, err := dao.GetRowMapper().ToBo(collectionName, doc)
+		if err != nil {
+			resultErr = err
+			return false
 		}
+		if bo := dao.toBo(gbo); bo != nil {
+			result = append(result, bo)
+		}
+		return true
+	})
+	if resultErr != nil {
+		return nil, resultErr
+	}
+	return liveMappings(result), nil
+}
+
+// targetFinder returns the function looking up live mappings to a target, for checkUniqueTargets.
+func (dao *MongodbDaoMoMapping) targetFinder(ctx context.Context, appId string) func(namespace, target string) ([]*BoMapping, error) {
+	return func(namespace, target string) ([]*BoMapping, error) {
+		return dao.doGetReversedMappings(ctx, appId, namespace, target)
 	}
-	return result, nil
 }
 
 /*
 FindObjectsToTarget implements IDaoMoMapping.FindObjectsToTarget
 */
-func (dao *MongodbDaoMoMapping) FindObjectsToTarget(appId, namespace, to string) ([]*BoMapping, error) {
-	return dao.doGetReversedMappings(nil, appId, namespace, to)
+func (dao *MongodbDaoMoMapping) FindObjectsToTarget(ctx context.Context, appId, namespace, to string) ([]*BoMapping, error) {
+	return dao.doGetReversedMappings(ctx, appId, namespace, to)
+}
+
+// liveTargetFilter builds the filter matching live mappings of direction {target <- objects}.
+func liveTargetFilter(namespace, to string) bson.M {
+	return bson.M{fieldMapNamespace: normalizeNamespace(namespace), fieldMapTo: normalizeMappingTarget(to),
+		_fieldExpireAt: bson.M{"$not": bson.M{"$lte": time.Now()}}}
+}
+
+/*
+FindObjectsToTargetPage implements IDaoMoMapping.FindObjectsToTargetPage
+
+Mappings are sorted by field "time" which has millisecond precision (see InitStorage for documents created by older
+versions).
+*/
+func (dao *MongodbDaoMoMapping) FindObjectsToTargetPage(ctx context.Context, appId, namespace, to string, page PageRequest) ([]*BoMapping, error) {
+	// expired mappings are filtered out by the query, so that pages are full
+	filter := liveTargetFilter(namespace, to)
+	direction, op := 1, "$gt"
+	if page.Desc {
+		direction, op = -1, "$lt"
+	}
+	if page.After != nil {
+		t := page.After.Time.Truncate(time.Millisecond)
+		filter["$or"] = []bson.M{
+			{_fieldTime: bson.M{op: t}},
+			{_fieldTime: t, fieldMapFrom: bson.M{op: page.After.From}},
+		}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: _fieldTime, Value: direction}, {Key: fieldMapFrom, Value: direction}})
+	if page.Limit > 0 {
+		opts.SetLimit(int64(page.Limit))
+	}
+	return dao.doFetchMappings(ctx, appId, filter, opts)
+}
+
+/*
+FindAllObjectsToTarget implements IDaoMoMapping.FindAllObjectsToTarget
+*/
+func (dao *MongodbDaoMoMapping) FindAllObjectsToTarget(ctx context.Context, appId, to string) ([]*BoMapping, error) {
+	filter := bson.M{fieldMapTo: normalizeMappingTarget(to), _fieldExpireAt: bson.M{"$not": bson.M{"$lte": time.Now()}}}
+	return dao.doFetchMappings(ctx, appId, filter)
+}
+
+/*
+TranslateObject implements IDaoMoMapping.TranslateObject
+
+MongoDB has no join on a single collection without an aggregation pipeline, hence the object's mapping is fetched first,
+then the mappings in all target namespaces are fetched with one query.
+*/
+func (dao *MongodbDaoMoMapping) TranslateObject(ctx context.Context, appId, namespace, from string, targetNamespaces []string) (*BoMapping, []*BoMapping, error) {
+	mapping, err := dao.FindTargetForObject(ctx, appId, namespace, from)
+	if mapping == nil || err != nil || len(targetNamespaces) == 0 {
+		return mapping, make([]*BoMapping, 0), err
+	}
+	namespaces := make([]string, len(targetNamespaces))
+	for i, ns := range targetNamespaces {
+		namespaces[i] = normalizeNamespace(ns)
+	}
+	filter := bson.M{fieldMapNamespace: bson.M{"$in": namespaces}, fieldMapTo: mapping.To,
+		_fieldExpireAt: bson.M{"$not": bson.M{"$lte": time.Now()}}}
+	result, err := dao.doFetchMappings(ctx, appId, filter)
+	return mapping, result, err
+}
+
+/*
+CountObjectsToTarget implements IDaoMoMapping.CountObjectsToTarget
+*/
+func (dao *MongodbDaoMoMapping) CountObjectsToTarget(ctx context.Context, appId, namespace, to string) (int, error) {
+	count, err := dao.GetMongoConnect().GetCollection(dao.calcCollectionName(appId)).CountDocuments(ctx, liveTargetFilter(namespace, to))
+	return int(count), err
 }
 
+/*
+HasObjects implements IDaoMoMapping.HasObjects
+*/
+func (dao *MongodbDaoMoMapping) HasObjects(ctx context.Context, appId, namespace string) (bool, error) {
+	filter := bson.M{fieldMapNamespace: normalizeNamespace(namespace), _fieldExpireAt: bson.M{"$not": bson.M{"$lte": time.Now()}}}
+	count, err := dao.GetMongoConnect().GetCollection(dao.calcCollectionName(appId)).CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// isMongoDuplicateKeyError checks if an error is caused by a unique index violation
+func isMongoDuplicateKeyError(err error) bool {
+	switch e := err.(type) {
+	case mongo2.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == 11000 {
+				return true
+			}
+		}
+	case mongo2.CommandError:
+		return e.Code == 11000
+	}
+	return false
+}
+
+// doInsert inserts a new mapping, returns false if the mapping's object has already mapped (unique index "uidx_from").
+//
+// An expired mapping (not yet removed by the TTL monitor) does not block the insert, it is removed first.
 func (dao *MongodbDaoMoMapping) doInsert(ctx context.Context, bo *BoMapping) (bool, error) {
-	numRows, err := dao.GdaoCreate(dao.calcCollectionName(bo.AppId), dao.toGbo(bo))
-	return numRows > 0, err
+	collectionName := dao.calcCollectionName(bo.AppId)
+	doc, err := dao.toDoc(collectionName, bo)
+	if err != nil {
+		return false, err
+	}
+	for {
+		_, err = dao.MongoInsertOne(ctx, collectionName, doc)
+		if err == nil {
+			return true, nil
+		}
+		if !isMongoDuplicateKeyError(err) {
+			return false, err
+		}
+		if purged, err := dao.doPurgeExpired(ctx, bo); err != nil || !purged {
+			return false, err
+		}
+	}
+}
+
+// doPurgeExpired removes the stored mapping of a mapping's object if it has expired.
+func (dao *MongodbDaoMoMapping) doPurgeExpired(ctx context.Context, bo *BoMapping) (bool, error) {
+	filter := bson.M{fieldMapNamespace: bo.Namespace, fieldMapFrom: bo.From, _fieldExpireAt: bson.M{"$lte": time.Now()}}
+	dbResult, err := dao.MongoDeleteMany(ctx, dao.calcCollectionName(bo.AppId), filter)
+	if err != nil {
+		return false, err
+	}
+	return dbResult.DeletedCount > 0, nil
+}
+
+// doUpsert inserts a mapping, replacing the existing one (if any).
+func (dao *MongodbDaoMoMapping) doUpsert(ctx context.Context, bo *BoMapping) error {
+	collectionName := dao.calcCollectionName(bo.AppId)
+	doc, err := dao.toDoc(collectionName, bo)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{fieldMapNamespace: bo.Namespace, fieldMapFrom: bo.From}
+	if err := dao.MongoSaveOne(ctx, collectionName, filter, doc).Err(); err != nil && err != mongo2.ErrNoDocuments {
+		return err
+	}
+	return nil
+}
+
+// doRecordHistory appends a history entry for a change of a mapping.
+func (dao *MongodbDaoMoMapping) doRecordHistory(ctx context.Context, op string, bo *BoMapping, prevTo string) error {
+	entry := newMappingHistory(op, bo, prevTo)
+	if entry == nil {
+		return nil
+	}
+	if err := dao.ensureHistoryCollection(bo.AppId); err != nil {
+		return err
+	}
+	gbo := godal.NewGenericBo()
+	if err := gbo.GboImportViaJson(entry); err != nil {
+		return err
+	}
+	collectionName := dao.calcHistoryCollectionName(bo.AppId)
+	doc, err := dao.GetRowMapper().ToRow(collectionName, gbo)
+	if err != nil {
+		return err
+	}
+	_, err = dao.MongoInsertOne(ctx, collectionName, doc)
+	return err
+}
+
+// doClaimTargets writes a claim document for each target of mappings 'bos' in namespaces listed in 'uniqueNamespaces'.
+//
+// Snapshot transactions do not detect write skew: two transactions mapping different objects to the same target would
+// both pass checkUniqueTargets. Claiming the target inside the transaction makes them write the same document, hence
+// one of them fails with a write conflict (and is retried, see dao_retry.go). Claims are meaningless outside of a
+// transaction, hence nothing is written with "optimistic" strategy.
+func (dao *MongodbDaoMoMapping) doClaimTargets(ctx context.Context, appId string, bos []*BoMapping, uniqueNamespaces []string) error {
+	if dao.allocateStrategy == allocateStrategyOptimistic {
+		return nil
+	}
+	uniqueNs := uniqueNamespaceSet(uniqueNamespaces)
+	collectionName := dao.calcClaimCollectionName(appId)
+	for _, bo := range bos {
+		if !uniqueNs[bo.Namespace] {
+			continue
+		}
+		// apps created before claims were introduced have no claim collection, see ensureHistoryCollection
+		if err := dao.ensureCollection(collectionName, nil); err != nil {
+			return err
+		}
+		filter := bson.M{_fieldId: bson.D{{Key: fieldMapNamespace, Value: bo.Namespace}, {Key: fieldMapTo, Value: bo.To}}}
+		update := bson.M{"$set": bson.M{_fieldTime: time.Now()}}
+		_, err := dao.GetMongoConnect().GetCollection(collectionName).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// doWithUniqueTargets runs 'f', which checks (see checkUniqueTargets) and writes mappings 'bos'.
+//
+// If some of 'bos' are in namespaces listed in 'uniqueNamespaces', 'f' runs inside a transaction that claims their
+// targets first (see doClaimTargets). With "optimistic" strategy (no transaction), the check is best-effort: concurrent
+// writers may still map different objects to the same target.
+func (dao *MongodbDaoMoMapping) doWithUniqueTargets(ctx context.Context, appId string, bos []*BoMapping, uniqueNamespaces []string, f func(ctx context.Context) error) error {
+	uniqueNs := uniqueNamespaceSet(uniqueNamespaces)
+	claimed := false
+	for _, bo := range bos {
+		claimed = claimed || uniqueNs[bo.Namespace]
+	}
+	if !claimed || dao.allocateStrategy == allocateStrategyOptimistic {
+		return f(ctx)
+	}
+	return dao.doInTransaction(ctx, func(sctx mongo2.SessionContext) error {
+		if err := dao.doClaimTargets(sctx, appId, bos, uniqueNamespaces); err != nil {
+			return err
+		}
+		return f(sctx)
+	})
 }
 
 /*
 Map implements IDaoMoMapping.Map
 */
-func (dao *MongodbDaoMoMapping) Map(appId, namespace, object, target string) (*BoMapping, error) {
+func (dao *MongodbDaoMoMapping) Map(ctx context.Context, appId, namespace, object, target string, expiry *time.Time, attrs map[string]interface{}, uniqueNamespaces []string) (*BoMapping, error) {
 	bo := &BoMapping{
 		Namespace: normalizeNamespace(namespace),
-		From:      normalizeMappingObject(namespace, object),
+		From:      object,
 		To:        normalizeMappingTarget(target),
 		Time:      time.Now(),
 		AppId:     appId,
+		Expiry:    expiry,
+		Attrs:     patchAttrs(nil, attrs),
 	}
-	_, err := dao.doInsert(nil, bo)
-	if err != nil {
+	return compareAndMap(ctx, bo,
+		func() (bool, error) {
+			var inserted bool
+			err := dao.doWithUniqueTargets(ctx, appId, []*BoMapping{bo}, uniqueNamespaces, func(ctx context.Context) error {
+				// the existing mapping (if any) is looked up by compareAndMap
+				if existing, err := dao.doGetMapping(ctx, appId, bo.Namespace, bo.From); err != nil || existing != nil {
+					return err
+				}
+				if err := checkUniqueTargets([]*BoMapping{bo}, uniqueNamespaces, dao.targetFinder(ctx, appId)); err != nil {
+					return err
+				}
+				// a failed insert aborts the transaction (if any), hence expired mapping must be removed beforehand
+				if _, err := dao.doPurgeExpired(ctx, bo); err != nil {
+					return err
+				}
+				var err error
+				if inserted, err = dao.doInsert(ctx, bo); err != nil || !inserted {
+					return err
+				}
+				return dao.doRecordHistory(ctx, historyOpMap, bo, "")
+			})
+			return inserted, err
+		},
+		func() (*BoMapping, error) { return dao.doGetMapping(ctx, appId, namespace, object) },
+		// doInsert removes expired mapping by itself
+		func() error { return nil })
+}
+
+// batchFilter builds the filter matching mappings of the given objects, grouped by namespace.
+func batchFilter(bos []*BoMapping) bson.M {
+	objsPerNs := make(map[string][]string)
+	for _, bo := range bos {
+		objsPerNs[bo.Namespace] = append(objsPerNs[bo.Namespace], bo.From)
+	}
+	conds := make([]bson.M, 0, len(objsPerNs))
+	for ns, froms := range objsPerNs {
+		conds = append(conds, bson.M{fieldMapNamespace: ns, fieldMapFrom: bson.M{"$in": froms}})
+	}
+	return bson.M{"$or": conds}
+}
+
+// doInsertMany inserts mappings of distinct objects with one unordered bulk insert (expired mappings are removed
+// beforehand), and returns keys (see batchKey) of the inserted ones.
+func (dao *MongodbDaoMoMapping) doInsertMany(ctx context.Context, appId string, bos []*BoMapping) (map[string]bool, error) {
+	collectionName := dao.calcCollectionName(appId)
+	purgeFilter := batchFilter(bos)
+	purgeFilter[_fieldExpireAt] = bson.M{"$lte": time.Now()}
+	if _, err := dao.MongoDeleteMany(ctx, collectionName, purgeFilter); err != nil {
+		return nil, err
+	}
+	docs := make([]interface{}, len(bos))
+	for i, bo := range bos {
+		doc, err := dao.toDoc(collectionName, bo)
+		if err != nil {
+			return nil, err
+		}
+		docs[i] = doc
+	}
+	failed := make(map[int]bool)
+	_, err := dao.GetMongoConnect().GetCollection(collectionName).InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if bwe, ok := err.(mongo2.BulkWriteException); ok && bwe.WriteConcernError == nil {
+		for _, we := range bwe.WriteErrors {
+			if we.Code != 11000 {
+				return nil, err
+			}
+			failed[we.Index] = true
+		}
+	} else if err != nil {
 		return nil, err
 	}
-	return bo, nil
+	inserted := make(map[string]bool)
+	for i, bo := range bos {
+		if !failed[i] {
+			inserted[batchKey(bo)] = true
+		}
+	}
+	return inserted, nil
+}
+
+/*
+MapMany implements IDaoMoMapping.MapMany
+*/
+func (dao *MongodbDaoMoMapping) MapMany(ctx context.Context, appId string, items []*BoMapping, uniqueNamespaces []string) ([]*BoMapping, error) {
+	if len(items) == 0 {
+		return make([]*BoMapping, 0), nil
+	}
+	uniqueNs := uniqueNamespaceSet(uniqueNamespaces)
+	return mapManyUnique(normalizeBatchItems(appId, items, time.Now()), uniqueNamespaces, dao.targetFinder(ctx, appId),
+		func(bos []*BoMapping) ([]*BoMapping, error) {
+			result := make([]*BoMapping, len(bos))
+			bulk, indexes := make([]*BoMapping, 0, len(bos)), make([]int, 0, len(bos))
+			for i, bo := range bos {
+				if !uniqueNs[bo.Namespace] {
+					bulk, indexes = append(bulk, bo), append(indexes, i)
+					continue
+				}
+				// a failed bulk insert would abort the transaction claiming the targets, hence items of unique namespaces
+				// are mapped one by one
+				mapping, err := dao.Map(ctx, appId, bo.Namespace, bo.From, bo.To, bo.Expiry, bo.Attrs, uniqueNamespaces)
+				if conflict, ok := IsUniqueConflict(err); ok {
+					mapping, err = conflict, nil
+				} else if _, ok := IsMappingConflict(err); ok {
+					err = nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				result[i] = mapping
+			}
+			if len(bulk) == 0 {
+				return result, nil
+			}
+			mapped, err := batchMap(ctx, bulk,
+				func(bos []*BoMapping) (map[string]bool, error) {
+					inserted, err := dao.doInsertMany(ctx, appId, bos)
+					if err != nil {
+						return nil, err
+					}
+					for _, bo := range bos {
+						if inserted[batchKey(bo)] {
+							if err := dao.doRecordHistory(ctx, historyOpMap, bo, ""); err != nil {
+								return nil, err
+							}
+						}
+					}
+					return inserted, nil
+				},
+				func(bos []*BoMapping) ([]*BoMapping, error) { return dao.doFetchMappings(ctx, appId, batchFilter(bos)) })
+			if err != nil {
+				return nil, err
+			}
+			for j, mapping := range mapped {
+				result[indexes[j]] = mapping
+			}
+			return result, nil
+		})
+}
+
+/*
+PatchAttrs implements IDaoMoMapping.PatchAttrs
+
+Attributes are patched atomically with operators $set/$unset, so that concurrent patches of different attributes do
+not overwrite each other.
+*/
+func (dao *MongodbDaoMoMapping) PatchAttrs(ctx context.Context, appId, namespace, object string, patch map[string]interface{}) (*BoMapping, error) {
+	setAttrs, unsetAttrs := bson.M{}, bson.M{}
+	for k, v := range patch {
+		if v == nil {
+			unsetAttrs[fieldMapAttrs+"."+k] = ""
+		} else {
+			setAttrs[fieldMapAttrs+"."+k] = v
+		}
+	}
+	update := bson.M{}
+	if len(setAttrs) > 0 {
+		update["$set"] = setAttrs
+	}
+	if len(unsetAttrs) > 0 {
+		update["$unset"] = unsetAttrs
+	}
+	if len(update) == 0 {
+		return dao.doGetMapping(ctx, appId, namespace, object)
+	}
+	collectionName := dao.calcCollectionName(appId)
+	filter := bson.M{fieldMapNamespace: normalizeNamespace(namespace), fieldMapFrom: object,
+		// expired mappings are treated as non-existent
+		_fieldExpireAt: bson.M{"$not": bson.M{"$lte": time.Now()}}}
+	dbResult := dao.GetMongoConnect().GetCollection(collectionName).FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After))
+	if dbResult.Err() == mongo2.ErrNoDocuments {
+		return nil, nil
+	}
+	jsData, err := dao.GetMongoConnect().DecodeSingleResultRaw(dbResult)
+	if err != nil || jsData == nil {
+		return nil, err
+	}
+	gbo, err := dao.GetRowMapper().ToBo(collectionName, jsData)
+	return dao.toBo(gbo), err
 }
 
 func (dao *MongodbDaoMoMapping) doDelete(ctx context.Context, bo *BoMapping) (bool, error) {
-	numRows, err := dao.GdaoDelete(dao.calcCollectionName(bo.AppId), dao.toGbo(bo))
-	return numRows > 0, err
+	filter := bson.M{fieldMapNamespace: bo.Namespace, fieldMapFrom: bo.From, fieldMapTo: bo.To,
+		// expired mappings are treated as non-existent
+		_fieldExpireAt: bson.M{"$not": bson.M{"$lte": time.Now()}}}
+	dbResult, err := dao.MongoDeleteMany(ctx, dao.calcCollectionName(bo.AppId), filter)
+	if err != nil {
+		return false, err
+	}
+	return dbResult.DeletedCount > 0, nil
 }
 
 /*
 Unmap implements IDaoMoMapping.Unmap
 */
-func (dao *MongodbDaoMoMapping) Unmap(appId, namespace, object, target string) (bool, error) {
+func (dao *MongodbDaoMoMapping) Unmap(ctx context.Context, appId, namespace, object, target string) (bool, error) {
 	bo := &BoMapping{
 		Namespace: normalizeNamespace(namespace),
-		From:      normalizeMappingObject(namespace, object),
+		From:      object,
 		To:        normalizeMappingTarget(target),
 		AppId:     appId,
 	}
-	return dao.doDelete(nil, bo)
+	deleted, err := dao.doDelete(ctx, bo)
+	if err != nil || !deleted {
+		return deleted, err
+	}
+	return true, dao.doRecordHistory(ctx, historyOpUnmap, bo, bo.To)
 }
 
-func (dao *MongodbDaoMoMapping) doAllocate(ctx context.Context, appId string, mapNsObj map[string]string, target string) (string, error) {
-	if ctx == nil {
-		ctx, _ = dao.GetMongoConnect().NewContext()
+/*
+UnmapMany implements IDaoMoMapping.UnmapMany
+
+Mappings that still point to the items' targets are looked up first, then removed with one bulk delete.
+*/
+func (dao *MongodbDaoMoMapping) UnmapMany(ctx context.Context, appId string, items []*BoMapping) ([]bool, error) {
+	result := make([]bool, len(items))
+	if len(items) == 0 {
+		return result, nil
 	}
-	var finalTarget = target
-	err := dao.GetMongoConnect().GetMongoClient().UseSession(ctx, func(sctx mongo2.SessionContext) error {
+	bos := normalizeBatchItems(appId, items, time.Time{})
+	existing, err := dao.doFetchMappings(ctx, appId, batchFilter(bos))
+	if err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string)
+	for _, bo := range existing {
+		targets[batchKey(bo)] = bo.To
+	}
+	conds := make([]bson.M, 0)
+	for i, bo := range bos {
+		// an object is unmapped only once, by the first item with the right target
+		if key := batchKey(bo); targets[key] == bo.To {
+			conds = append(conds, bson.M{fieldMapNamespace: bo.Namespace, fieldMapFrom: bo.From, fieldMapTo: bo.To})
+			result[i] = true
+			delete(targets, key)
+		}
+	}
+	if len(conds) == 0 {
+		return result, nil
+	}
+	filter := bson.M{"$or": conds, _fieldExpireAt: bson.M{"$not": bson.M{"$lte": time.Now()}}}
+	if _, err := dao.MongoDeleteMany(ctx, dao.calcCollectionName(appId), filter); err != nil {
+		return nil, err
+	}
+	for i, bo := range bos {
+		if result[i] {
+			if err := dao.doRecordHistory(ctx, historyOpUnmap, bo, bo.To); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+/*
+Remap implements IDaoMoMapping.Remap
+*/
+func (dao *MongodbDaoMoMapping) Remap(ctx context.Context, appId, namespace, object, target, expectedTarget string, uniqueNamespaces []string) (*BoMapping, error) {
+	bo := &BoMapping{
+		Namespace: normalizeNamespace(namespace),
+		From:      object,
+		To:        normalizeMappingTarget(target),
+		Time:      time.Now(),
+		AppId:     appId,
+	}
+	if expectedTarget != "" {
+		expectedTarget = normalizeMappingTarget(expectedTarget)
+	}
+	collectionName := dao.calcCollectionName(appId)
+	return compareAndRemap(ctx, bo, expectedTarget,
+		func() (*BoMapping, error) { return dao.doGetMapping(ctx, appId, bo.Namespace, bo.From) },
+		func(currentTarget string) (bool, error) {
+			var updated bool
+			err := dao.doWithUniqueTargets(ctx, appId, []*BoMapping{bo}, uniqueNamespaces, func(ctx context.Context) error {
+				if err := checkUniqueTargets([]*BoMapping{bo}, uniqueNamespaces, dao.targetFinder(ctx, appId)); err != nil {
+					return err
+				}
+				doc, err := dao.toDoc(collectionName, bo)
+				if err != nil {
+					return err
+				}
+				filter := bson.M{fieldMapNamespace: bo.Namespace, fieldMapFrom: bo.From, fieldMapTo: currentTarget}
+				err = dao.MongoUpdateOne(ctx, collectionName, filter, doc).Err()
+				if err == mongo2.ErrNoDocuments {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				updated = true
+				return dao.doRecordHistory(ctx, historyOpRemap, bo, currentTarget)
+			})
+			return updated, err
+		})
+}
+
+// doMergeTargets moves mappings from target 'from' to target 'into', one document at a time.
+//
+// Each document is replaced only if it still maps to 'from', so that concurrent modifications are detected.
+func (dao *MongodbDaoMoMapping) doMergeTargets(ctx context.Context, appId, from, into string, uniqueNamespaces []string) ([]*BoMapping, error) {
+	fromMappings, err := dao.doFetchMappings(ctx, appId, bson.M{fieldMapTo: from})
+	if err != nil {
+		return nil, err
+	}
+	intoMappings, err := dao.doFetchMappings(ctx, appId, bson.M{fieldMapTo: into})
+	if err != nil {
+		return nil, err
+	}
+	result, err := planMergeTargets(fromMappings, intoMappings, into, uniqueNamespaces)
+	if err != nil {
+		return nil, err
+	}
+	if err := dao.doClaimTargets(ctx, appId, result, uniqueNamespaces); err != nil {
+		return nil, err
+	}
+	collectionName := dao.calcCollectionName(appId)
+	for _, bo := range result {
+		doc, err := dao.toDoc(collectionName, bo)
+		if err != nil {
+			return nil, err
+		}
+		filter := bson.M{fieldMapNamespace: bo.Namespace, fieldMapFrom: bo.From, fieldMapTo: from}
+		if err := dao.MongoUpdateOne(ctx, collectionName, filter, doc).Err(); err != nil {
+			if err == mongo2.ErrNoDocuments {
+				err = errors.Errorf("[%s] has been modified concurrently in namespace [%s].", bo.From, bo.Namespace)
+			}
+			return nil, err
+		}
+		if err := dao.doRecordHistory(ctx, historyOpRemap, bo, from); err != nil {
+			return nil, err
+		}
+	}
+	if len(fromMappings) > 0 {
+		if err := dao.doUpsert(ctx, newTargetAlias(appId, from, into, time.Now())); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+/*
+MergeTargets implements IDaoMoMapping.MergeTargets
+
+With "optimistic" strategy (no transaction), each object is moved atomically but the merge as a whole is not: if it
+fails midway, the merge can be safely re-run to move the remaining objects.
+*/
+func (dao *MongodbDaoMoMapping) MergeTargets(ctx context.Context, appId, from, into string, uniqueNamespaces []string) ([]*BoMapping, error) {
+	from, into = normalizeMappingTarget(from), normalizeMappingTarget(into)
+	if dao.allocateStrategy == allocateStrategyOptimistic {
+		return dao.doMergeTargets(ctx, appId, from, into, uniqueNamespaces)
+	}
+	var result []*BoMapping
+	err := dao.doInTransaction(ctx, func(sctx mongo2.SessionContext) error {
+		var err error
+		result, err = dao.doMergeTargets(sctx, appId, from, into, uniqueNamespaces)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// doSplitTarget moves the listed objects from target 'from' to target 'into', one document at a time.
+//
+// Each document is replaced only if it still maps to 'from', so that concurrent modifications are detected.
+func (dao *MongodbDaoMoMapping) doSplitTarget(ctx context.Context, appId, from string, mapNsObj map[string]string, into string, uniqueNamespaces []string) ([]*BoMapping, error) {
+	result, err := planSplitTarget(appId, from, mapNsObj, into, uniqueNamespaces, func(namespace, object string) (*BoMapping, error) {
+		return dao.doGetMapping(ctx, appId, namespace, object)
+	}, dao.targetFinder(ctx, appId))
+	if err != nil {
+		return nil, err
+	}
+	if err := dao.doClaimTargets(ctx, appId, result, uniqueNamespaces); err != nil {
+		return nil, err
+	}
+	collectionName := dao.calcCollectionName(appId)
+	for _, bo := range result {
+		doc, err := dao.toDoc(collectionName, bo)
+		if err != nil {
+			return nil, err
+		}
+		filter := bson.M{fieldMapNamespace: bo.Namespace, fieldMapFrom: bo.From, fieldMapTo: from}
+		if err := dao.MongoUpdateOne(ctx, collectionName, filter, doc).Err(); err != nil {
+			if err == mongo2.ErrNoDocuments {
+				err = errors.Errorf("[%s] has been modified concurrently in namespace [%s].", bo.From, bo.Namespace)
+			}
+			return nil, err
+		}
+		if err := dao.doRecordHistory(ctx, historyOpRemap, bo, from); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+/*
+SplitTarget implements IDaoMoMapping.SplitTarget
+
+With "optimistic" strategy (no transaction), each object is moved atomically but the split as a whole is not: if it
+fails midway, the split can be safely re-run to move the remaining objects. Uniqueness of 'uniqueNamespaces' is then
+checked on a best-effort basis (see doWithUniqueTargets).
+*/
+func (dao *MongodbDaoMoMapping) SplitTarget(ctx context.Context, appId, from string, mapNsObj map[string]string, into string, uniqueNamespaces []string) ([]*BoMapping, error) {
+	from, into = normalizeMappingTarget(from), normalizeMappingTarget(into)
+	if dao.allocateStrategy == allocateStrategyOptimistic {
+		return dao.doSplitTarget(ctx, appId, from, mapNsObj, into, uniqueNamespaces)
+	}
+	var result []*BoMapping
+	err := dao.doInTransaction(ctx, func(sctx mongo2.SessionContext) error {
+		var err error
+		result, err = dao.doSplitTarget(sctx, appId, from, mapNsObj, into, uniqueNamespaces)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// doInTransaction runs 'f' inside a multi-document snapshot transaction, which is committed if 'f' succeeds and aborted
+// otherwise.
+func (dao *MongodbDaoMoMapping) doInTransaction(ctx context.Context, f func(sctx mongo2.SessionContext) error) error {
+	return dao.GetMongoConnect().GetMongoClient().UseSession(ctx, func(sctx mongo2.SessionContext) error {
 		err := sctx.StartTransaction(options.Transaction().
 			SetReadConcern(readconcern.Snapshot()).
 			SetWriteConcern(writeconcern.New(writeconcern.WMajority())))
 		if err != nil {
 			return err
 		}
+		if err := f(sctx); err != nil {
+			_ = sctx.AbortTransaction(sctx)
+			return err
+		}
+		return sctx.CommitTransaction(sctx)
+	})
+}
+
+func (dao *MongodbDaoMoMapping) doAllocate(ctx context.Context, appId string, mapNsObj map[string]string, target string, expiries map[string]time.Time, uniqueNamespaces []string) (string, error) {
+	var finalTarget = target
+	err := dao.doInTransaction(ctx, func(sctx mongo2.SessionContext) error {
 		var existingTarget = ""
 		var objsToMap = make([]*BoMapping, 0)
 		for ns, obj := range mapNsObj {
@@ -281,43 +1096,193 @@ func (dao *MongodbDaoMoMapping) doAllocate(ctx context.Context, appId string, ma
 					existingTarget = mapping.To
 					finalTarget = existingTarget
 				} else if existingTarget != mapping.To {
-					return errors.Errorf("Input objects cannot map to a same target [%s]", target)
+					return newAllocateConflictError(existingTarget, mapping.To)
 				}
 			} else {
 				objsToMap = append(objsToMap, &BoMapping{
 					Namespace: normalizeNamespace(ns),
-					From:      normalizeMappingObject(ns, obj),
+					From:      obj,
 					AppId:     appId,
+					Expiry:    expiryOf(expiries, normalizeNamespace(ns)),
 				})
 			}
 		}
 		if existingTarget != "" {
 			finalTarget = existingTarget
 		}
-		if len(objsToMap) > 0 {
-			for _, mapping := range objsToMap {
-				mapping.To = finalTarget
-				mapping.Time = time.Now()
-				_, err := dao.doInsert(sctx, mapping)
-				if err != nil {
-					sctx.AbortTransaction(sctx)
-					return err
+		for _, mapping := range objsToMap {
+			mapping.To = finalTarget
+			mapping.Time = time.Now()
+		}
+		if err := dao.doClaimTargets(sctx, appId, objsToMap, uniqueNamespaces); err != nil {
+			return err
+		}
+		if err := checkUniqueTargets(objsToMap, uniqueNamespaces, dao.targetFinder(sctx, appId)); err != nil {
+			return err
+		}
+		for _, mapping := range objsToMap {
+			// a failed insert aborts the transaction, hence expired mapping must be removed beforehand
+			if _, err := dao.doPurgeExpired(sctx, mapping); err != nil {
+				return err
+			}
+			inserted, err := dao.doInsert(sctx, mapping)
+			if err == nil && !inserted {
+				err = errors.Errorf("[%s] has been mapped concurrently in namespace [%s].", mapping.From, mapping.Namespace)
+			}
+			if err == nil {
+				err = dao.doRecordHistory(sctx, historyOpMap, mapping, "")
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return finalTarget, nil
+}
+
+// doAllocateOptimistic performs Allocate without transaction.
+//
+// New mappings are inserted optimistically, relying on unique index "uidx_from" to detect concurrent writers. Inserted
+// mappings are never rolled back: a concurrent caller may have already seen them and returned them to its client. After
+// insertion, all objects are re-read to verify that they map to the final target. If the verification fails (e.g. a
+// concurrent Allocate won the race for some objects, or a mapping was removed in-between), the whole process is retried
+// from the current state: it either converges on the winning target, or fails because the objects now map to different
+// targets. Unlike the "transaction" strategy, a failed Allocate may hence leave some of its objects mapped.
+func (dao *MongodbDaoMoMapping) doAllocateOptimistic(ctx context.Context, appId string, mapNsObj map[string]string, target string, expiries map[string]time.Time, uniqueNamespaces []string) (string, error) {
+	for attempt := 0; attempt < optimisticAllocateMaxAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		var existingTarget = ""
+		var objsToMap = make([]*BoMapping, 0)
+		for ns, obj := range mapNsObj {
+			mapping, err := dao.doGetMapping(ctx, appId, ns, obj)
+			if err != nil {
+				return "", err
+			}
+			if mapping != nil {
+				if existingTarget == "" {
+					existingTarget = mapping.To
+				} else if existingTarget != mapping.To {
+					return "", newAllocateConflictError(existingTarget, mapping.To)
 				}
+			} else {
+				objsToMap = append(objsToMap, &BoMapping{
+					Namespace: normalizeNamespace(ns),
+					From:      obj,
+					AppId:     appId,
+					Expiry:    expiryOf(expiries, normalizeNamespace(ns)),
+				})
 			}
 		}
-		return sctx.CommitTransaction(sctx)
+		var finalTarget = target
+		if existingTarget != "" {
+			finalTarget = existingTarget
+		}
+		for _, mapping := range objsToMap {
+			mapping.To = finalTarget
+		}
+		// best-effort, see doWithUniqueTargets
+		if err := checkUniqueTargets(objsToMap, uniqueNamespaces, dao.targetFinder(ctx, appId)); err != nil {
+			return "", err
+		}
+		ok, err := dao.insertAndVerify(ctx, appId, mapNsObj, objsToMap, finalTarget)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return finalTarget, nil
+		}
+	}
+	return "", errors.Errorf("Cannot allocate target [%s] after %d attempts due to concurrent modifications", target, optimisticAllocateMaxAttempts)
+}
+
+// insertAndVerify inserts the new mappings (recording history of successful ones, as they are kept whatever the outcome)
+// and then verifies that all input objects map to 'finalTarget'.
+func (dao *MongodbDaoMoMapping) insertAndVerify(ctx context.Context, appId string, mapNsObj map[string]string, objsToMap []*BoMapping, finalTarget string) (bool, error) {
+	for _, mapping := range objsToMap {
+		mapping.To = finalTarget
+		mapping.Time = time.Now()
+		ok, err := dao.doInsert(ctx, mapping)
+		if err == nil && ok {
+			err = dao.doRecordHistory(ctx, historyOpMap, mapping, "")
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	for ns, obj := range mapNsObj {
+		mapping, err := dao.doGetMapping(ctx, appId, ns, obj)
+		if err != nil {
+			return false, err
+		}
+		if mapping == nil || mapping.To != finalTarget {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+/*
+GetMappingHistory implements IDaoMoMapping.GetMappingHistory
+*/
+func (dao *MongodbDaoMoMapping) GetMappingHistory(ctx context.Context, appId, namespace, from string) ([]*BoMappingHistory, error) {
+	collectionName := dao.calcHistoryCollectionName(appId)
+	filter := bson.M{fieldMapNamespace: normalizeNamespace(namespace), fieldMapFrom: from}
+	cursor, err := dao.MongoFetchMany(ctx, collectionName, filter, nil, 0, 0)
+	if cursor != nil {
+		defer func() { _ = cursor.Close(ctx) }()
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*BoMappingHistory, 0)
+	var resultErr error
+	dao.GetMongoConnect().DecodeResultCallbackRaw(ctx, cursor, func(_ int, doc []byte, err error) bool {
+		if err != nil {
+			resultErr = err
+			return false
+		}
+		gbo, err := dao.GetRowMapper().ToBo(collectionName, doc)
+		if err == nil {
+			entry := &BoMappingHistory{}
+			if err = gbo.GboTransferViaJson(entry); err == nil {
+				result = append(result, entry)
+			}
+		}
+		resultErr = err
+		return err == nil
 	})
-	return finalTarget, err
+	if resultErr != nil {
+		return nil, resultErr
+	}
+	return sortMappingHistory(result), nil
 }
 
 /*
 Allocate implements IDaoMoMapping.Allocate
 */
-func (dao *MongodbDaoMoMapping) Allocate(appId string, mapNsObj map[string]string, target string) (string, error) {
+func (dao *MongodbDaoMoMapping) Allocate(ctx context.Context, appId string, mapNsObj map[string]string, target string, expiries map[string]time.Time, uniqueNamespaces []string) (string, error) {
 	if mapNsObj == nil || len(mapNsObj) == 0 {
 		return "", nil
 	}
-	return dao.doAllocate(nil, appId, mapNsObj, target)
+	if dao.allocateStrategy == allocateStrategyOptimistic {
+		return dao.doAllocateOptimistic(ctx, appId, mapNsObj, target, expiries, uniqueNamespaces)
+	}
+	return dao.doAllocate(ctx, appId, mapNsObj, target, expiries, uniqueNamespaces)
+}
+
+/*
+SweepExpired implements IDaoMoMapping.SweepExpired
+
+Expired documents are removed by MongoDB's TTL index "idx_ttl", hence this function does nothing.
+*/
+func (dao *MongodbDaoMoMapping) SweepExpired(_ context.Context, _ string) (int, error) {
+	return 0, nil
 }
 
 /*----------------------------------------------------------------------*/
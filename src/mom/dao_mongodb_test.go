@@ -121,13 +121,13 @@ func _initMongodbMappings() IDaoMoMapping {
 	if err != nil {
 		panic(err)
 	}
-	return NewMongodbDaoMoMapping(mc, _testMongodbBaseCollectionMappings)
+	return NewMongodbDaoMoMapping(mc, _testMongodbBaseCollectionMappings, allocateStrategyTransaction)
 }
 
 func TestMongodbDaoMoMapping_InitStorage(t *testing.T) {
 	name := "TestMongodbDaoMoMapping_InitStorage"
 	dao := _initMongodbMappings()
-	err := dao.InitStorage(_testAppId)
+	err := dao.InitStorage(_testCtx, _testAppId)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
@@ -136,7 +136,7 @@ func TestMongodbDaoMoMapping_InitStorage(t *testing.T) {
 func TestMongodbDaoMoMapping_DestroyStorage(t *testing.T) {
 	name := "TestMongodbDaoMoMapping_DestroyStorage"
 	dao := _initMongodbMappings()
-	err := dao.DestroyStorage(_testAppId)
+	err := dao.DestroyStorage(_testCtx, _testAppId)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
@@ -145,18 +145,18 @@ func TestMongodbDaoMoMapping_DestroyStorage(t *testing.T) {
 func TestMongodbDaoMoMapping_Map(t *testing.T) {
 	name := "TestMongodbDaoMoMapping_Map"
 	dao := _initMongodbMappings()
-	err := dao.DestroyStorage(_testAppId)
+	err := dao.DestroyStorage(_testCtx, _testAppId)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
-	err = dao.InitStorage(_testAppId)
+	err = dao.InitStorage(_testCtx, _testAppId)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
 	ns := "email"
 	object := "btnguyen2k(at)1.email"
 	target := "thanhnb"
-	bo, err := dao.Map(_testAppId, ns, object, target)
+	bo, err := dao.Map(_testCtx, _testAppId, ns, object, target, nil, nil, nil)
 	if bo == nil || err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
@@ -166,8 +166,8 @@ func TestMongodbDaoMoMapping_Map(t *testing.T) {
 	if bo.AppId != _testAppId {
 		t.Fatalf("%s failed - expect %#v but received %#v", name, _testAppId, bo.AppId)
 	}
-	if bo.From != normalizeMappingObject(ns, object) {
-		t.Fatalf("%s failed - expect %#v but received %#v", name, normalizeMappingObject(ns, object), bo.From)
+	if bo.From != object {
+		t.Fatalf("%s failed - expect %#v but received %#v", name, object, bo.From)
 	}
 	if bo.To != normalizeMappingTarget(target) {
 		t.Fatalf("%s failed - expect %#v but received %#v", name, normalizeMappingTarget(target), bo.To)
@@ -177,22 +177,22 @@ func TestMongodbDaoMoMapping_Map(t *testing.T) {
 func TestMongodbDaoMoMapping_MapFindTarget(t *testing.T) {
 	name := "TestMongodbDaoMoMapping_MapFindTarget"
 	dao := _initMongodbMappings()
-	err := dao.DestroyStorage(_testAppId)
+	err := dao.DestroyStorage(_testCtx, _testAppId)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
-	err = dao.InitStorage(_testAppId)
+	err = dao.InitStorage(_testCtx, _testAppId)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
 	ns := "email"
 	object := "btnguyen2k(at)1.email"
 	target := "thanhnb"
-	_, err = dao.Map(_testAppId, ns, object, target)
+	_, err = dao.Map(_testCtx, _testAppId, ns, object, target, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
-	bo, err := dao.FindTargetForObject(_testAppId, ns, object)
+	bo, err := dao.FindTargetForObject(_testCtx, _testAppId, ns, object)
 	if bo == nil || err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
@@ -202,8 +202,8 @@ func TestMongodbDaoMoMapping_MapFindTarget(t *testing.T) {
 	if bo.AppId != _testAppId {
 		t.Fatalf("%s failed - expect %#v but received %#v", name, _testAppId, bo.AppId)
 	}
-	if bo.From != normalizeMappingObject(ns, object) {
-		t.Fatalf("%s failed - expect %#v but received %#v", name, normalizeMappingObject(ns, object), bo.From)
+	if bo.From != object {
+		t.Fatalf("%s failed - expect %#v but received %#v", name, object, bo.From)
 	}
 	if bo.To != normalizeMappingTarget(target) {
 		t.Fatalf("%s failed - expect %#v but received %#v", name, normalizeMappingTarget(target), bo.To)
@@ -213,11 +213,11 @@ func TestMongodbDaoMoMapping_MapFindTarget(t *testing.T) {
 func TestMongodbDaoMoMapping_MapFindObjects(t *testing.T) {
 	name := "TestMongodbDaoMoMapping_MapFindObjects"
 	dao := _initMongodbMappings()
-	err := dao.DestroyStorage(_testAppId)
+	err := dao.DestroyStorage(_testCtx, _testAppId)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
-	err = dao.InitStorage(_testAppId)
+	err = dao.InitStorage(_testCtx, _testAppId)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
@@ -225,16 +225,16 @@ func TestMongodbDaoMoMapping_MapFindObjects(t *testing.T) {
 	object1 := "btnguyen2k(at)1.email"
 	object2 := "thanhnb(at)2.email"
 	target := "thanhnb"
-	_, err = dao.Map(_testAppId, ns, object1, target)
+	_, err = dao.Map(_testCtx, _testAppId, ns, object1, target, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
-	_, err = dao.Map(_testAppId, ns, object2, target)
+	_, err = dao.Map(_testCtx, _testAppId, ns, object2, target, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
 
-	boList, err := dao.FindObjectsToTarget(_testAppId, ns, target)
+	boList, err := dao.FindObjectsToTarget(_testCtx, _testAppId, ns, target)
 	if err != nil || boList == nil || len(boList) != 2 {
 		t.Fatalf("%s failed: %e", name, err)
 	}
@@ -245,8 +245,8 @@ func TestMongodbDaoMoMapping_MapFindObjects(t *testing.T) {
 		if bo.AppId != _testAppId {
 			t.Fatalf("%s failed - expect %#v but received %#v", name, _testAppId, bo.AppId)
 		}
-		if bo.From != normalizeMappingObject(ns, object1) && bo.From != normalizeMappingObject(ns, object2) {
-			t.Fatalf("%s failed - expect %#v or %#v but received %#v", name, normalizeMappingObject(ns, object1), normalizeMappingObject(ns, object2), bo.From)
+		if bo.From != object1 && bo.From != object2 {
+			t.Fatalf("%s failed - expect %#v or %#v but received %#v", name, object1, object2, bo.From)
 		}
 		if bo.To != normalizeMappingTarget(target) {
 			t.Fatalf("%s failed - expect %#v but received %#v", name, normalizeMappingTarget(target), bo.To)
@@ -257,11 +257,11 @@ func TestMongodbDaoMoMapping_MapFindObjects(t *testing.T) {
 func TestMongodbDaoMoMapping_MapUnmap(t *testing.T) {
 	name := "TestMongodbDaoMoMapping_MapUnmap"
 	dao := _initMongodbMappings()
-	err := dao.DestroyStorage(_testAppId)
+	err := dao.DestroyStorage(_testCtx, _testAppId)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
-	err = dao.InitStorage(_testAppId)
+	err = dao.InitStorage(_testCtx, _testAppId)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
@@ -269,16 +269,16 @@ func TestMongodbDaoMoMapping_MapUnmap(t *testing.T) {
 	object1 := "btnguyen2k(at)1.email"
 	object2 := "thanhnb(at)2.email"
 	target := "thanhnb"
-	_, err = dao.Map(_testAppId, ns, object1, target)
+	_, err = dao.Map(_testCtx, _testAppId, ns, object1, target, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
-	_, err = dao.Map(_testAppId, ns, object2, target)
+	_, err = dao.Map(_testCtx, _testAppId, ns, object2, target, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
-	dao.Unmap(_testAppId, ns, object1, target)
-	boList, err := dao.FindObjectsToTarget(_testAppId, ns, target)
+	dao.Unmap(_testCtx, _testAppId, ns, object1, target)
+	boList, err := dao.FindObjectsToTarget(_testCtx, _testAppId, ns, target)
 	if err != nil || boList == nil || len(boList) != 1 {
 		t.Fatalf("%s failed: %e", name, err)
 	}
@@ -289,8 +289,8 @@ func TestMongodbDaoMoMapping_MapUnmap(t *testing.T) {
 		if bo.AppId != _testAppId {
 			t.Fatalf("%s failed - expect %#v but received %#v", name, _testAppId, bo.AppId)
 		}
-		if bo.From != normalizeMappingObject(ns, object2) {
-			t.Fatalf("%s failed - expect %#v but received %#v", name, normalizeMappingObject(ns, object2), bo.From)
+		if bo.From != object2 {
+			t.Fatalf("%s failed - expect %#v but received %#v", name, object2, bo.From)
 		}
 		if bo.To != normalizeMappingTarget(target) {
 			t.Fatalf("%s failed - expect %#v but received %#v", name, normalizeMappingTarget(target), bo.To)
@@ -301,11 +301,11 @@ func TestMongodbDaoMoMapping_MapUnmap(t *testing.T) {
 func TestMongodbDaoMoMapping_Allocate(t *testing.T) {
 	name := "TestMongodbDaoMoMapping_Allocate"
 	dao := _initMongodbMappings()
-	err := dao.DestroyStorage(_testAppId)
+	err := dao.DestroyStorage(_testCtx, _testAppId)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
-	err = dao.InitStorage(_testAppId)
+	err = dao.InitStorage(_testCtx, _testAppId)
 	if err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
@@ -314,12 +314,12 @@ func TestMongodbDaoMoMapping_Allocate(t *testing.T) {
 	object1 := "thanhnb(at)2.email"
 	object2 := "09876544321"
 	target := "thanhnb"
-	finalTarget, err := dao.Allocate(_testAppId, map[string]string{ns1: object1, ns2: object2}, target)
+	finalTarget, err := dao.Allocate(_testCtx, _testAppId, map[string]string{ns1: object1, ns2: object2}, target, nil, nil)
 	if err != nil || finalTarget != target {
 		t.Fatalf("%s failed: %e", name, err)
 	}
 
-	bo1, err := dao.FindTargetForObject(_testAppId, ns1, object1)
+	bo1, err := dao.FindTargetForObject(_testCtx, _testAppId, ns1, object1)
 	if bo1 == nil || err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
@@ -329,14 +329,14 @@ func TestMongodbDaoMoMapping_Allocate(t *testing.T) {
 	if bo1.AppId != _testAppId {
 		t.Fatalf("%s failed - expect %#v but received %#v", name, _testAppId, bo1.AppId)
 	}
-	if bo1.From != normalizeMappingObject(ns1, object1) {
-		t.Fatalf("%s failed - expect %#v but received %#v", name, normalizeMappingObject(ns1, object1), bo1.From)
+	if bo1.From != object1 {
+		t.Fatalf("%s failed - expect %#v but received %#v", name, object1, bo1.From)
 	}
 	if bo1.To != normalizeMappingTarget(target) {
 		t.Fatalf("%s failed - expect %#v but received %#v", name, normalizeMappingTarget(target), bo1.To)
 	}
 
-	bo2, err := dao.FindTargetForObject(_testAppId, ns2, object2)
+	bo2, err := dao.FindTargetForObject(_testCtx, _testAppId, ns2, object2)
 	if bo2 == nil || err != nil {
 		t.Fatalf("%s failed: %e", name, err)
 	}
@@ -346,10 +346,31 @@ func TestMongodbDaoMoMapping_Allocate(t *testing.T) {
 	if bo2.AppId != _testAppId {
 		t.Fatalf("%s failed - expect %#v but received %#v", name, _testAppId, bo2.AppId)
 	}
-	if bo2.From != normalizeMappingObject(ns2, object2) {
-		t.Fatalf("%s failed - expect %#v but received %#v", name, normalizeMappingObject(ns2, object2), bo2.From)
+	if bo2.From != object2 {
+		t.Fatalf("%s failed - expect %#v but received %#v", name, object2, bo2.From)
 	}
 	if bo2.To != normalizeMappingTarget(target) {
 		t.Fatalf("%s failed - expect %#v but received %#v", name, normalizeMappingTarget(target), bo2.To)
 	}
 }
+
+/*----------------------------------------------------------------------*/
+
+func TestMongodbDaoApp_Conformance(t *testing.T) {
+	testDaoAppConformance(t, func(t *testing.T) (IDaoApp, func()) {
+		return _initMongodbApps(), nil
+	})
+}
+
+func TestMongodbDaoMoMapping_Conformance(t *testing.T) {
+	testDaoMoMappingConformance(t, func(t *testing.T) (IDaoMoMapping, func()) {
+		return _initMongodbMappings(), nil
+	})
+}
+
+func TestMongodbDaoMoMapping_Conformance_OptimisticAllocate(t *testing.T) {
+	testDaoMoMappingConformance(t, func(t *testing.T) (IDaoMoMapping, func()) {
+		mc := createMongoConnect()
+		return NewMongodbDaoMoMapping(mc, _testMongodbBaseCollectionMappings, allocateStrategyOptimistic), nil
+	})
+}
@@ -0,0 +1,94 @@
+package mom
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const (
+	_testPgsqlTableApps         = "test_apps"
+	_testPgsqlBaseTableMappings = "test_mom"
+)
+
+func _initPgsqlApps() IDaoApp {
+	sqlc := createPgsqlConnect()
+	for _, sqlStm := range pgsqlAppTableStms {
+		if _, err := sqlc.GetDB().Exec(fmt.Sprintf(sqlStm, _testPgsqlTableApps)); err != nil {
+			panic(err)
+		}
+	}
+	_, err := sqlc.GetDB().Exec(fmt.Sprintf("DELETE FROM %s", _testPgsqlTableApps))
+	if err != nil {
+		panic(err)
+	}
+	return NewPgsqlDaoApp(sqlc, _testPgsqlTableApps)
+}
+
+/*----------------------------------------------------------------------*/
+
+func _initPgsqlMappings() IDaoMoMapping {
+	sqlc := createPgsqlConnect()
+	return NewPgsqlDaoMoMapping(sqlc, _testPgsqlBaseTableMappings, false)
+}
+
+func TestPgsqlDaoMoMapping_calcTableName(t *testing.T) {
+	name := "TestPgsqlDaoMoMapping_calcTableName"
+	dao := &PgsqlDaoMoMapping{baseTableName: _testPgsqlBaseTableMappings}
+	longAppId := strings.Repeat("a", 64)
+	appIds := []string{"a-b", "a.b", "a_b", "A_B", "a_b_history", longAppId, longAppId[:63] + "b"}
+	tableNames := map[string]string{}
+	for _, appId := range appIds {
+		for _, tableName := range []string{dao.calcTableName(appId), dao.calcHistoryTableName(appId)} {
+			if len(tableName) > pgsqlMaxIdentifierLen {
+				t.Fatalf("%s failed - table name %#v of app %#v is too long", name, tableName, appId)
+			}
+			if other, ok := tableNames[tableName]; ok {
+				t.Fatalf("%s failed - apps %#v and %#v share table %#v", name, other, appId, tableName)
+			}
+			tableNames[tableName] = appId
+		}
+	}
+	indexName := pgsqlIndexName("uidx", strings.Repeat("t", pgsqlMaxIdentifierLen), "from")
+	if len(indexName) > pgsqlMaxIdentifierLen || indexName == pgsqlIndexName("uidx", strings.Repeat("t", pgsqlMaxIdentifierLen-1)+"u", "from") {
+		t.Fatalf("%s failed - long index name %#v is truncated or collides", name, indexName)
+	}
+}
+
+func TestPgsqlDaoMoMapping_InitStorage(t *testing.T) {
+	name := "TestPgsqlDaoMoMapping_InitStorage"
+	dao := _initPgsqlMappings()
+	err := dao.InitStorage(_testCtx, _testAppId)
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+}
+
+func TestPgsqlDaoMoMapping_DestroyStorage(t *testing.T) {
+	name := "TestPgsqlDaoMoMapping_DestroyStorage"
+	dao := _initPgsqlMappings()
+	err := dao.DestroyStorage(_testCtx, _testAppId)
+	if err != nil {
+		t.Fatalf("%s failed: %e", name, err)
+	}
+}
+
+/*----------------------------------------------------------------------*/
+
+func TestPgsqlDaoApp_Conformance(t *testing.T) {
+	testDaoAppConformance(t, func(t *testing.T) (IDaoApp, func()) {
+		return _initPgsqlApps(), nil
+	})
+}
+
+func TestPgsqlDaoMoMapping_Conformance(t *testing.T) {
+	testDaoMoMappingConformance(t, func(t *testing.T) (IDaoMoMapping, func()) {
+		return _initPgsqlMappings(), nil
+	})
+}
+
+func TestPgsqlDaoMoMapping_ConformanceSharedTable(t *testing.T) {
+	testDaoMoMappingConformance(t, func(t *testing.T) (IDaoMoMapping, func()) {
+		return NewPgsqlDaoMoMapping(createPgsqlConnect(), _testPgsqlBaseTableMappings, true), nil
+	})
+}
@@ -0,0 +1,490 @@
+package mom
+
+import (
+	"context"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	mongo2 "go.mongodb.org/mongo-driver/mongo"
+	"main/src/goems"
+	"main/src/itineris"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+MOM's DAO implementation: retry layer that wraps another IDaoMoMapping and retries operations failing with transient
+database errors.
+
+@author Thanh Nguyen <btnguyen2k@gmail.com>
+@since 0.1.0
+*/
+
+const (
+	// MongoDB errors labeled "TransientTransactionError" or "UnknownTransactionCommitResult"
+	retryErrorMongoTransientTransaction = "mongo_transient_transaction"
+	// MongoDB WriteConflict (code 112)
+	retryErrorMongoWriteConflict = "mongo_write_conflict"
+	// PostgreSQL serialization_failure (SQLSTATE 40001)
+	retryErrorPgSerializationFailure = "pg_serialization_failure"
+	// PostgreSQL deadlock_detected (SQLSTATE 40P01)
+	retryErrorPgDeadlock = "pg_deadlock"
+)
+
+// classifyTransientError returns the retryable class of an error, or empty string if the error is not transient.
+func classifyTransientError(err error) string {
+	switch e := errors.Cause(err).(type) {
+	case mongo2.CommandError:
+		if e.HasErrorLabel("TransientTransactionError") || e.HasErrorLabel("UnknownTransactionCommitResult") {
+			return retryErrorMongoTransientTransaction
+		}
+		if e.Code == 112 {
+			return retryErrorMongoWriteConflict
+		}
+	case mongo2.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == 112 {
+				return retryErrorMongoWriteConflict
+			}
+		}
+		if e.WriteConcernError != nil && e.WriteConcernError.Code == 112 {
+			return retryErrorMongoWriteConflict
+		}
+	case *pq.Error:
+		switch e.Code {
+		case "40001":
+			return retryErrorPgSerializationFailure
+		case "40P01":
+			return retryErrorPgDeadlock
+		}
+	}
+	return ""
+}
+
+/*
+RetryPolicy defines how operations failing with transient errors are retried.
+
+	- MaxAttempts: maximum number of attempts (including the first one), value less than 2 disables retrying.
+	- InitialBackoff: delay before the first retry, doubled after each retry, capped at MaxBackoff.
+	- Jitter: fraction (0.0-1.0) of the delay that is randomized, to avoid retrying in lockstep.
+	- RetryableErrors: classes of errors to retry, see classifyTransientError.
+*/
+type RetryPolicy struct {
+	MaxAttempts     int
+	InitialBackoff  time.Duration
+	MaxBackoff      time.Duration
+	Jitter          float64
+	RetryableErrors map[string]bool
+}
+
+// retryPolicyFromConfig builds a RetryPolicy from application's configurations (section "mom.retry").
+func retryPolicyFromConfig() *RetryPolicy {
+	policy := &RetryPolicy{
+		MaxAttempts:     int(goems.AppConfig.GetInt32("mom.retry.max_attempts", 3)),
+		InitialBackoff:  time.Duration(goems.AppConfig.GetInt64("mom.retry.initial_backoff", 50)) * time.Millisecond,
+		MaxBackoff:      time.Duration(goems.AppConfig.GetInt64("mom.retry.max_backoff", 1000)) * time.Millisecond,
+		Jitter:          goems.AppConfig.GetFloat64("mom.retry.jitter", 0.2),
+		RetryableErrors: map[string]bool{},
+	}
+	errorClasses := goems.AppConfig.GetStringList("mom.retry.retryable_errors")
+	if errorClasses == nil {
+		errorClasses = []string{retryErrorMongoTransientTransaction, retryErrorMongoWriteConflict,
+			retryErrorPgSerializationFailure, retryErrorPgDeadlock}
+	}
+	for _, errorClass := range errorClasses {
+		policy.RetryableErrors[strings.ToLower(strings.TrimSpace(errorClass))] = true
+	}
+	return policy
+}
+
+// isRetryable checks if an error should be retried according to the policy.
+func (p *RetryPolicy) isRetryable(err error) bool {
+	errorClass := classifyTransientError(err)
+	return errorClass != "" && p.RetryableErrors[errorClass]
+}
+
+// backoff calculates the delay before the n-th retry (n starts from 1).
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < n && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		delta := float64(delay) * p.Jitter
+		delay = time.Duration(float64(delay) - delta + rand.Float64()*2*delta)
+	}
+	return delay
+}
+
+/*----------------------------------------------------------------------*/
+
+type retryCounterKey struct{}
+
+// retryCounter counts the number of retries performed while serving an API call.
+type retryCounter struct {
+	retries int64
+}
+
+// withRetryCounter returns a child context carrying a new retryCounter.
+func withRetryCounter(ctx context.Context) (context.Context, *retryCounter) {
+	counter := &retryCounter{}
+	return context.WithValue(ctx, retryCounterKey{}, counter), counter
+}
+
+// incRetryCounter increases the retryCounter carried by the context, if any.
+func incRetryCounter(ctx context.Context) {
+	if counter, ok := ctx.Value(retryCounterKey{}).(*retryCounter); ok {
+		atomic.AddInt64(&counter.retries, 1)
+	}
+}
+
+/*
+RetryInfoFilter reports the number of database retries performed during an API call, by adding field "retries" to
+the "debug" field of API's result (only when retries happened).
+
+This filter should be placed after (i.e. wrapping) itineris.AddPerfInfoFilter.
+*/
+type RetryInfoFilter struct {
+	nextFilter itineris.IApiFilter
+}
+
+/*
+NewRetryInfoFilter creates a new RetryInfoFilter instance.
+*/
+func NewRetryInfoFilter(nextFilter itineris.IApiFilter) *RetryInfoFilter {
+	return &RetryInfoFilter{nextFilter: nextFilter}
+}
+
+/*
+Call implements itineris.IApiFilter.Call
+*/
+func (f *RetryInfoFilter) Call(handler itineris.IApiHandler, ctx *itineris.ApiContext, auth *itineris.ApiAuth, params *itineris.ApiParams) *itineris.ApiResult {
+	goCtx, counter := withRetryCounter(ctx.GetGoContext())
+	ctx.SetGoContext(goCtx)
+	var apiResult *itineris.ApiResult
+	if f.nextFilter != nil {
+		apiResult = f.nextFilter.Call(handler, ctx, auth, params)
+	} else {
+		apiResult = handler(ctx, auth, params)
+	}
+	retries := atomic.LoadInt64(&counter.retries)
+	if apiResult != nil && retries > 0 {
+		// results can be shared instances (e.g. itineris.ResultNotFound), do not modify them
+		apiResult = apiResult.Clone()
+		debugData := map[string]interface{}{}
+		if m, ok := apiResult.DebugInfo.(map[string]interface{}); ok {
+			for k, v := range m {
+				debugData[k] = v
+			}
+		}
+		debugData["retries"] = retries
+		apiResult.SetDebugInfo(debugData)
+	}
+	return apiResult
+}
+
+/*----------------------------------------------------------------------*/
+
+/*
+NewRetryDaoMoMapping wraps an IDaoMoMapping so that its operations are retried on transient errors.
+*/
+func NewRetryDaoMoMapping(dao IDaoMoMapping, policy *RetryPolicy) IDaoMoMapping {
+	return &RetryDaoMoMapping{dao: dao, policy: policy}
+}
+
+/*
+RetryDaoMoMapping is an IDaoMoMapping that retries operations of the wrapped IDaoMoMapping on transient errors.
+*/
+type RetryDaoMoMapping struct {
+	dao    IDaoMoMapping
+	policy *RetryPolicy
+}
+
+// doWithRetry calls 'f' until it succeeds, fails with a non-retryable error, the maximum number of attempts is
+// reached or 'ctx' is done.
+func (dao *RetryDaoMoMapping) doWithRetry(ctx context.Context, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= dao.policy.MaxAttempts || !dao.policy.isRetryable(err) {
+			return err
+		}
+		timer := time.NewTimer(dao.policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		incRetryCounter(ctx)
+	}
+}
+
+/*
+InitStorage implements IDaoMoMapping.InitStorage
+*/
+func (dao *RetryDaoMoMapping) InitStorage(ctx context.Context, appId string) error {
+	return dao.doWithRetry(ctx, func() error {
+		return dao.dao.InitStorage(ctx, appId)
+	})
+}
+
+/*
+DestroyStorage implements IDaoMoMapping.DestroyStorage
+*/
+func (dao *RetryDaoMoMapping) DestroyStorage(ctx context.Context, appId string) error {
+	return dao.doWithRetry(ctx, func() error {
+		return dao.dao.DestroyStorage(ctx, appId)
+	})
+}
+
+/*
+FindTargetForObject implements IDaoMoMapping.FindTargetForObject
+*/
+func (dao *RetryDaoMoMapping) FindTargetForObject(ctx context.Context, appId, namespace, from string) (*BoMapping, error) {
+	var result *BoMapping
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.FindTargetForObject(ctx, appId, namespace, from)
+		return err
+	})
+	return result, err
+}
+
+/*
+FindTargetsForObjects implements IDaoMoMapping.FindTargetsForObjects
+*/
+func (dao *RetryDaoMoMapping) FindTargetsForObjects(ctx context.Context, appId, namespace string, objects []string) ([]*BoMapping, error) {
+	var result []*BoMapping
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.FindTargetsForObjects(ctx, appId, namespace, objects)
+		return err
+	})
+	return result, err
+}
+
+/*
+FindObjectsToTarget implements IDaoMoMapping.FindObjectsToTarget
+*/
+func (dao *RetryDaoMoMapping) FindObjectsToTarget(ctx context.Context, appId, namespace, to string) ([]*BoMapping, error) {
+	var result []*BoMapping
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.FindObjectsToTarget(ctx, appId, namespace, to)
+		return err
+	})
+	return result, err
+}
+
+/*
+FindObjectsToTargetPage implements IDaoMoMapping.FindObjectsToTargetPage
+*/
+func (dao *RetryDaoMoMapping) FindObjectsToTargetPage(ctx context.Context, appId, namespace, to string, page PageRequest) ([]*BoMapping, error) {
+	var result []*BoMapping
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.FindObjectsToTargetPage(ctx, appId, namespace, to, page)
+		return err
+	})
+	return result, err
+}
+
+/*
+FindAllObjectsToTarget implements IDaoMoMapping.FindAllObjectsToTarget
+*/
+func (dao *RetryDaoMoMapping) FindAllObjectsToTarget(ctx context.Context, appId, to string) ([]*BoMapping, error) {
+	var result []*BoMapping
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.FindAllObjectsToTarget(ctx, appId, to)
+		return err
+	})
+	return result, err
+}
+
+/*
+TranslateObject implements IDaoMoMapping.TranslateObject
+*/
+func (dao *RetryDaoMoMapping) TranslateObject(ctx context.Context, appId, namespace, from string, targetNamespaces []string) (*BoMapping, []*BoMapping, error) {
+	var mapping *BoMapping
+	var result []*BoMapping
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		mapping, result, err = dao.dao.TranslateObject(ctx, appId, namespace, from, targetNamespaces)
+		return err
+	})
+	return mapping, result, err
+}
+
+/*
+CountObjectsToTarget implements IDaoMoMapping.CountObjectsToTarget
+*/
+func (dao *RetryDaoMoMapping) CountObjectsToTarget(ctx context.Context, appId, namespace, to string) (int, error) {
+	var result int
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.CountObjectsToTarget(ctx, appId, namespace, to)
+		return err
+	})
+	return result, err
+}
+
+/*
+HasObjects implements IDaoMoMapping.HasObjects
+*/
+func (dao *RetryDaoMoMapping) HasObjects(ctx context.Context, appId, namespace string) (bool, error) {
+	var result bool
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.HasObjects(ctx, appId, namespace)
+		return err
+	})
+	return result, err
+}
+
+/*
+Map implements IDaoMoMapping.Map
+*/
+func (dao *RetryDaoMoMapping) Map(ctx context.Context, appId, namespace, object, target string, expiry *time.Time, attrs map[string]interface{}, uniqueNamespaces []string) (*BoMapping, error) {
+	var result *BoMapping
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.Map(ctx, appId, namespace, object, target, expiry, attrs, uniqueNamespaces)
+		return err
+	})
+	return result, err
+}
+
+/*
+MapMany implements IDaoMoMapping.MapMany
+*/
+func (dao *RetryDaoMoMapping) MapMany(ctx context.Context, appId string, items []*BoMapping, uniqueNamespaces []string) ([]*BoMapping, error) {
+	var result []*BoMapping
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.MapMany(ctx, appId, items, uniqueNamespaces)
+		return err
+	})
+	return result, err
+}
+
+/*
+PatchAttrs implements IDaoMoMapping.PatchAttrs
+*/
+func (dao *RetryDaoMoMapping) PatchAttrs(ctx context.Context, appId, namespace, object string, patch map[string]interface{}) (*BoMapping, error) {
+	var result *BoMapping
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.PatchAttrs(ctx, appId, namespace, object, patch)
+		return err
+	})
+	return result, err
+}
+
+/*
+Unmap implements IDaoMoMapping.Unmap
+*/
+func (dao *RetryDaoMoMapping) Unmap(ctx context.Context, appId, namespace, object, target string) (bool, error) {
+	var result bool
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.Unmap(ctx, appId, namespace, object, target)
+		return err
+	})
+	return result, err
+}
+
+/*
+UnmapMany implements IDaoMoMapping.UnmapMany
+*/
+func (dao *RetryDaoMoMapping) UnmapMany(ctx context.Context, appId string, items []*BoMapping) ([]bool, error) {
+	var result []bool
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.UnmapMany(ctx, appId, items)
+		return err
+	})
+	return result, err
+}
+
+/*
+Remap implements IDaoMoMapping.Remap
+*/
+func (dao *RetryDaoMoMapping) Remap(ctx context.Context, appId, namespace, object, target, expectedTarget string, uniqueNamespaces []string) (*BoMapping, error) {
+	var result *BoMapping
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.Remap(ctx, appId, namespace, object, target, expectedTarget, uniqueNamespaces)
+		return err
+	})
+	return result, err
+}
+
+/*
+MergeTargets implements IDaoMoMapping.MergeTargets
+*/
+func (dao *RetryDaoMoMapping) MergeTargets(ctx context.Context, appId, from, into string, uniqueNamespaces []string) ([]*BoMapping, error) {
+	var result []*BoMapping
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.MergeTargets(ctx, appId, from, into, uniqueNamespaces)
+		return err
+	})
+	return result, err
+}
+
+/*
+SplitTarget implements IDaoMoMapping.SplitTarget
+*/
+func (dao *RetryDaoMoMapping) SplitTarget(ctx context.Context, appId, from string, mapNsObj map[string]string, into string, uniqueNamespaces []string) ([]*BoMapping, error) {
+	var result []*BoMapping
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.SplitTarget(ctx, appId, from, mapNsObj, into, uniqueNamespaces)
+		return err
+	})
+	return result, err
+}
+
+/*
+Allocate implements IDaoMoMapping.Allocate
+*/
+func (dao *RetryDaoMoMapping) Allocate(ctx context.Context, appId string, mapNsObj map[string]string, target string, expiries map[string]time.Time, uniqueNamespaces []string) (string, error) {
+	var result string
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.Allocate(ctx, appId, mapNsObj, target, expiries, uniqueNamespaces)
+		return err
+	})
+	return result, err
+}
+
+/*
+GetMappingHistory implements IDaoMoMapping.GetMappingHistory
+*/
+func (dao *RetryDaoMoMapping) GetMappingHistory(ctx context.Context, appId, namespace, from string) ([]*BoMappingHistory, error) {
+	var result []*BoMappingHistory
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.GetMappingHistory(ctx, appId, namespace, from)
+		return err
+	})
+	return result, err
+}
+
+/*
+SweepExpired implements IDaoMoMapping.SweepExpired
+*/
+func (dao *RetryDaoMoMapping) SweepExpired(ctx context.Context, appId string) (int, error) {
+	var result int
+	err := dao.doWithRetry(ctx, func() error {
+		var err error
+		result, err = dao.dao.SweepExpired(ctx, appId)
+		return err
+	})
+	return result, err
+}
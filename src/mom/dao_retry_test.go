@@ -0,0 +1,134 @@
+package mom
+
+import (
+	"context"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	mongo2 "go.mongodb.org/mongo-driver/mongo"
+	"main/src/itineris"
+	"testing"
+	"time"
+)
+
+// _flakyDaoMoMapping fails Map with the given error 'numFailures' times before delegating to the wrapped DAO.
+type _flakyDaoMoMapping struct {
+	IDaoMoMapping
+	err         error
+	numFailures int
+	numCalls    int
+}
+
+func (dao *_flakyDaoMoMapping) Map(ctx context.Context, appId, namespace, object, target string, expiry *time.Time, attrs map[string]interface{}, uniqueNamespaces []string) (*BoMapping, error) {
+	dao.numCalls++
+	if dao.numCalls <= dao.numFailures {
+		return nil, dao.err
+	}
+	return dao.IDaoMoMapping.Map(ctx, appId, namespace, object, target, expiry, attrs, uniqueNamespaces)
+}
+
+func _testRetryPolicy(maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:     maxAttempts,
+		InitialBackoff:  time.Millisecond,
+		MaxBackoff:      5 * time.Millisecond,
+		Jitter:          0.2,
+		RetryableErrors: map[string]bool{retryErrorPgSerializationFailure: true, retryErrorMongoWriteConflict: true},
+	}
+}
+
+func TestClassifyTransientError(t *testing.T) {
+	name := "TestClassifyTransientError"
+	testData := map[string]error{
+		retryErrorPgSerializationFailure:    &pq.Error{Code: "40001"},
+		retryErrorPgDeadlock:                errors.Wrap(&pq.Error{Code: "40P01"}, "wrapped"),
+		retryErrorMongoWriteConflict:        mongo2.CommandError{Code: 112},
+		retryErrorMongoTransientTransaction: mongo2.CommandError{Labels: []string{"TransientTransactionError"}},
+		"":                                  errors.New("not a transient error"),
+	}
+	for expected, err := range testData {
+		if errorClass := classifyTransientError(err); errorClass != expected {
+			t.Fatalf("%s failed - expect %#v but received %#v", name, expected, errorClass)
+		}
+	}
+	if errorClass := classifyTransientError(&pq.Error{Code: "23505"}); errorClass != "" {
+		t.Fatalf("%s failed - unique violation must not be retryable but received %#v", name, errorClass)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	name := "TestRetryPolicy_Backoff"
+	policy := &RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	expected := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond}
+	for i, d := range expected {
+		if backoff := policy.backoff(i + 1); backoff != d {
+			t.Fatalf("%s failed - retry #%d: expect %s but received %s", name, i+1, d, backoff)
+		}
+	}
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if backoff := policy.backoff(1); backoff < 5*time.Millisecond || backoff > 15*time.Millisecond {
+			t.Fatalf("%s failed - backoff %s out of jitter range", name, backoff)
+		}
+	}
+}
+
+func TestRetryDaoMoMapping_RetryTransientError(t *testing.T) {
+	name := "TestRetryDaoMoMapping_RetryTransientError"
+	flaky := &_flakyDaoMoMapping{IDaoMoMapping: NewMemoryDaoMoMapping(), err: &pq.Error{Code: "40001"}, numFailures: 2}
+	dao := NewRetryDaoMoMapping(flaky, _testRetryPolicy(3))
+	ctx, counter := withRetryCounter(_testCtx)
+	bo, err := dao.Map(ctx, _testAppId, "email", "user@domain.com", "target", nil, nil, nil)
+	if bo == nil || err != nil {
+		t.Fatalf("%s failed: %#v / %e", name, bo, err)
+	}
+	if flaky.numCalls != 3 || counter.retries != 2 {
+		t.Fatalf("%s failed - expect 3 calls/2 retries but received %d/%d", name, flaky.numCalls, counter.retries)
+	}
+}
+
+func TestRetryDaoMoMapping_MaxAttempts(t *testing.T) {
+	name := "TestRetryDaoMoMapping_MaxAttempts"
+	flaky := &_flakyDaoMoMapping{IDaoMoMapping: NewMemoryDaoMoMapping(), err: mongo2.CommandError{Code: 112}, numFailures: 5}
+	dao := NewRetryDaoMoMapping(flaky, _testRetryPolicy(3))
+	if _, err := dao.Map(_testCtx, _testAppId, "email", "user@domain.com", "target", nil, nil, nil); err == nil {
+		t.Fatalf("%s failed - expect error after max attempts", name)
+	}
+	if flaky.numCalls != 3 {
+		t.Fatalf("%s failed - expect %d calls but received %d", name, 3, flaky.numCalls)
+	}
+}
+
+func TestRetryDaoMoMapping_NonRetryableError(t *testing.T) {
+	name := "TestRetryDaoMoMapping_NonRetryableError"
+	testData := []error{errors.New("permanent error"), &pq.Error{Code: "40P01"}} // deadlock class is not enabled in policy
+	for _, e := range testData {
+		flaky := &_flakyDaoMoMapping{IDaoMoMapping: NewMemoryDaoMoMapping(), err: e, numFailures: 1}
+		dao := NewRetryDaoMoMapping(flaky, _testRetryPolicy(3))
+		if _, err := dao.Map(_testCtx, _testAppId, "email", "user@domain.com", "target", nil, nil, nil); err != e {
+			t.Fatalf("%s failed - expect %#v but received %#v", name, e, err)
+		}
+		if flaky.numCalls != 1 {
+			t.Fatalf("%s failed - expect %d calls but received %d", name, 1, flaky.numCalls)
+		}
+	}
+}
+
+func TestRetryInfoFilter(t *testing.T) {
+	name := "TestRetryInfoFilter"
+	flaky := &_flakyDaoMoMapping{IDaoMoMapping: NewMemoryDaoMoMapping(), err: &pq.Error{Code: "40001"}, numFailures: 1}
+	dao := NewRetryDaoMoMapping(flaky, _testRetryPolicy(3))
+	handler := func(ctx *itineris.ApiContext, _ *itineris.ApiAuth, _ *itineris.ApiParams) *itineris.ApiResult {
+		if _, err := dao.Map(ctx.GetGoContext(), _testAppId, "email", "user@domain.com", "target", nil, nil, nil); err != nil {
+			return itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+		}
+		return itineris.ResultOk
+	}
+	result := NewRetryInfoFilter(nil).Call(handler, itineris.NewApiContext(), nil, nil)
+	debugInfo, ok := result.DebugInfo.(map[string]interface{})
+	if result.Status != itineris.StatusOk || !ok || debugInfo["retries"] != int64(1) {
+		t.Fatalf("%s failed - expect 1 retry in debug info but received %#v", name, result)
+	}
+	if itineris.ResultOk.DebugInfo != nil {
+		t.Fatalf("%s failed - shared result instance must not be modified", name)
+	}
+}
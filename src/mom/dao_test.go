@@ -1,6 +1,7 @@
 package mom
 
 import (
+	"context"
 	"time"
 )
 
@@ -20,3 +21,5 @@ var _testApp = &BoApp{
 		"config_int":  103,
 	},
 }
+
+var _testCtx = context.Background()
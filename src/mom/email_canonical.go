@@ -0,0 +1,84 @@
+package mom
+
+import (
+	"fmt"
+	"golang.org/x/net/idna"
+	"strings"
+)
+
+/*
+Canonical email addresses: emails are validated and canonicalized so that addresses delivered to the same mailbox map to
+the same object:
+
+	- local part and domain are lowercased, the domain is IDNA-encoded (e.g. "bücher.de" becomes "xn--bcher-kva.de").
+	- "+tag" sub-addressing is stripped off the local part ("john+news@domain.com" becomes "john@domain.com").
+	- "googlemail.com" is mapped to "gmail.com", and dots are removed from the local part of Gmail addresses.
+
+@author Thanh Nguyen <btnguyen2k@gmail.com>
+@since 0.1.0
+*/
+
+// normalizerEmailCanonical is the name of the canonical email normalizer that apps can choose for their declared
+// namespaces.
+const normalizerEmailCanonical = "email_canonical"
+
+// emailDomainAliases map email domains to their canonical domain.
+var emailDomainAliases = map[string]string{
+	"googlemail.com": "gmail.com",
+}
+
+// emailDotInsensitiveDomains are the (canonical) email domains ignoring dots in local part.
+var emailDotInsensitiveDomains = map[string]bool{
+	"gmail.com": true,
+}
+
+const (
+	emailMaxLocalLength  = 64
+	emailMaxDomainLength = 253
+)
+
+// emailLocalSpecials are the characters, besides letters and digits, allowed in the (unquoted) local part of an email.
+const emailLocalSpecials = "!#$%&'*+-/=?^_`{|}~."
+
+/*
+canonicalizeEmail validates an email address and returns its canonical form. It returns an error if the address is not
+syntactically valid.
+*/
+func canonicalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", fmt.Errorf("email must be in the form local@domain")
+	}
+	local, domain := strings.ToLower(email[:at]), email[at+1:]
+	if len(local) > emailMaxLocalLength {
+		return "", fmt.Errorf("local part must be at most %d characters", emailMaxLocalLength)
+	}
+	if strings.HasPrefix(local, ".") || strings.HasSuffix(local, ".") || strings.Contains(local, "..") {
+		return "", fmt.Errorf("local part must not start or end with a dot, nor contain consecutive dots")
+	}
+	for _, r := range local {
+		if r < 0x80 && !('a' <= r && r <= 'z' || '0' <= r && r <= '9' || strings.ContainsRune(emailLocalSpecials, r)) {
+			return "", fmt.Errorf("invalid character %q in local part", r)
+		}
+	}
+
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil {
+		return "", fmt.Errorf("invalid domain: %s", err.Error())
+	}
+	if !strings.Contains(domain, ".") || len(domain) > emailMaxDomainLength {
+		return "", fmt.Errorf("invalid domain [%s]", domain)
+	}
+	if alias, ok := emailDomainAliases[domain]; ok {
+		domain = alias
+	}
+
+	if plus := strings.Index(local, "+"); plus > 0 {
+		local = local[:plus]
+	}
+	if emailDotInsensitiveDomains[domain] {
+		local = strings.Replace(local, ".", "", -1)
+	}
+	return local + "@" + domain, nil
+}
@@ -0,0 +1,35 @@
+package mom
+
+import "testing"
+
+func TestCanonicalizeEmail(t *testing.T) {
+	name := "TestCanonicalizeEmail"
+	testData := map[string]string{
+		" John.Doe@Domain.COM ":          "john.doe@domain.com",
+		"john.doe+news@domain.com":       "john.doe@domain.com",
+		"J.O.H.N+tag+more@Gmail.com":     "john@gmail.com",
+		"john.doe@googlemail.com":        "johndoe@gmail.com",
+		"+tag@domain.com":                "+tag@domain.com",
+		"user@Bücher.de":                 "user@xn--bcher-kva.de",
+		"user@domain.com.":               "user@domain.com",
+		"o'neil_{x}@sub.domain.org":      "o'neil_{x}@sub.domain.org",
+		"nguyễn@domain.vn":               "nguyễn@domain.vn",
+		"john.doe+news@xn--bcher-kva.de": "john.doe@xn--bcher-kva.de",
+	}
+	for input, expected := range testData {
+		if email, err := canonicalizeEmail(input); err != nil || email != expected {
+			t.Fatalf("%s failed - %#v: expect %#v but received %#v / %e", name, input, expected, email, err)
+		}
+	}
+
+	invalidData := []string{
+		"", "john", "@domain.com", "john@", "john doe@domain.com", "john@doe@domain.com", ".john@domain.com",
+		"john.@domain.com", "jo..hn@domain.com", "john@localhost", "john@do main.com", "john(x)@domain.com",
+		"a2345678901234567890123456789012345678901234567890123456789012345@domain.com",
+	}
+	for _, input := range invalidData {
+		if email, err := canonicalizeEmail(input); err == nil {
+			t.Fatalf("%s failed - %#v: expect error but received %#v", name, input, email)
+		}
+	}
+}
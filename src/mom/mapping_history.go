@@ -0,0 +1,149 @@
+package mom
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Mapping history: every change of a mapping (map, unmap, remap - including moves caused by merging or splitting targets)
+is recorded as a history entry of the mapping's (app, namespace, object), so that past mappings can be looked up.
+
+Entries are recorded in the same transaction as the change where the backend runs the change in a transaction, and right
+after the change otherwise. Mappings of reserved namespaces (e.g. target aliases) are not recorded.
+
+@author Thanh Nguyen <btnguyen2k@gmail.com>
+@since 0.1.0
+*/
+
+const (
+	historyOpMap   = "map"
+	historyOpUnmap = "unmap"
+	historyOpRemap = "remap"
+)
+
+/*
+BoMappingHistory is a history entry of a mapping.
+
+	- Version: 1-based version of the entry among history of the mapping, assigned when history is fetched.
+	- Op: the change, one of "map", "unmap" or "remap".
+	- To: target of the mapping after the change; for "unmap" it is the target the object was unmapped from.
+	- PrevTo: target of the mapping before the change ("remap" and "unmap" only), so that mappings created before history
+	  was recorded can be looked up as of times before their first recorded change.
+	- Time: time of the change.
+	- Expiry: expiry of the mapping after the change, if any.
+*/
+type BoMappingHistory struct {
+	Version   int        `json:"v"`
+	Op        string     `json:"op"`
+	Namespace string     `json:"ns"`
+	From      string     `json:"frm"`
+	To        string     `json:"to"`
+	PrevTo    string     `json:"prev_to,omitempty"`
+	Time      time.Time  `json:"t"`
+	AppId     string     `json:"app"`
+	Expiry    *time.Time `json:"exp,omitempty"`
+}
+
+// newMappingHistory creates the history entry that records a change of a mapping ('prevTo' is the target before the
+// change), or nil if the mapping belongs to a reserved namespace.
+func newMappingHistory(op string, bo *BoMapping, prevTo string) *BoMappingHistory {
+	if isReservedNamespace(bo.Namespace) {
+		return nil
+	}
+	t := bo.Time
+	if op == historyOpUnmap || t.IsZero() {
+		t = time.Now()
+	}
+	if op == historyOpMap {
+		prevTo = ""
+	}
+	return &BoMappingHistory{Op: op, Namespace: bo.Namespace, From: bo.From, To: bo.To, PrevTo: prevTo, Time: t, AppId: bo.AppId, Expiry: bo.Expiry}
+}
+
+// sortMappingHistory sorts history entries by time and assigns their versions.
+//
+// Sort is stable, so entries with the same timestamp keep the order they are stored.
+func sortMappingHistory(entries []*BoMappingHistory) []*BoMappingHistory {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	for i, entry := range entries {
+		entry.Version = i + 1
+	}
+	return entries
+}
+
+// mappingAt returns the mapping as of time 'at' according to history entries (sorted by time), or nil if the object
+// did not map to any target (or the mapping had expired) at that time.
+//
+// If 'at' is before the first entry and that entry is not a "map", the object was mapped before history was recorded:
+// the target before that change is returned (its creation time is unknown, hence the returned mapping has zero time).
+func mappingAt(history []*BoMappingHistory, at time.Time) *BoMapping {
+	var last *BoMappingHistory
+	for _, entry := range history {
+		if entry.Time.After(at) {
+			break
+		}
+		last = entry
+	}
+	if last == nil && len(history) > 0 && history[0].Op != historyOpMap {
+		first := history[0]
+		prevTo := first.PrevTo
+		if prevTo == "" && first.Op == historyOpUnmap {
+			// entries recorded before 'prev_to' was introduced: an object is unmapped from its current target
+			prevTo = first.To
+		}
+		if prevTo == "" {
+			return nil
+		}
+		bo := &BoMapping{Namespace: first.Namespace, From: first.From, To: prevTo, AppId: first.AppId, Expiry: first.Expiry}
+		if bo.isExpired(at) {
+			return nil
+		}
+		return bo
+	}
+	if last == nil || last.Op == historyOpUnmap {
+		return nil
+	}
+	bo := &BoMapping{Namespace: last.Namespace, From: last.From, To: last.To, Time: last.Time, AppId: last.AppId, Expiry: last.Expiry}
+	if bo.isExpired(at) {
+		return nil
+	}
+	return bo
+}
+
+/*
+findTargetForObjectAt returns the mapping of an object as of time 'at', or nil if the object did not map to any target
+at that time.
+
+Mappings created before history was recorded have no history entries, in which case the current mapping is used.
+*/
+func findTargetForObjectAt(ctx context.Context, dao IDaoMoMapping, appId, namespace, from string, at time.Time) (*BoMapping, error) {
+	history, err := dao.GetMappingHistory(ctx, appId, namespace, from)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) > 0 {
+		return mappingAt(history, at), nil
+	}
+	mapping, err := dao.FindTargetForObject(ctx, appId, namespace, from)
+	if err != nil || mapping == nil || mapping.Time.After(at) || mapping.isExpired(at) {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// parseTimestamp parses a timestamp, either in RFC3339 format or as a UNIX epoch in seconds or milliseconds.
+func parseTimestamp(input string) (time.Time, error) {
+	input = strings.TrimSpace(input)
+	if epoch, err := strconv.ParseInt(input, 10, 64); err == nil {
+		if epoch > 1e11 {
+			// too large to be seconds, treat as milliseconds
+			return time.Unix(0, epoch*int64(time.Millisecond)), nil
+		}
+		return time.Unix(epoch, 0), nil
+	}
+	return time.Parse(time.RFC3339Nano, input)
+}
@@ -0,0 +1,69 @@
+package mom
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	name := "TestParseTimestamp"
+	expected := time.Date(2020, 3, 15, 10, 30, 0, 0, time.UTC)
+	testData := []string{"2020-03-15T10:30:00Z", "2020-03-15T17:30:00+07:00", " 1584268200 ", "1584268200000"}
+	for _, input := range testData {
+		at, err := parseTimestamp(input)
+		if err != nil || !at.Equal(expected) {
+			t.Fatalf("%s failed - input %#v: expect %s but received %s / %e", name, input, expected, at, err)
+		}
+	}
+	if _, err := parseTimestamp("last March"); err == nil {
+		t.Fatalf("%s failed - expect error for invalid timestamp", name)
+	}
+}
+
+func TestFindTargetForObjectAt_NoHistory(t *testing.T) {
+	name := "TestFindTargetForObjectAt_NoHistory"
+	dao := NewMemoryDaoMoMapping()
+	// simulate a mapping created before history was recorded
+	storage := dao.(*MemoryDaoMoMapping).getStorage(_testAppId, true)
+	mappingTime := time.Now().Add(-time.Hour)
+	storage.put(&BoMapping{Namespace: "email", From: "user@domain.com", To: "target", Time: mappingTime, AppId: _testAppId})
+
+	bo, err := findTargetForObjectAt(_testCtx, dao, _testAppId, "email", "user@domain.com", time.Now())
+	if err != nil || bo == nil || bo.To != "target" {
+		t.Fatalf("%s failed - expect current mapping but received %#v / %e", name, bo, err)
+	}
+	bo, err = findTargetForObjectAt(_testCtx, dao, _testAppId, "email", "user@domain.com", mappingTime.Add(-time.Minute))
+	if err != nil || bo != nil {
+		t.Fatalf("%s failed - expect no mapping before it was created but received %#v / %e", name, bo, err)
+	}
+}
+
+func TestFindTargetForObjectAt_LegacyMapping(t *testing.T) {
+	name := "TestFindTargetForObjectAt_LegacyMapping"
+	for _, op := range []string{historyOpUnmap, historyOpRemap} {
+		dao := NewMemoryDaoMoMapping()
+		// simulate a mapping created before history was recorded
+		storage := dao.(*MemoryDaoMoMapping).getStorage(_testAppId, true)
+		storage.put(&BoMapping{Namespace: "email", From: "user@domain.com", To: "target", Time: time.Now().Add(-time.Hour), AppId: _testAppId})
+		beforeChange := time.Now()
+		time.Sleep(5 * time.Millisecond)
+		var err error
+		if op == historyOpUnmap {
+			_, err = dao.Unmap(_testCtx, _testAppId, "email", "user@domain.com", "target")
+		} else {
+			_, err = dao.Remap(_testCtx, _testAppId, "email", "user@domain.com", "target2", "", nil)
+		}
+		if err != nil {
+			t.Fatalf("%s failed: %e", name, err)
+		}
+
+		bo, err := findTargetForObjectAt(_testCtx, dao, _testAppId, "email", "user@domain.com", beforeChange)
+		if err != nil || bo == nil || bo.To != "target" {
+			t.Fatalf("%s failed - %s: expect mapping before the change but received %#v / %e", name, op, bo, err)
+		}
+		bo, err = findTargetForObjectAt(_testCtx, dao, _testAppId, "email", "user@domain.com", time.Now())
+		if expected := map[string]string{historyOpUnmap: "", historyOpRemap: "target2"}[op]; err != nil || (bo == nil) != (expected == "") || (bo != nil && bo.To != expected) {
+			t.Fatalf("%s failed - %s: expect %#v after the change but received %#v / %e", name, op, expected, bo, err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package mom
+
+import (
+	"encoding/base64"
+	"fmt"
+	"main/src/itineris"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Paginated reverse lookups: mappings to a target are sorted by mapping time (then by object), and fetched page by page.
+
+A page starts right after a position (time, object), which clients pass around as an opaque cursor: the position of the
+last mapping of the previous page.
+
+@author Thanh Nguyen <btnguyen2k@gmail.com>
+@since 0.1.0
+*/
+
+// PagePosition is the position of a mapping in a list of mappings sorted by time, then by object.
+type PagePosition struct {
+	Time time.Time
+	From string
+}
+
+// PageRequest specifies a page of a list of mappings sorted by time, then by object.
+type PageRequest struct {
+	Limit int           // maximum number of mappings to return, 0 means no limit
+	After *PagePosition // the page starts right after this position, nil means from the beginning of the list
+	Desc  bool          // sort by time in descending order
+}
+
+// positionOf returns the position of a mapping.
+func positionOf(bo *BoMapping) *PagePosition {
+	return &PagePosition{Time: bo.Time, From: bo.From}
+}
+
+// isAfter checks if a mapping comes after the position in the sort order.
+func (p *PagePosition) isAfter(bo *BoMapping, desc bool) bool {
+	if bo.Time.Equal(p.Time) {
+		return bo.From != p.From && (bo.From > p.From) != desc
+	}
+	return bo.Time.After(p.Time) != desc
+}
+
+// encodeCursor encodes a position as an opaque cursor.
+func encodeCursor(p *PagePosition) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(p.Time.UnixNano(), 10) + ":" + p.From))
+}
+
+// decodeCursor decodes a cursor built by encodeCursor.
+func decodeCursor(cursor string) (*PagePosition, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	tokens := strings.SplitN(string(data), ":", 2)
+	if len(tokens) != 2 {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	nanos, err := strconv.ParseInt(tokens[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	return &PagePosition{Time: time.Unix(0, nanos), From: tokens[1]}, nil
+}
+
+// pageMappings sorts mappings and returns the requested page, for backends that can not sort and paginate in storage.
+func pageMappings(mappings []*BoMapping, page PageRequest) []*BoMapping {
+	sort.Slice(mappings, func(i, j int) bool {
+		return positionOf(mappings[i]).isAfter(mappings[j], page.Desc)
+	})
+	result := make([]*BoMapping, 0)
+	for _, bo := range mappings {
+		if page.Limit > 0 && len(result) >= page.Limit {
+			break
+		}
+		if page.After == nil || page.After.isAfter(bo, page.Desc) {
+			result = append(result, bo)
+		}
+	}
+	return result
+}
+
+// parseLimitParam parses a page size parameter. It returns 0 if the parameter is absent; the returned result is non-nil
+// if the parameter is invalid.
+func parseLimitParam(params *itineris.ApiParams, name string) (int, *itineris.ApiResult) {
+	value := params.GetParam(name)
+	if value == nil || value == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(fmt.Sprint(value)))
+	if err != nil || limit <= 0 {
+		return 0, itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [%s]: must be a positive integer.", name))
+	}
+	return limit, nil
+}
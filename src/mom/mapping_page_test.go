@@ -0,0 +1,70 @@
+package mom
+
+import (
+	"main/src/itineris"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	name := "TestCursor"
+	position := &PagePosition{Time: time.Now(), From: "user:with:colons@domain.com"}
+	decoded, err := decodeCursor(encodeCursor(position))
+	if err != nil || !decoded.Time.Equal(position.Time) || decoded.From != position.From {
+		t.Fatalf("%s failed - expect %#v but received %#v / %e", name, position, decoded, err)
+	}
+	for _, cursor := range []string{"not base64!", "bm8tc2VwYXJhdG9y", "YWJjOnVzZXI"} {
+		if _, err := decodeCursor(cursor); err == nil {
+			t.Fatalf("%s failed - expect error for cursor %#v", name, cursor)
+		}
+	}
+}
+
+func TestPageMappings(t *testing.T) {
+	name := "TestPageMappings"
+	now := time.Now()
+	newMappings := func() []*BoMapping {
+		return []*BoMapping{
+			{From: "c", Time: now},
+			{From: "a", Time: now.Add(time.Second)},
+			{From: "b", Time: now},
+		}
+	}
+	testData := []struct {
+		page     PageRequest
+		expected string
+	}{
+		{PageRequest{}, "bca"},
+		{PageRequest{Limit: 2}, "bc"},
+		{PageRequest{After: &PagePosition{Time: now, From: "b"}}, "ca"},
+		{PageRequest{Desc: true}, "acb"},
+		{PageRequest{Desc: true, Limit: 1, After: &PagePosition{Time: now, From: "c"}}, "b"},
+	}
+	for i, test := range testData {
+		objs := ""
+		for _, bo := range pageMappings(newMappings(), test.page) {
+			objs += bo.From
+		}
+		if objs != test.expected {
+			t.Fatalf("%s failed - checkpoint #%d: expect %#v but received %#v", name, i, test.expected, objs)
+		}
+	}
+}
+
+func TestParseLimitParam(t *testing.T) {
+	name := "TestParseLimitParam"
+	testData := map[interface{}]int{"10": 10, float64(20): 20}
+	for input, expected := range testData {
+		if limit, result := parseLimitParam(itineris.NewApiParams().SetParam("limit", input), "limit"); result != nil || limit != expected {
+			t.Fatalf("%s failed - input %#v: expect %d but received %d / %#v", name, input, expected, limit, result)
+		}
+	}
+	if limit, result := parseLimitParam(itineris.NewApiParams(), "limit"); limit != 0 || result != nil {
+		t.Fatalf("%s failed - expect 0 for absent parameter but received %d / %#v", name, limit, result)
+	}
+	for _, input := range []interface{}{"0", "-1", "abc", 1.5} {
+		if _, result := parseLimitParam(itineris.NewApiParams().SetParam("limit", input), "limit"); result == nil || result.Status != itineris.StatusErrorClient {
+			t.Fatalf("%s failed - input %#v: expect status %d but received %#v", name, input, itineris.StatusErrorClient, result)
+		}
+	}
+}
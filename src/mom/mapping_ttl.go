@@ -0,0 +1,112 @@
+package mom
+
+import (
+	"context"
+	"fmt"
+	"github.com/btnguyen2k/consu/reddo"
+	"log"
+	"main/src/goems"
+	"main/src/itineris"
+	"strconv"
+	"time"
+)
+
+/*
+Mapping expiry (TTL): a mapping can be created with a time-to-live, after which it is treated as non-existent (lookups
+do not return it, and the object can be mapped again).
+
+	- TTL is specified per request (parameter 'ttl', in seconds), or falls back to the default TTL of the namespace
+	  (config "mom.ttl.namespaces").
+	- Expired mappings are physically removed by MongoDB's TTL index, or by a periodic sweeper for other backends
+	  (config "mom.ttl.sweep_interval").
+
+@author Thanh Nguyen <btnguyen2k@gmail.com>
+@since 0.1.0
+*/
+
+var (
+	// default TTL of mappings per (normalized) namespace
+	namespaceTtls = map[string]time.Duration{}
+)
+
+// namespaceTtlsFromConfig reads default TTL of namespaces from config "mom.ttl.namespaces" ({namespace: seconds}).
+func namespaceTtlsFromConfig() map[string]time.Duration {
+	result := map[string]time.Duration{}
+	node := goems.AppConfig.GetNode("mom.ttl.namespaces")
+	if node == nil || !node.IsObject() {
+		return result
+	}
+	for ns, value := range node.GetObject().Items() {
+		ttl, err := strconv.ParseInt(value.GetString(), 10, 64)
+		if err != nil {
+			panic("invalid TTL of namespace [" + ns + "] in config [mom.ttl.namespaces]: " + value.GetString())
+		}
+		if ttl > 0 {
+			result[normalizeNamespace(ns)] = time.Duration(ttl) * time.Second
+		}
+	}
+	return result
+}
+
+// parseTtlParam parses a TTL parameter (in seconds). It returns nil if the parameter is absent; the returned result is
+// non-nil if the parameter is invalid.
+func parseTtlParam(params *itineris.ApiParams, name string) (*time.Duration, *itineris.ApiResult) {
+	value := params.GetParam(name)
+	if value == nil || value == "" {
+		return nil, nil
+	}
+	seconds, err := reddo.ToInt(value)
+	if _, isBool := value.(bool); isBool || err != nil || seconds < 0 {
+		return nil, itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [%s]: must be a non-negative number of seconds.", name))
+	}
+	ttl := time.Duration(seconds) * time.Second
+	return &ttl, nil
+}
+
+// mappingExpiry calculates expiry of a new mapping in a (normalized) namespace: 'ttl' if specified (zero means the
+// mapping never expires), or the namespace's default TTL otherwise. It returns nil if the mapping never expires.
+func mappingExpiry(namespace string, ttl *time.Duration, now time.Time) *time.Time {
+	var d time.Duration
+	if ttl != nil {
+		d = *ttl
+	} else {
+		d = namespaceTtls[namespace]
+	}
+	if d <= 0 {
+		return nil
+	}
+	expiry := now.Add(d)
+	return &expiry
+}
+
+// sweepExpiredMappings removes expired mappings of all apps.
+func sweepExpiredMappings(ctx context.Context) {
+	apps, err := daoApp.GetAll()
+	if err != nil {
+		log.Printf("Error while sweeping expired mappings: %e", err)
+		return
+	}
+	for _, app := range apps {
+		numRemoved, err := daoMappings.SweepExpired(ctx, app.Id)
+		if err != nil {
+			log.Printf("Error while sweeping expired mappings of app [%s]: %e", app.Id, err)
+		} else if numRemoved > 0 {
+			log.Printf("Removed %d expired mapping(s) of app [%s]", numRemoved, app.Id)
+		}
+	}
+}
+
+// startExpirySweeper runs sweepExpiredMappings periodically in background. Sweeper is disabled if 'interval' is not
+// positive.
+func startExpirySweeper(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sweepExpiredMappings(context.Background())
+		}
+	}()
+}
@@ -0,0 +1,60 @@
+package mom
+
+import (
+	"main/src/itineris"
+	"testing"
+	"time"
+)
+
+func TestParseTtlParam(t *testing.T) {
+	name := "TestParseTtlParam"
+	testData := map[interface{}]time.Duration{"60": time.Minute, float64(3600): time.Hour, 0: 0}
+	for input, expected := range testData {
+		ttl, result := parseTtlParam(itineris.NewApiParams().SetParam("ttl", input), "ttl")
+		if result != nil || ttl == nil || *ttl != expected {
+			t.Fatalf("%s failed - input %#v: expect %s but received %#v / %#v", name, input, expected, ttl, result)
+		}
+	}
+	if ttl, result := parseTtlParam(itineris.NewApiParams(), "ttl"); ttl != nil || result != nil {
+		t.Fatalf("%s failed - expect nil for absent parameter but received %#v / %#v", name, ttl, result)
+	}
+	for _, input := range []interface{}{"-1", "1 day", true} {
+		if _, result := parseTtlParam(itineris.NewApiParams().SetParam("ttl", input), "ttl"); result == nil || result.Status != itineris.StatusErrorClient {
+			t.Fatalf("%s failed - input %#v: expect status %d but received %#v", name, input, itineris.StatusErrorClient, result)
+		}
+	}
+}
+
+func TestMappingExpiry(t *testing.T) {
+	name := "TestMappingExpiry"
+	defer func(ttls map[string]time.Duration) { namespaceTtls = ttls }(namespaceTtls)
+	namespaceTtls = map[string]time.Duration{"session": time.Hour}
+	now := time.Now()
+	ttl, noTtl := time.Minute, time.Duration(0)
+
+	if expiry := mappingExpiry("session", nil, now); expiry == nil || !expiry.Equal(now.Add(time.Hour)) {
+		t.Fatalf("%s failed - expect namespace's default TTL but received %#v", name, expiry)
+	}
+	if expiry := mappingExpiry("session", &ttl, now); expiry == nil || !expiry.Equal(now.Add(time.Minute)) {
+		t.Fatalf("%s failed - expect requested TTL but received %#v", name, expiry)
+	}
+	if expiry := mappingExpiry("session", &noTtl, now); expiry != nil {
+		t.Fatalf("%s failed - expect TTL 0 to never expire but received %#v", name, expiry)
+	}
+	if expiry := mappingExpiry("email", nil, now); expiry != nil {
+		t.Fatalf("%s failed - expect no default TTL but received %#v", name, expiry)
+	}
+}
+
+func TestMappingAt_Expired(t *testing.T) {
+	name := "TestMappingAt_Expired"
+	mappingTime := time.Now().Add(-time.Hour)
+	expiry := mappingTime.Add(time.Minute)
+	history := []*BoMappingHistory{{Op: historyOpMap, Namespace: "email", From: "user@domain.com", To: "target", Time: mappingTime, Expiry: &expiry}}
+	if bo := mappingAt(history, mappingTime.Add(time.Second)); bo == nil || bo.To != "target" {
+		t.Fatalf("%s failed - expect mapping before it expired but received %#v", name, bo)
+	}
+	if bo := mappingAt(history, expiry); bo != nil {
+		t.Fatalf("%s failed - expect no mapping once expired but received %#v", name, bo)
+	}
+}
@@ -7,7 +7,9 @@ Many-to-one mapping service.
 package mom
 
 import (
+	"context"
 	"github.com/btnguyen2k/prom"
+	bolt "go.etcd.io/bbolt"
 	"log"
 	"main/src/goems"
 	"main/src/itineris"
@@ -32,6 +34,8 @@ var (
 	Bootstrapper = &MyBootstrapper{name: "mom"}
 
 	mongoConnect        *prom.MongoConnect
+	sqlConnect          *prom.SqlConnect
+	boltDb              *bolt.DB
 	daoMappings         IDaoMoMapping
 	daoApp              IDaoApp
 	startupTime         = time.Now()
@@ -47,10 +51,14 @@ Bootstrapper usually does:
 */
 func (b *MyBootstrapper) Bootstrap() error {
 	arbitraryTargetMode = goems.AppConfig.GetBoolean("mom.arbitrary_target_mode", false)
+	namespaceTtls = namespaceTtlsFromConfig()
+	normalizerMappings = normalizersFromConfig(normalizerMappings)
+	batchMaxItems = int(goems.AppConfig.GetInt32("mom.batch.max_items", 1000))
 
 	initFilters()
 	initDaos()
 	initApiHandlers(goems.ApiRouter)
+	startExpirySweeper(time.Duration(goems.AppConfig.GetInt64("mom.ttl.sweep_interval", 60)) * time.Second)
 
 	return nil
 }
@@ -66,6 +74,7 @@ func initFilters() {
 	// suggested order of filters:
 	// - Request logger should be the last one to capture full request/response
 	apiFilter = itineris.NewAddPerfInfoFilter(goems.ApiRouter, apiFilter)
+	apiFilter = NewRetryInfoFilter(apiFilter)
 	apiFilter = itineris.NewLoggingFilter(goems.ApiRouter, apiFilter, itineris.NewWriterPerfLogger(os.Stderr, appName, appVersion))
 	apiFilter = itineris.NewAuthenticationFilter(goems.ApiRouter, apiFilter, NewMomApiAuthenticator())
 	apiFilter = itineris.NewLoggingFilter(goems.ApiRouter, apiFilter, itineris.NewWriterRequestLogger(os.Stdout, appName, appVersion))
@@ -77,35 +86,63 @@ func initDaos() {
 	if strings.EqualFold("mongo", dbtype) || strings.EqualFold("mongodb", dbtype) {
 		// dbtype=MongoDB
 		mongoConnect = createMongoConnect()
-		err := initData(dbtype)
-		if err != nil {
-			panic(err)
-		}
-
 		daoApp = NewMongodbDaoApp(mongoConnect, collectionApps)
-		daoMappings = NewMongodbDaoMoMapping(mongoConnect, baseCollectionMom)
+		allocateStrategy := goems.AppConfig.GetString("mom.mongodb.allocate_strategy", allocateStrategyTransaction)
+		daoMappings = NewMongodbDaoMoMapping(mongoConnect, baseCollectionMom, allocateStrategy)
+	} else if strings.EqualFold("pgsql", dbtype) || strings.EqualFold("postgres", dbtype) || strings.EqualFold("postgresql", dbtype) {
+		// dbtype=PostgreSQL
+		sqlConnect = createPgsqlConnect()
+		sharedTable := goems.AppConfig.GetBoolean("mom.postgresql.shared_table", false)
+		daoApp = NewPgsqlDaoApp(sqlConnect, tableApps)
+		daoMappings = NewPgsqlDaoMoMapping(sqlConnect, baseTableMom, sharedTable)
+	} else if strings.EqualFold("embedded", dbtype) || strings.EqualFold("bolt", dbtype) || strings.EqualFold("boltdb", dbtype) {
+		// dbtype=embedded single-file storage
+		boltDb = createBoltConnect()
+		daoApp = NewBoltDaoApp(boltDb, bucketApps)
+		daoMappings = NewBoltDaoMoMapping(boltDb, baseBucketMom)
+	} else if strings.EqualFold("memory", dbtype) || strings.EqualFold("inmem", dbtype) {
+		// dbtype=in-memory, data is lost when the process exits
+		daoApp = NewMemoryDaoApp()
+		daoMappings = NewMemoryDaoMoMapping()
+	} else {
+		panic("Unknown database type: [" + dbtype + "].")
+	}
+	if retryPolicy := retryPolicyFromConfig(); retryPolicy.MaxAttempts > 1 {
+		daoMappings = NewRetryDaoMoMapping(daoMappings, retryPolicy)
+	}
+	if err := initData(dbtype); err != nil {
+		panic(err)
+	}
 
-		appSystem = goems.AppConfig.GetString("mom.system_app_name", "system")
-		app, err := daoApp.Get(appSystem)
-		if err != nil {
-			panic(err)
-		}
-		if app == nil {
-			log.Printf("Creating system app...")
-			secret := goems.AppConfig.GetString("mom.system_app_secret", appSystem)
-			app = &BoApp{
-				Id:     appSystem,
-				Secret: utils.Sha1SumStr(appSystem + "." + secret),
-				Time:   time.Now(),
-				Config: nil,
-			}
+	appSystem = goems.AppConfig.GetString("mom.system_app_name", "system")
+	app, err := daoApp.Get(appSystem)
+	if err != nil {
+		panic(err)
+	}
+	if app == nil {
+		log.Printf("Creating system app...")
+		secret := goems.AppConfig.GetString("mom.system_app_secret", appSystem)
+		app = &BoApp{
+			Id:     appSystem,
+			Secret: utils.Sha1SumStr(appSystem + "." + secret),
+			Time:   time.Now(),
+			Config: nil,
 		}
-		if _, err := daoApp.Create(app); err != nil {
+	}
+	if _, err := daoApp.Create(app); err != nil {
+		panic(err)
+	}
+
+	// storage of existing apps is upgraded to the current schema (e.g. expiry column/TTL index)
+	apps, err := daoApp.GetAll()
+	if err != nil {
+		panic(err)
+	}
+	for _, app := range apps {
+		if err := daoMappings.InitStorage(context.Background(), app.Id); err != nil {
 			panic(err)
 		}
-		return
 	}
-	panic("Unknown database type: [" + dbtype + "].")
 }
 
 /*
@@ -121,12 +158,25 @@ func initApiHandlers(router *itineris.ApiRouter) {
 	router.SetHandler("getApp", apiGetApp)
 	router.SetHandler("updateApp", apiUpdateApp)
 	router.SetHandler("deleteApp", apiDeleteApp)
+	router.SetHandler("getNamespaceRegistry", apiGetNamespaceRegistry)
+	router.SetHandler("setNamespaceStrictMode", apiSetNamespaceStrictMode)
+	router.SetHandler("declareNamespace", apiDeclareNamespace)
+	router.SetHandler("undeclareNamespace", apiUndeclareNamespace)
 
 	router.SetHandler("mapObjectToTarget", apiMapObjectToTarget)
 	router.SetHandler("getMappingForObject", apiGetMappingForObject)
+	router.SetHandler("patchMappingAttrs", apiPatchMappingAttrs)
+	router.SetHandler("lookupMappings", apiLookupMappings)
+	router.SetHandler("mapObjectsToTargets", apiMapObjectsToTargets)
+	router.SetHandler("unmapObjectsToTargets", apiUnmapObjectsToTargets)
 	router.SetHandler("unmapObjectToTarget", apiUnmapObjectToTarget)
+	router.SetHandler("remapObjectToTarget", apiRemapObjectToTarget)
 	router.SetHandler("getReverseMappinngsForTarget", apiGetReverseMappinngsForTarget)
+	router.SetHandler("translateObject", apiTranslateObject)
 	router.SetHandler("allocateTargetAndMap", apiAllocateTargetAndMap)
+	router.SetHandler("mergeTargets", apiMergeTargets)
+	router.SetHandler("splitTarget", apiSplitTarget)
+	router.SetHandler("getMappingHistory", apiGetMappingHistory)
 }
 
 /*
@@ -38,6 +38,16 @@ var normalizerMappings = map[string]INameNormalizer{
 	"mobile_num":    phoneNormalizer,
 }
 
+/*
+namedNormalizers are the normalizers that apps can choose for their declared namespaces, by name.
+*/
+var namedNormalizers = map[string]INameNormalizer{
+	"default": defaultNormalizer,
+	"email":   emailNormalizer,
+	"phone":   phoneNormalizer,
+	"unicode": unicodeNormalizer,
+}
+
 /*
 defaultNormalizer trims leading and trailing spaces off input.
 */
@@ -0,0 +1,295 @@
+package mom
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/btnguyen2k/consu/reddo"
+	"main/src/itineris"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+Namespace registry: an app can declare its namespaces, each with its own policies:
+
+	- normalizer: name of the normalizer applied to objects of the namespace (see namedNormalizers, normalizerE164 and
+	  normalizerEmailCanonical), instead of the built-in normalization.
+	- region: default region of phone numbers parsed by normalizer "e164", overriding the app's region.
+	- keep_raw: objects are stored, as received, in attribute "raw" of mappings created by APIs accepting attributes.
+	- validation: regular expression that normalized objects must match to be mapped.
+	- ttl: default TTL of new mappings in the namespace, overriding config "mom.ttl.namespaces".
+	- unique: a target can have at most one object in the namespace.
+
+In strict mode, APIs creating mappings reject namespaces that are not declared. The registry is stored alongside the
+app (BoApp.Namespaces). Existing mappings are never re-normalized, hence changing how objects of a namespace with
+existing mappings are normalized must be confirmed (see checkNormalizationChange).
+
+@author Thanh Nguyen <btnguyen2k@gmail.com>
+@since 0.1.0
+*/
+
+// BoNamespace defines the policies of a declared namespace.
+type BoNamespace struct {
+	Normalizer string `json:"normalizer,omitempty"` // name of the normalizer, empty means the built-in normalization only
+	Validation string `json:"validation,omitempty"` // regular expression normalized objects must match, empty means no validation
+	Ttl        *int64 `json:"ttl,omitempty"`        // default TTL of new mappings in seconds (0: never expire), nil means the config's default
+	Unique     bool   `json:"unique,omitempty"`     // a target can have at most one object in the namespace
+	Region     string `json:"region,omitempty"`     // default region of normalizer "e164", empty means the app's region
+	KeepRaw    bool   `json:"keep_raw,omitempty"`   // store objects as received in attribute "raw" of new mappings
+}
+
+// attrRawObject is the mapping attribute holding the object as received, for namespaces declared with "keep_raw".
+const attrRawObject = "raw"
+
+// isKnownNormalizer checks if apps can choose a normalizer for their declared namespaces.
+func isKnownNormalizer(name string) bool {
+	_, ok := namedNormalizers[name]
+	return ok || name == normalizerE164 || name == normalizerEmailCanonical
+}
+
+// BoNamespaceRegistry holds the namespaces declared by an app.
+type BoNamespaceRegistry struct {
+	Strict     bool                    `json:"strict"`     // if true, undeclared namespaces are rejected by APIs creating mappings
+	Namespaces map[string]*BoNamespace `json:"namespaces"` // declared namespaces, keys are normalized namespaces
+
+	pipelines map[string]INameNormalizer // normalizer pipelines of the app's config, keys are normalized namespaces
+	region    string                     // default region of normalizer "e164" from the app's config
+}
+
+// get returns the declaration of a (normalized) namespace, nil if the namespace is not declared.
+func (r *BoNamespaceRegistry) get(namespace string) *BoNamespace {
+	if r == nil {
+		return nil
+	}
+	return r.Namespaces[namespace]
+}
+
+// normalizeObject normalizes an object of a (normalized) namespace with the app's normalizer pipeline, or the declared
+// normalizer, or the built-in normalization (in this order): the first one that applies replaces the others. The
+// returned result is non-nil if the object can not be normalized (e.g. an unparsable phone number in a namespace with
+// normalizer "e164").
+//
+// This is the only place objects are normalized: DAOs store and look up objects as given.
+func (r *BoNamespaceRegistry) normalizeObject(namespace, obj string) (string, *itineris.ApiResult) {
+	if r != nil && r.pipelines[namespace] != nil {
+		return r.pipelines[namespace](obj), nil
+	}
+	decl := r.get(namespace)
+	if decl == nil || decl.Normalizer == "" {
+		return normalizeMappingObject(namespace, obj), nil
+	}
+	normalized, err := obj, error(nil)
+	switch decl.Normalizer {
+	case normalizerE164:
+		region := decl.Region
+		if region == "" {
+			region = r.region
+		}
+		normalized, err = parsePhoneE164(obj, region)
+	case normalizerEmailCanonical:
+		normalized, err = canonicalizeEmail(obj)
+	default:
+		if normalizer := namedNormalizers[decl.Normalizer]; normalizer != nil {
+			normalized = normalizer(obj)
+		}
+	}
+	if err != nil {
+		return "", itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Object [%s] is not valid in namespace [%s]: %s.", obj, namespace, err.Error()))
+	}
+	return normalized, nil
+}
+
+// normalizationOf describes how an app normalizes objects of a (normalized) namespace (see normalizeObject): objects are
+// normalized the same way if the descriptions are equal. Empty description means the built-in normalization.
+func normalizationOf(app *BoApp, namespace string) string {
+	if specs, ok := app.Config["normalizers"].(map[string]interface{}); ok {
+		for ns, spec := range specs {
+			if normalizeNamespace(ns) == namespace {
+				// specs are compared as JSON, as they may be decoded to different types (e.g. loaded from storage)
+				js, _ := json.Marshal(spec)
+				return "pipeline:" + string(js)
+			}
+		}
+	}
+	decl := app.Namespaces.get(namespace)
+	if decl == nil {
+		return ""
+	}
+	if decl.Normalizer != normalizerE164 {
+		return decl.Normalizer
+	}
+	region := decl.Region
+	if region == "" {
+		region, _ = appPhoneRegion(app.Config)
+	}
+	return decl.Normalizer + ":" + region
+}
+
+// normalizedNamespaces returns the (normalized) namespaces whose normalization is customized by an app, either by a
+// normalizer pipeline of its config or by a declared normalizer.
+func normalizedNamespaces(app *BoApp) []string {
+	result := make([]string, 0)
+	if specs, ok := app.Config["normalizers"].(map[string]interface{}); ok {
+		for ns := range specs {
+			result = append(result, normalizeNamespace(ns))
+		}
+	}
+	if app.Namespaces != nil {
+		for ns, decl := range app.Namespaces.Namespaces {
+			if decl != nil && decl.Normalizer != "" {
+				result = append(result, ns)
+			}
+		}
+	}
+	return result
+}
+
+// withRawObject returns the attributes of a new mapping in a (normalized) namespace: if the namespace is declared with
+// "keep_raw", the object as received is added as attribute "raw" (the input attributes are not modified).
+func (r *BoNamespaceRegistry) withRawObject(namespace, raw string, attrs map[string]interface{}) map[string]interface{} {
+	if decl := r.get(namespace); decl == nil || !decl.KeepRaw {
+		return attrs
+	}
+	result := map[string]interface{}{attrRawObject: raw}
+	for k, v := range attrs {
+		if k != attrRawObject {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// checkMappingObject checks if a (normalized) object can be mapped in a (normalized) namespace: the namespace must be
+// declared in strict mode, and the object must pass the namespace's validation. It returns nil if the check passes.
+func (r *BoNamespaceRegistry) checkMappingObject(namespace, obj string) *itineris.ApiResult {
+	if r == nil {
+		return nil
+	}
+	decl := r.get(namespace)
+	if decl == nil {
+		if r.Strict {
+			return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Namespace [%s] is not declared.", namespace))
+		}
+		return nil
+	}
+	if decl.Validation != "" {
+		if re, err := compileValidation(decl.Validation); err != nil || !re.MatchString(obj) {
+			return itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Object [%s] is not valid in namespace [%s].", obj, namespace))
+		}
+	}
+	return nil
+}
+
+// ttl returns the TTL of new mappings in a (normalized) namespace: 'ttl' if specified, or the namespace's declared TTL.
+// It returns nil if neither is specified (the config's default applies then).
+func (r *BoNamespaceRegistry) ttl(namespace string, ttl *time.Duration) *time.Duration {
+	if ttl != nil {
+		return ttl
+	}
+	if decl := r.get(namespace); decl != nil && decl.Ttl != nil {
+		d := time.Duration(*decl.Ttl) * time.Second
+		return &d
+	}
+	return nil
+}
+
+// uniqueNamespaces returns the declared namespaces with uniqueness policy, sorted.
+func (r *BoNamespaceRegistry) uniqueNamespaces() []string {
+	result := make([]string, 0)
+	if r == nil {
+		return result
+	}
+	for ns, decl := range r.Namespaces {
+		if decl.Unique {
+			result = append(result, ns)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// uniqueConflictResult builds the itineris.StatusConflict result for a mapping violating a namespace's uniqueness
+// policy (see UniqueConflictError), the target's existing mapping is returned in `data` field.
+func uniqueConflictResult(mapping *BoMapping) *itineris.ApiResult {
+	msg := (&UniqueConflictError{Mapping: mapping}).Error()
+	return itineris.NewApiResult(itineris.StatusConflict).SetMessage(msg).SetData(mapping)
+}
+
+var validationCache sync.Map // cache of compiled validation rules {string: *regexp.Regexp}
+
+// compileValidation compiles a validation rule, compiled rules are cached.
+func compileValidation(validation string) (*regexp.Regexp, error) {
+	if re, ok := validationCache.Load(validation); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(validation)
+	if err != nil {
+		return nil, err
+	}
+	validationCache.Store(validation, re)
+	return re, nil
+}
+
+// namespaceRegistryOf returns the namespace registry of an app, along with the normalizer pipelines of the app's config.
+// The app loaded during authentication is used if available. The returned result is non-nil if the app can not be
+// loaded.
+func namespaceRegistryOf(ctx *itineris.ApiContext, appId string) (*BoNamespaceRegistry, *itineris.ApiResult) {
+	app, _ := ctx.GetContextValue(ctxApp).(*BoApp)
+	if app == nil || app.Id != appId {
+		var err error
+		if app, err = daoApp.Get(appId); err != nil {
+			return nil, itineris.NewApiResult(itineris.StatusErrorServer).SetMessage(err.Error())
+		}
+	}
+	if app == nil {
+		return nil, nil
+	}
+	registry := &BoNamespaceRegistry{}
+	if app.Namespaces != nil {
+		*registry = *app.Namespaces
+	}
+	// pipelines and region are validated when the app's config is saved
+	registry.pipelines, _ = appPipelines(app.Config)
+	registry.region, _ = appPhoneRegion(app.Config)
+	return registry, nil
+}
+
+// parseNamespaceDeclaration parses the policies of a namespace declaration. The returned result is non-nil if the
+// parameters are invalid.
+func parseNamespaceDeclaration(params *itineris.ApiParams) (*BoNamespace, *itineris.ApiResult) {
+	decl := &BoNamespace{}
+	decl.Normalizer, _ = parseParam(params, "normalizer", nil)
+	if decl.Normalizer != "" && !isKnownNormalizer(decl.Normalizer) {
+		return nil, itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [normalizer]: unknown normalizer [%s].", decl.Normalizer))
+	}
+	region, _ := parseParam(params, "region", nil)
+	var err error
+	if decl.Region, err = normalizePhoneRegion(region); err != nil {
+		return nil, itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [region]: %s.", err.Error()))
+	}
+	decl.Validation, _ = parseParam(params, "validation", nil)
+	if _, err := compileValidation(decl.Validation); decl.Validation != "" && err != nil {
+		return nil, itineris.NewApiResult(itineris.StatusErrorClient).SetMessage(fmt.Sprintf("Invalid parameter [validation]: %s", err.Error()))
+	}
+	ttl, result := parseTtlParam(params, "ttl")
+	if result != nil {
+		return nil, result
+	}
+	if ttl != nil {
+		seconds := int64(*ttl / time.Second)
+		decl.Ttl = &seconds
+	}
+	if unique := params.GetParam("unique"); unique != nil {
+		if decl.Unique, err = reddo.ToBool(unique); err != nil {
+			return nil, itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Invalid parameter [unique]: must be a boolean.")
+		}
+	}
+	if keepRaw := params.GetParam("keep_raw"); keepRaw != nil {
+		if decl.KeepRaw, err = reddo.ToBool(keepRaw); err != nil {
+			return nil, itineris.NewApiResult(itineris.StatusErrorClient).SetMessage("Invalid parameter [keep_raw]: must be a boolean.")
+		}
+	}
+	return decl, nil
+}
@@ -0,0 +1,185 @@
+package mom
+
+import (
+	"main/src/itineris"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func _testNamespaceRegistry() *BoNamespaceRegistry {
+	day := int64(86400)
+	return &BoNamespaceRegistry{Namespaces: map[string]*BoNamespace{
+		"login":   {Normalizer: "email", Validation: `^[^@]+@[^@]+$`, Unique: true},
+		"email":   {Normalizer: "default"},
+		"session": {Ttl: &day},
+	}}
+}
+
+func TestBoNamespaceRegistry_NormalizeObject(t *testing.T) {
+	name := "TestBoNamespaceRegistry_NormalizeObject"
+	reg := _testNamespaceRegistry()
+	testData := map[string][]string{
+		"login":   {" User@Domain.COM ", "user@domain.com"},
+		"email":   {" User@Domain.COM ", "User@Domain.COM"}, // declared normalizer replaces the built-in one
+		"mobile":  {" +84 912-345 ", "84912345"},             // undeclared namespace: built-in normalization
+		"session": {" Abc ", "Abc"},
+	}
+	for ns, data := range testData {
+		if obj, result := reg.normalizeObject(ns, data[0]); result != nil || obj != data[1] {
+			t.Fatalf("%s failed - namespace %#v: expect %#v but received %#v / %#v", name, ns, data[1], obj, result)
+		}
+		var nilReg *BoNamespaceRegistry
+		expected := normalizeMappingObject(ns, data[0])
+		if obj, _ := nilReg.normalizeObject(ns, data[0]); obj != expected {
+			t.Fatalf("%s failed - namespace %#v: expect %#v without registry but received %#v", name, ns, expected, obj)
+		}
+	}
+}
+
+func TestBoNamespaceRegistry_NormalizeObjectE164(t *testing.T) {
+	name := "TestBoNamespaceRegistry_NormalizeObjectE164"
+	reg := &BoNamespaceRegistry{region: "VN", Namespaces: map[string]*BoNamespace{
+		"msisdn":  {Normalizer: normalizerE164},
+		"us_cell": {Normalizer: normalizerE164, Region: "US"},
+	}}
+	testData := map[string][][]string{
+		"msisdn":  {{"0912345678", "+84912345678"}, {"+84 912 345 678", "+84912345678"}, {"0084-912-345-678", "+84912345678"}},
+		"us_cell": {{"(415) 555-2671", "+14155552671"}, {"1 415 555 2671", "+14155552671"}, {"+84912345678", "+84912345678"}},
+	}
+	for ns, list := range testData {
+		for _, data := range list {
+			if obj, result := reg.normalizeObject(ns, data[0]); result != nil || obj != data[1] {
+				t.Fatalf("%s failed - namespace %#v: expect %#v but received %#v / %#v", name, ns, data[1], obj, result)
+			}
+		}
+	}
+	for _, obj := range []string{"", "abc", "09123x45678", "+0912345678", "12"} {
+		if _, result := reg.normalizeObject("msisdn", obj); result == nil || result.Status != itineris.StatusErrorClient {
+			t.Fatalf("%s failed - object %#v: expect status %d but received %#v", name, obj, itineris.StatusErrorClient, result)
+		}
+	}
+}
+
+func TestBoNamespaceRegistry_NormalizeObjectEmailCanonical(t *testing.T) {
+	name := "TestBoNamespaceRegistry_NormalizeObjectEmailCanonical"
+	reg := &BoNamespaceRegistry{Namespaces: map[string]*BoNamespace{"login": {Normalizer: normalizerEmailCanonical}}}
+	if obj, result := reg.normalizeObject("login", " J.Doe+promo@GoogleMail.com "); result != nil || obj != "jdoe@gmail.com" {
+		t.Fatalf("%s failed: expect %#v but received %#v / %#v", name, "jdoe@gmail.com", obj, result)
+	}
+	if _, result := reg.normalizeObject("login", "not-an-email"); result == nil || result.Status != itineris.StatusErrorClient {
+		t.Fatalf("%s failed: expect status %d but received %#v", name, itineris.StatusErrorClient, result)
+	}
+}
+
+func TestNormalizationOf(t *testing.T) {
+	name := "TestNormalizationOf"
+	app := &BoApp{
+		Config: map[string]interface{}{"phone_region": "VN", "normalizers": map[string]interface{}{"Login": []interface{}{"email"}}},
+		Namespaces: &BoNamespaceRegistry{Namespaces: map[string]*BoNamespace{
+			"email":   {Normalizer: normalizerEmailCanonical},
+			"msisdn":  {Normalizer: normalizerE164},
+			"us_cell": {Normalizer: normalizerE164, Region: "US"},
+			"session": {Ttl: new(int64)},
+		}},
+	}
+	before := map[string]string{}
+	for _, ns := range []string{"login", "email", "msisdn", "us_cell", "session", "other"} {
+		before[ns] = normalizationOf(app, ns)
+	}
+	if before["session"] != "" || before["other"] != "" || before["msisdn"] == before["us_cell"] {
+		t.Fatalf("%s failed - invalid descriptions %#v", name, before)
+	}
+	if namespaces := normalizedNamespaces(app); len(namespaces) != 4 {
+		t.Fatalf("%s failed - expect 4 namespaces but received %#v", name, namespaces)
+	}
+
+	// pipeline specs decoded to other types are the same pipeline
+	app.Config["normalizers"] = map[string]interface{}{"login": []string{"email"}}
+	if desc := normalizationOf(app, "login"); desc != before["login"] {
+		t.Fatalf("%s failed - expect %#v but received %#v", name, before["login"], desc)
+	}
+	// phone_region only affects e164 namespaces without their own region
+	app.Config["phone_region"] = "US"
+	for ns, changed := range map[string]bool{"login": false, "email": false, "msisdn": true, "us_cell": false, "session": false} {
+		if desc := normalizationOf(app, ns); (desc != before[ns]) != changed {
+			t.Fatalf("%s failed - namespace %#v: expect changed=%#v but received %#v (was %#v)", name, ns, changed, desc, before[ns])
+		}
+	}
+}
+
+func TestBoNamespaceRegistry_WithRawObject(t *testing.T) {
+	name := "TestBoNamespaceRegistry_WithRawObject"
+	reg := &BoNamespaceRegistry{Namespaces: map[string]*BoNamespace{"login": {Normalizer: normalizerEmailCanonical, KeepRaw: true}}}
+	attrs := map[string]interface{}{"source": "web", attrRawObject: "overridden"}
+	expected := map[string]interface{}{"source": "web", attrRawObject: "J.Doe+promo@gmail.com"}
+	if result := reg.withRawObject("login", "J.Doe+promo@gmail.com", attrs); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%s failed: expect %#v but received %#v", name, expected, result)
+	}
+	if attrs[attrRawObject] != "overridden" {
+		t.Fatalf("%s failed: input attributes must not be modified", name)
+	}
+	if result := reg.withRawObject("login", "raw", nil); !reflect.DeepEqual(result, map[string]interface{}{attrRawObject: "raw"}) {
+		t.Fatalf("%s failed: unexpected attributes %#v", name, result)
+	}
+	if result := reg.withRawObject("other", "raw", attrs); !reflect.DeepEqual(result, attrs) {
+		t.Fatalf("%s failed - undeclared namespace: expect %#v but received %#v", name, attrs, result)
+	}
+}
+
+func TestBoNamespaceRegistry_CheckMappingObject(t *testing.T) {
+	name := "TestBoNamespaceRegistry_CheckMappingObject"
+	reg := _testNamespaceRegistry()
+	if result := reg.checkMappingObject("login", "user@domain.com"); result != nil {
+		t.Fatalf("%s failed - expect valid object but received %#v", name, result)
+	}
+	if result := reg.checkMappingObject("login", "user"); result == nil || result.Status != itineris.StatusErrorClient {
+		t.Fatalf("%s failed - expect invalid object to be rejected but received %#v", name, result)
+	}
+	if result := reg.checkMappingObject("other", "any"); result != nil {
+		t.Fatalf("%s failed - expect undeclared namespace to be accepted in non-strict mode but received %#v", name, result)
+	}
+	reg.Strict = true
+	if result := reg.checkMappingObject("other", "any"); result == nil || result.Status != itineris.StatusErrorClient {
+		t.Fatalf("%s failed - expect undeclared namespace to be rejected in strict mode but received %#v", name, result)
+	}
+	if result := reg.checkMappingObject("session", "any"); result != nil {
+		t.Fatalf("%s failed - expect declared namespace to be accepted in strict mode but received %#v", name, result)
+	}
+}
+
+func TestBoNamespaceRegistry_Ttl(t *testing.T) {
+	name := "TestBoNamespaceRegistry_Ttl"
+	reg := _testNamespaceRegistry()
+	requested := time.Minute
+	if ttl := reg.ttl("session", nil); ttl == nil || *ttl != 24*time.Hour {
+		t.Fatalf("%s failed - expect declared TTL but received %#v", name, ttl)
+	}
+	if ttl := reg.ttl("session", &requested); ttl != &requested {
+		t.Fatalf("%s failed - expect requested TTL but received %#v", name, ttl)
+	}
+	if ttl := reg.ttl("login", nil); ttl != nil {
+		t.Fatalf("%s failed - expect no TTL but received %#v", name, ttl)
+	}
+	if unique := reg.uniqueNamespaces(); !reflect.DeepEqual(unique, []string{"login"}) {
+		t.Fatalf("%s failed - expect unique namespaces %#v but received %#v", name, []string{"login"}, unique)
+	}
+}
+
+func TestParseNamespaceDeclaration(t *testing.T) {
+	name := "TestParseNamespaceDeclaration"
+	params := itineris.NewApiParams().SetParam("normalizer", "phone").SetParam("validation", `^\d+$`).
+		SetParam("ttl", "60").SetParam("unique", true).SetParam("region", " vn ").SetParam("keep_raw", "true")
+	decl, result := parseNamespaceDeclaration(params)
+	if result != nil || decl.Normalizer != "phone" || decl.Region != "VN" || !decl.KeepRaw || decl.Validation != `^\d+$` || decl.Ttl == nil || *decl.Ttl != 60 || !decl.Unique {
+		t.Fatalf("%s failed: unexpected declaration %#v / %#v", name, decl, result)
+	}
+	if decl, result = parseNamespaceDeclaration(itineris.NewApiParams()); result != nil || !reflect.DeepEqual(decl, &BoNamespace{}) {
+		t.Fatalf("%s failed - expect empty declaration but received %#v / %#v", name, decl, result)
+	}
+	for param, value := range map[string]interface{}{"normalizer": "not-exist", "validation": "(", "ttl": "-1", "unique": "maybe", "region": "XX", "keep_raw": "maybe"} {
+		if _, result := parseNamespaceDeclaration(itineris.NewApiParams().SetParam(param, value)); result == nil || result.Status != itineris.StatusErrorClient {
+			t.Fatalf("%s failed - parameter %#v: expect status %d but received %#v", name, param, itineris.StatusErrorClient, result)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package mom
+
+import (
+	"fmt"
+	"github.com/go-akka/configuration/hocon"
+	"main/src/goems"
+	"regexp"
+	"strings"
+)
+
+/*
+Normalizer pipelines: normalizers composed of built-in steps, defined in config (per namespace, config
+"mom.normalizers") or per app (app config "normalizers"), e.g.
+
+	normalizers {
+	  username = [trim, lowercase]
+	  national_id = [trim, {regex_replace: {pattern: "[^0-9A-Za-z]", replacement: ""}}, uppercase]
+	}
+
+A step is either the name of a simple step (see pipelineSteps, the named normalizers are also accepted), or a map
+{step name: arguments} for steps taking arguments (see pipelineStepBuilders).
+
+@author Thanh Nguyen <btnguyen2k@gmail.com>
+@since 0.1.0
+*/
+
+var regexpWhitespaces = regexp.MustCompile(`\s+`)
+
+// pipelineSteps are the simple steps of normalizer pipelines, by name.
+var pipelineSteps = map[string]INameNormalizer{
+	"trim":                strings.TrimSpace,
+	"lowercase":           strings.ToLower,
+	"uppercase":           strings.ToUpper,
+	"remove_spaces":       func(input string) string { return regexpWhitespaces.ReplaceAllString(input, "") },
+	"digits_only":         func(input string) string { return regexpNonDigit.ReplaceAllString(input, "") },
+	"strip_leading_zeros": func(input string) string { return regexpStartWithZeroes.ReplaceAllString(input, "") },
+}
+
+// pipelineStepBuilders build the steps taking arguments, by name.
+var pipelineStepBuilders = map[string]func(args interface{}) (INameNormalizer, error){
+	// {regex_replace: {pattern: "regular expression", replacement: "replacement, may reference groups as $1"}}
+	"regex_replace": func(args interface{}) (INameNormalizer, error) {
+		m, ok := args.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("arguments must be a map {pattern, replacement}")
+		}
+		pattern, _ := m["pattern"].(string)
+		replacement, _ := m["replacement"].(string)
+		re, err := regexp.Compile(pattern)
+		if err != nil || pattern == "" {
+			return nil, fmt.Errorf("invalid pattern [%s]", pattern)
+		}
+		return func(input string) string { return re.ReplaceAllString(input, replacement) }, nil
+	},
+}
+
+// buildPipelineStep builds a step of a normalizer pipeline from its spec.
+func buildPipelineStep(spec interface{}) (INameNormalizer, error) {
+	switch v := spec.(type) {
+	case string:
+		if step := pipelineSteps[v]; step != nil {
+			return step, nil
+		}
+		if normalizer := namedNormalizers[v]; normalizer != nil {
+			return normalizer, nil
+		}
+		return nil, fmt.Errorf("unknown step [%s]", v)
+	case map[string]interface{}:
+		if len(v) != 1 {
+			return nil, fmt.Errorf("a step with arguments must be a map of exactly one entry {step: arguments}")
+		}
+		for name, args := range v {
+			builder := pipelineStepBuilders[name]
+			if builder == nil {
+				return nil, fmt.Errorf("unknown step [%s]", name)
+			}
+			step, err := builder(args)
+			if err != nil {
+				return nil, fmt.Errorf("step [%s]: %s", name, err.Error())
+			}
+			return step, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid step %#v", spec)
+}
+
+// buildPipeline builds a normalizer that applies steps in order.
+func buildPipeline(spec interface{}) (INameNormalizer, error) {
+	specs, ok := spec.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("pipeline must be a list of steps")
+	}
+	steps := make([]INameNormalizer, len(specs))
+	for i, stepSpec := range specs {
+		step, err := buildPipelineStep(stepSpec)
+		if err != nil {
+			return nil, err
+		}
+		steps[i] = step
+	}
+	return func(input string) string {
+		for _, step := range steps {
+			input = step(input)
+		}
+		return input
+	}, nil
+}
+
+// buildPipelines builds normalizer pipelines from their specs {namespace: [steps]}, keys are normalized.
+func buildPipelines(specs map[string]interface{}) (map[string]INameNormalizer, error) {
+	result := make(map[string]INameNormalizer)
+	for ns, spec := range specs {
+		pipeline, err := buildPipeline(spec)
+		if err != nil {
+			return nil, fmt.Errorf("normalizer of namespace [%s]: %s", ns, err.Error())
+		}
+		result[normalizeNamespace(ns)] = pipeline
+	}
+	return result, nil
+}
+
+// appPipelines builds the normalizer pipelines of an app from its config (key "normalizers"), nil if there is none.
+func appPipelines(appConfig map[string]interface{}) (map[string]INameNormalizer, error) {
+	specs, ok := appConfig["normalizers"]
+	if !ok || specs == nil {
+		return nil, nil
+	}
+	m, ok := specs.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("app config [normalizers] must be a map {namespace: [steps]}")
+	}
+	return buildPipelines(m)
+}
+
+// hoconToGeneric converts a HOCON value to a generic value: map[string]interface{}, []interface{} or string.
+func hoconToGeneric(value *hocon.HoconValue) interface{} {
+	switch {
+	case value == nil:
+		return nil
+	case value.IsObject():
+		result := make(map[string]interface{})
+		for k, v := range value.GetObject().Items() {
+			result[k] = hoconToGeneric(v)
+		}
+		return result
+	case value.IsString():
+		return value.GetString()
+	case value.IsArray():
+		// checked after IsString: literals are reported as (empty) arrays too
+		result := make([]interface{}, 0)
+		for _, v := range value.GetArray() {
+			result = append(result, hoconToGeneric(v))
+		}
+		return result
+	}
+	return value.GetString()
+}
+
+// normalizersFromConfig merges the built-in normalizers with the pipelines of config "mom.normalizers"
+// ({namespace: [steps]}), config pipelines take precedence.
+func normalizersFromConfig(builtins map[string]INameNormalizer) map[string]INameNormalizer {
+	result := make(map[string]INameNormalizer)
+	for ns, normalizer := range builtins {
+		result[ns] = normalizer
+	}
+	specs, _ := hoconToGeneric(goems.AppConfig.GetNode("mom.normalizers")).(map[string]interface{})
+	pipelines, err := buildPipelines(specs)
+	if err != nil {
+		panic("invalid config [mom.normalizers]: " + err.Error())
+	}
+	for ns, pipeline := range pipelines {
+		result[ns] = pipeline
+	}
+	return result
+}
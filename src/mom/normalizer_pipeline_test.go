@@ -0,0 +1,121 @@
+package mom
+
+import (
+	"github.com/go-akka/configuration"
+	"main/src/goems"
+	"testing"
+)
+
+func TestBuildPipeline(t *testing.T) {
+	name := "TestBuildPipeline"
+	testData := []struct {
+		spec     []interface{}
+		input    string
+		expected string
+	}{
+		{[]interface{}{"trim", "lowercase"}, "  John.Doe ", "john.doe"},
+		{[]interface{}{"uppercase", "remove_spaces"}, " ab c\td ", "ABCD"},
+		{[]interface{}{"digits_only", "strip_leading_zeros"}, "(00) 123-456", "123456"},
+		{[]interface{}{"email"}, " User@Domain.COM ", "user@domain.com"},
+		{[]interface{}{"trim", map[string]interface{}{"regex_replace": map[string]interface{}{"pattern": `[^0-9A-Za-z]`, "replacement": ""}}, "uppercase"}, " ab-12.cd ", "AB12CD"},
+		{[]interface{}{map[string]interface{}{"regex_replace": map[string]interface{}{"pattern": `(\w+)@(\w+)`, "replacement": "$2/$1"}}}, "user@host", "host/user"},
+		{[]interface{}{}, " as is ", " as is "},
+	}
+	for _, data := range testData {
+		pipeline, err := buildPipeline(data.spec)
+		if err != nil {
+			t.Fatalf("%s failed - spec %#v: %e", name, data.spec, err)
+		}
+		if output := pipeline(data.input); output != data.expected {
+			t.Fatalf("%s failed - spec %#v: expect %#v but received %#v", name, data.spec, data.expected, output)
+		}
+	}
+
+	invalidSpecs := []interface{}{
+		"trim",
+		[]interface{}{"not-exist"},
+		[]interface{}{1},
+		[]interface{}{map[string]interface{}{"not-exist": nil}},
+		[]interface{}{map[string]interface{}{"regex_replace": "["}},
+		[]interface{}{map[string]interface{}{"regex_replace": map[string]interface{}{"pattern": "["}}},
+		[]interface{}{map[string]interface{}{"regex_replace": map[string]interface{}{"pattern": "a"}, "trim": nil}},
+	}
+	for _, spec := range invalidSpecs {
+		if _, err := buildPipeline(spec); err == nil {
+			t.Fatalf("%s failed - spec %#v: expect error", name, spec)
+		}
+	}
+}
+
+func TestAppPipelines(t *testing.T) {
+	name := "TestAppPipelines"
+	pipelines, err := appPipelines(map[string]interface{}{"normalizers": map[string]interface{}{" UserName ": []interface{}{"trim", "lowercase"}}})
+	if err != nil || pipelines["username"] == nil || pipelines["username"](" Bob ") != "bob" {
+		t.Fatalf("%s failed: %#v / %e", name, pipelines, err)
+	}
+	if pipelines, err = appPipelines(map[string]interface{}{"desc": "no normalizers"}); pipelines != nil || err != nil {
+		t.Fatalf("%s failed - expect no pipelines but received %#v / %e", name, pipelines, err)
+	}
+	for _, spec := range []interface{}{"trim", map[string]interface{}{"username": []interface{}{"not-exist"}}} {
+		if _, err := appPipelines(map[string]interface{}{"normalizers": spec}); err == nil {
+			t.Fatalf("%s failed - spec %#v: expect error", name, spec)
+		}
+	}
+
+	pipelines, _ = appPipelines(map[string]interface{}{"normalizers": map[string]interface{}{"username": []interface{}{"uppercase"}}})
+	reg := &BoNamespaceRegistry{pipelines: pipelines, Namespaces: map[string]*BoNamespace{"username": {Normalizer: "phone"}}}
+	if obj, _ := reg.normalizeObject("username", " bob "); obj != " BOB " {
+		t.Fatalf("%s failed - expect app's pipeline to take precedence but received %#v", name, obj)
+	}
+}
+
+func TestAppPipelines_OverrideBuiltin(t *testing.T) {
+	name := "TestAppPipelines_OverrideBuiltin"
+	defer func(dao IDaoMoMapping) { daoMappings = dao }(daoMappings)
+	daoMappings = NewMemoryDaoMoMapping()
+	pipelines, _ := appPipelines(map[string]interface{}{"normalizers": map[string]interface{}{"phone": []interface{}{"trim"}, "email": []interface{}{"trim"}}})
+	reg := &BoNamespaceRegistry{pipelines: pipelines}
+	testData := map[string][]string{
+		"phone": {" 00123 456 ", "00123 456"}, // built-in would give "123456"
+		"email": {" User@Domain.COM ", "User@Domain.COM"},
+	}
+	for ns, data := range testData {
+		obj, result := reg.normalizeObject(ns, data[0])
+		if result != nil || obj != data[1] {
+			t.Fatalf("%s failed - namespace %#v: expect %#v but received %#v / %#v", name, ns, data[1], obj, result)
+		}
+		// DAOs must not normalize the object again
+		if _, err := daoMappings.Map(_testCtx, "app", ns, obj, "target1", nil, nil, nil); err != nil {
+			t.Fatalf("%s failed: %e", name, err)
+		}
+		if bo, err := daoMappings.FindTargetForObject(_testCtx, "app", ns, data[1]); err != nil || bo == nil || bo.From != data[1] {
+			t.Fatalf("%s failed - namespace %#v: expect object stored as %#v but received %#v / %e", name, ns, data[1], bo, err)
+		}
+	}
+}
+
+func TestNormalizersFromConfig(t *testing.T) {
+	name := "TestNormalizersFromConfig"
+	defer func(config *configuration.Config) { goems.AppConfig = config }(goems.AppConfig)
+	goems.AppConfig = configuration.ParseString(`
+mom.normalizers {
+  username = [trim, lowercase]
+  email = [trim]
+  national_id = [trim, {regex_replace: {pattern: "[^0-9A-Za-z]", replacement: ""}}, uppercase]
+}`)
+	normalizers := normalizersFromConfig(map[string]INameNormalizer{"email": emailNormalizer, "phone": phoneNormalizer})
+	testData := map[string][]string{
+		"username":    {" Bob ", "bob"},
+		"email":       {" User@Domain.com ", "User@Domain.com"}, // overridden by config
+		"phone":       {"+84 123", "84123"},                     // built-in kept
+		"national_id": {" ab-12.cd ", "AB12CD"},
+	}
+	for ns, data := range testData {
+		if normalizers[ns] == nil {
+			t.Fatalf("%s failed - expect normalizer of namespace %#v", name, ns)
+		}
+		if output := normalizers[ns](data[0]); output != data[1] {
+			t.Fatalf("%s failed - namespace %#v: expect %#v but received %#v", name, ns, data[1], output)
+		}
+	}
+}
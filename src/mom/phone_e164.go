@@ -0,0 +1,145 @@
+package mom
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+E.164 phone number normalization: phone numbers are parsed into the canonical E.164 format "+<country code><national
+number>". International numbers ("+84 912 345 678", "0084912345678") are parsed as is, national numbers ("0912 345 678")
+are parsed using a default region (ISO 3166-1 alpha-2 code, e.g. "VN"): the region's trunk prefix is removed and its
+country calling code is prepended.
+
+The default region of a namespace declared with normalizer "e164" is the namespace's region (BoNamespace.Region), or the
+app's region (app config "phone_region").
+
+@author Thanh Nguyen <btnguyen2k@gmail.com>
+@since 0.1.0
+*/
+
+// normalizerE164 is the name of the E.164 phone normalizer that apps can choose for their declared namespaces.
+const normalizerE164 = "e164"
+
+// phoneRegion holds the dialing rules of a region.
+type phoneRegion struct {
+	code  string // country calling code
+	trunk string // national trunk prefix, removed from national numbers (empty if the region has none)
+	idd   string // international dialing prefix, empty means "00"
+}
+
+// phoneRegions are the supported regions, by ISO 3166-1 alpha-2 code.
+var phoneRegions = map[string]phoneRegion{
+	"AE": {code: "971", trunk: "0"},
+	"AR": {code: "54", trunk: "0"},
+	"AT": {code: "43", trunk: "0"},
+	"AU": {code: "61", trunk: "0", idd: "0011"},
+	"BD": {code: "880", trunk: "0"},
+	"BE": {code: "32", trunk: "0"},
+	"BR": {code: "55", trunk: "0"},
+	"CA": {code: "1", trunk: "1", idd: "011"},
+	"CH": {code: "41", trunk: "0"},
+	"CL": {code: "56"},
+	"CN": {code: "86", trunk: "0"},
+	"DE": {code: "49", trunk: "0"},
+	"DK": {code: "45"},
+	"EG": {code: "20", trunk: "0"},
+	"ES": {code: "34"},
+	"FI": {code: "358", trunk: "0"},
+	"FR": {code: "33", trunk: "0"},
+	"GB": {code: "44", trunk: "0"},
+	"HK": {code: "852", idd: "001"},
+	"ID": {code: "62", trunk: "0", idd: "001"},
+	"IE": {code: "353", trunk: "0"},
+	"IL": {code: "972", trunk: "0"},
+	"IN": {code: "91", trunk: "0"},
+	"IT": {code: "39"},
+	"JP": {code: "81", trunk: "0", idd: "010"},
+	"KH": {code: "855", trunk: "0", idd: "001"},
+	"KR": {code: "82", trunk: "0", idd: "001"},
+	"LA": {code: "856", trunk: "0"},
+	"MM": {code: "95", trunk: "0"},
+	"MX": {code: "52"},
+	"MY": {code: "60", trunk: "0"},
+	"NL": {code: "31", trunk: "0"},
+	"NO": {code: "47"},
+	"NZ": {code: "64", trunk: "0"},
+	"PH": {code: "63", trunk: "0"},
+	"PK": {code: "92", trunk: "0"},
+	"PL": {code: "48"},
+	"PT": {code: "351"},
+	"RU": {code: "7", trunk: "8", idd: "810"},
+	"SA": {code: "966", trunk: "0"},
+	"SE": {code: "46", trunk: "0"},
+	"SG": {code: "65", idd: "000"},
+	"TH": {code: "66", trunk: "0", idd: "001"},
+	"TR": {code: "90", trunk: "0"},
+	"TW": {code: "886", trunk: "0", idd: "002"},
+	"UA": {code: "380", trunk: "0"},
+	"US": {code: "1", trunk: "1", idd: "011"},
+	"VN": {code: "84", trunk: "0"},
+	"ZA": {code: "27", trunk: "0"},
+}
+
+// normalizePhoneRegion normalizes a region code, returning an error if the region is not supported.
+func normalizePhoneRegion(region string) (string, error) {
+	region = strings.ToUpper(strings.TrimSpace(region))
+	if _, ok := phoneRegions[region]; region != "" && !ok {
+		return "", fmt.Errorf("unsupported region [%s]", region)
+	}
+	return region, nil
+}
+
+var regexpPhoneSeparators = regexp.MustCompile(`[\s\-.()/]+`)
+
+const (
+	e164MinDigits = 7
+	e164MaxDigits = 15
+)
+
+/*
+parsePhoneE164 parses a phone number into the E.164 format, national numbers are parsed using 'region' (may be empty if
+only international numbers are accepted). It returns an error if the phone number can not be parsed.
+*/
+func parsePhoneE164(phone, region string) (string, error) {
+	number := strings.TrimSpace(phone)
+	international := strings.HasPrefix(number, "+")
+	number = regexpPhoneSeparators.ReplaceAllString(strings.TrimPrefix(number, "+"), "")
+	if number == "" || regexpNonDigit.MatchString(number) {
+		return "", fmt.Errorf("phone number must contain only digits and separators")
+	}
+	if !international {
+		rules, ok := phoneRegions[region]
+		if region != "" && !ok {
+			return "", fmt.Errorf("unsupported region [%s]", region)
+		}
+		switch {
+		case rules.idd != "" && strings.HasPrefix(number, rules.idd):
+			number = number[len(rules.idd):]
+		case rules.idd == "" && strings.HasPrefix(number, "00"):
+			number = number[2:]
+		case region == "":
+			return "", fmt.Errorf("national number without default region")
+		default:
+			number = rules.code + strings.TrimPrefix(number, rules.trunk)
+		}
+	}
+	if number == "" || number[0] == '0' {
+		return "", fmt.Errorf("invalid country calling code")
+	}
+	if len(number) < e164MinDigits || len(number) > e164MaxDigits {
+		return "", fmt.Errorf("phone number must have %d to %d digits", e164MinDigits, e164MaxDigits)
+	}
+	return "+" + number, nil
+}
+
+// appPhoneRegion returns the default region of normalizer "e164" from an app's config (key "phone_region").
+func appPhoneRegion(appConfig map[string]interface{}) (string, error) {
+	value := appConfig["phone_region"]
+	region, ok := value.(string)
+	if value != nil && !ok {
+		return "", fmt.Errorf("region must be a string")
+	}
+	return normalizePhoneRegion(region)
+}
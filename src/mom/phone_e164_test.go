@@ -0,0 +1,56 @@
+package mom
+
+import "testing"
+
+func TestParsePhoneE164(t *testing.T) {
+	name := "TestParsePhoneE164"
+	testData := [][]string{
+		// phone, region, expected
+		{"0912345678", "VN", "+84912345678"},
+		{"+84 912 345 678", "VN", "+84912345678"},
+		{"+84 (912) 345-678", "", "+84912345678"},
+		{"0084912345678", "", "+84912345678"},
+		{"(415) 555-2671", "US", "+14155552671"},
+		{"1-415-555-2671", "US", "+14155552671"},
+		{"011 84 912 345 678", "US", "+84912345678"},
+		{"020 7946 0958", "GB", "+442079460958"},
+		{"06 1234 5678", "IT", "+390612345678"},
+		{"8 912 345-67-89", "RU", "+79123456789"},
+	}
+	for _, data := range testData {
+		if phone, err := parsePhoneE164(data[0], data[1]); err != nil || phone != data[2] {
+			t.Fatalf("%s failed - %#v (region %#v): expect %#v but received %#v / %e", name, data[0], data[1], data[2], phone, err)
+		}
+	}
+
+	invalidData := [][]string{
+		{"", "VN"},
+		{"not a phone", "VN"},
+		{"+84 912 345 678 ext 1", "VN"},
+		{"0912345678", ""},
+		{"0912345678", "XX"},
+		{"+0912345678", "VN"},
+		{"+84 12", "VN"},
+		{"+84 1234 5678 9012 345", "VN"},
+	}
+	for _, data := range invalidData {
+		if phone, err := parsePhoneE164(data[0], data[1]); err == nil {
+			t.Fatalf("%s failed - %#v (region %#v): expect error but received %#v", name, data[0], data[1], phone)
+		}
+	}
+}
+
+func TestAppPhoneRegion(t *testing.T) {
+	name := "TestAppPhoneRegion"
+	if region, err := appPhoneRegion(map[string]interface{}{"phone_region": " vn "}); err != nil || region != "VN" {
+		t.Fatalf("%s failed: expect %#v but received %#v / %e", name, "VN", region, err)
+	}
+	if region, err := appPhoneRegion(map[string]interface{}{}); err != nil || region != "" {
+		t.Fatalf("%s failed: expect no region but received %#v / %e", name, region, err)
+	}
+	for _, region := range []interface{}{"XX", 84} {
+		if _, err := appPhoneRegion(map[string]interface{}{"phone_region": region}); err == nil {
+			t.Fatalf("%s failed - region %#v: expect error", name, region)
+		}
+	}
+}
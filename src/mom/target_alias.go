@@ -0,0 +1,93 @@
+package mom
+
+import (
+	"context"
+	"time"
+)
+
+/*
+Target aliases: when target 'from' is merged into target 'into', 'from' is retired and recorded as an alias of 'into'.
+
+An alias is stored as a regular mapping {from -> into} in the reserved namespace "_alias", so that it is written in the
+same transaction as the merge and is handled by every backend without extra storage. Because merging moves all objects
+of the losing target (including aliases pointing to it) to the surviving target, alias chains are always collapsed:
+resolving an alias takes exactly one lookup.
+
+@author Thanh Nguyen <btnguyen2k@gmail.com>
+@since 0.1.0
+*/
+
+const (
+	// reserved namespace that stores target aliases {retired target -> surviving target}
+	namespaceTargetAlias = "_alias"
+
+	// reserved namespace: first segment of the mapping history API route (/mom/api/_history/:ns/:from), which would
+	// otherwise shadow routes /mom/api/:ns/:from/:to of this namespace
+	namespaceHistory = "_history"
+)
+
+// isReservedNamespace checks if a (normalized) namespace is reserved: the alias namespace is used internally, the history
+// namespace is taken by an API route, and control keys (see controlKeys) share maps with namespaces in API input/output.
+// Other namespaces starting with "_" are regular namespaces.
+func isReservedNamespace(namespace string) bool {
+	return namespace == namespaceTargetAlias || namespace == namespaceHistory || controlKeys[namespace]
+}
+
+// newTargetAlias creates the mapping that records target 'from' as an alias of target 'into'.
+func newTargetAlias(appId, from, into string, t time.Time) *BoMapping {
+	return &BoMapping{Namespace: namespaceTargetAlias, From: from, To: into, Time: t, AppId: appId}
+}
+
+// removeReservedMappings returns mappings that do not belong to reserved namespaces.
+func removeReservedMappings(mappings []*BoMapping) []*BoMapping {
+	result := make([]*BoMapping, 0, len(mappings))
+	for _, bo := range mappings {
+		if !isReservedNamespace(bo.Namespace) {
+			result = append(result, bo)
+		}
+	}
+	return result
+}
+
+// groupMappingsByNamespace groups mappings by their namespace.
+func groupMappingsByNamespace(mappings []*BoMapping) map[string][]*BoMapping {
+	result := make(map[string][]*BoMapping)
+	for _, bo := range mappings {
+		result[bo.Namespace] = append(result[bo.Namespace], bo)
+	}
+	return result
+}
+
+/*
+resolveTarget resolves a target to its canonical (surviving) id.
+
+It returns the canonical target and true if 'target' is a retired target (alias), or 'target' itself and false otherwise.
+*/
+func resolveTarget(ctx context.Context, dao IDaoMoMapping, appId, target string) (string, bool, error) {
+	target = normalizeMappingTarget(target)
+	alias, err := dao.FindTargetForObject(ctx, appId, namespaceTargetAlias, target)
+	if err != nil || alias == nil {
+		return target, false, err
+	}
+	return alias.To, true, nil
+}
+
+/*
+resolveTargets is the batch version of resolveTarget: it resolves targets to their canonical ids with a single lookup.
+
+It returns a map {target: canonical target} of the (normalized) targets that are aliases.
+*/
+func resolveTargets(ctx context.Context, dao IDaoMoMapping, appId string, targets []string) (map[string]string, error) {
+	result := make(map[string]string)
+	if len(targets) == 0 {
+		return result, nil
+	}
+	aliases, err := dao.FindTargetsForObjects(ctx, appId, namespaceTargetAlias, targets)
+	if err != nil {
+		return nil, err
+	}
+	for _, alias := range aliases {
+		result[alias.From] = alias.To
+	}
+	return result, nil
+}
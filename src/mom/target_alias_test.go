@@ -0,0 +1,26 @@
+package mom
+
+import (
+	"main/src/itineris"
+	"testing"
+)
+
+func TestIsReservedNamespace(t *testing.T) {
+	name := "TestIsReservedNamespace"
+	testData := map[string]bool{namespaceTargetAlias: true, "_alias2": false, "_internal": false, "_": false, "email": false,
+		"_target": true, "_aliased": true, "_next": true, "_from": true, "_ttl": true, namespaceHistory: true}
+	for ns, expected := range testData {
+		if reserved := isReservedNamespace(ns); reserved != expected {
+			t.Fatalf("%s failed - namespace %#v: expect %#v but received %#v", name, ns, expected, reserved)
+		}
+	}
+	if result := reservedNamespaceResult("_internal"); result != nil {
+		t.Fatalf("%s failed - expect namespace \"_internal\" to be accepted but received %#v", name, result)
+	}
+	if result := reservedNamespaceResult(normalizeNamespace(" _Target ")); result == nil || result.Status != itineris.StatusErrorClient {
+		t.Fatalf("%s failed - expect namespace \"_target\" to be rejected but received %#v", name, result)
+	}
+	if result := reservedNamespaceResult(namespaceHistory); result == nil || result.Status != itineris.StatusErrorClient {
+		t.Fatalf("%s failed - expect namespace \"_history\" to be rejected but received %#v", name, result)
+	}
+}
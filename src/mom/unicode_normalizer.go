@@ -0,0 +1,69 @@
+package mom
+
+import (
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+/*
+Unicode-safe normalization of free-text identifiers (e.g. usernames), so that visually identical inputs map to the same
+object:
+
+	- invisible characters (zero-width spaces/joiners, soft hyphens, byte order marks...) are removed.
+	- the input is normalized to NFKC (e.g. full-width "ＡＢＣ" becomes "ABC", ligature "ﬁ" becomes "fi").
+	- the input is case folded (e.g. "Straße" and "STRASSE" both become "strasse").
+	- Cyrillic and Greek letters confusable with Latin letters are mapped to their Latin look-alike.
+	- runs of whitespaces (of any kind) are collapsed to a single space, leading and trailing whitespaces are removed.
+
+The normalizer is opt-in: it is available by name "unicode" (see namedNormalizers) for declared namespaces and
+normalizer pipelines.
+
+@author Thanh Nguyen <btnguyen2k@gmail.com>
+@since 0.1.0
+*/
+
+// unicodeInvisibles are the invisible characters removed by unicodeNormalizer.
+var unicodeInvisibles = map[rune]bool{
+	'\u00AD': true, // soft hyphen
+	'\u034F': true, // combining grapheme joiner
+	'\u180E': true, // mongolian vowel separator
+	'\u200B': true, // zero width space
+	'\u200C': true, // zero width non-joiner
+	'\u200D': true, // zero width joiner
+	'\u2060': true, // word joiner
+	'\uFEFF': true, // zero width no-break space (byte order mark)
+}
+
+// unicodeConfusables map (case folded) letters to the Latin letter they are visually confusable with.
+var unicodeConfusables = map[rune]rune{
+	// Cyrillic
+	'\u0430': 'a', '\u0435': 'e', '\u04BB': 'h', '\u0456': 'i', '\u0458': 'j', '\u043E': 'o', '\u0440': 'p',
+	'\u0441': 'c', '\u0455': 's', '\u0443': 'y', '\u0445': 'x', '\u0501': 'd', '\u051B': 'q', '\u051D': 'w',
+	// Greek
+	'\u03B1': 'a', '\u03B9': 'i', '\u03BA': 'k', '\u03BD': 'v', '\u03BF': 'o', '\u03C1': 'p', '\u03C5': 'u',
+	'\u03C7': 'x',
+}
+
+/*
+unicodeNormalizer normalizes free-text identifiers in a Unicode-safe way.
+*/
+func unicodeNormalizer(input string) string {
+	input = strings.Map(func(r rune) rune {
+		if unicodeInvisibles[r] {
+			return -1
+		}
+		return r
+	}, input)
+	// case folding may produce non-NFKC output (and vice versa), hence NFKC is applied again; casers are stateful and
+	// not safe for concurrent use, hence one per call
+	input = norm.NFKC.String(cases.Fold().String(norm.NFKC.String(input)))
+	input = strings.Map(func(r rune) rune {
+		if latin, ok := unicodeConfusables[r]; ok {
+			return latin
+		}
+		return r
+	}, input)
+	return strings.Join(strings.FieldsFunc(input, unicode.IsSpace), " ")
+}
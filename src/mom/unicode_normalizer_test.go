@@ -0,0 +1,31 @@
+package mom
+
+import "testing"
+
+func TestUnicodeNormalizer(t *testing.T) {
+	name := "TestUnicodeNormalizer"
+	testData := map[string]string{
+		"  John Doe  ":                   "john doe",
+		"\uFF2A\uFF4F\uFF48\uFF4E":       "john",            // full-width
+		"Stra\u00DFe":                    "strasse",         // sharp s
+		"STRASSE":                        "strasse",         // same as above
+		"e\u0301le\u0300ve":              "\u00E9l\u00E8ve", // decomposed to composed
+		"\uFB01sh":                       "fish",            // ligature
+		"jo\u200Bhn\u00AD\uFEFF":         "john",            // invisible characters
+		"john \u3000\t doe":              "john doe",        // whitespaces
+		"\u0440\u0430y\u0440\u0430l":     "paypal",          // Cyrillic look-alikes
+		"\u0391\u039FL":                  "aol",             // Greek look-alikes
+		"\u03A3\u039F\u03A6\u0399\u0391": "\u03C3o\u03C6ia", // Greek letters without look-alike are kept
+		"Nguy\u1EC5n V\u0103n A":         "nguy\u1EC5n v\u0103n a",
+	}
+	for input, expected := range testData {
+		if output := unicodeNormalizer(input); output != expected {
+			t.Fatalf("%s failed - %#v: expect %#v but received %#v", name, input, expected, output)
+		}
+	}
+
+	pipeline, err := buildPipeline([]interface{}{"unicode"})
+	if err != nil || pipeline("\uFF2A\uFF2F\uFF28\uFF2E") != "john" {
+		t.Fatalf("%s failed: expect normalizer to be usable in pipelines (%e)", name, err)
+	}
+}